@@ -8,6 +8,10 @@
 package config
 
 import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
@@ -19,16 +23,102 @@ import (
 // canceled - which for an event listener means exceeding the agent's Request-Timeout.
 const DefaultApiTimeout = 5 * time.Second
 
+// DefaultDiscoveryConcurrency bounds how many datasources are discovered in parallel.
+const DefaultDiscoveryConcurrency = 8
+
+// DefaultDiscoveryDatasourceTimeout bounds the discovery of a single datasource, i.e. its health check
+// and the retrieval of its rules, so a slow datasource cannot hold up a whole discovery run.
+const DefaultDiscoveryDatasourceTimeout = 15 * time.Second
+
+// DefaultDatasourceHealthTimeout bounds the health request of the datasource health check. Grafana gives up
+// on a datasource after its dataproxy timeout of 30s by default, so the request must last longer to tell an
+// unresponsive datasource from an unresponsive Grafana.
+const DefaultDatasourceHealthTimeout = 35 * time.Second
+
+// DefaultDatasourceHealthCacheTtl is how long a healthy datasource is not checked again.
+const DefaultDatasourceHealthCacheTtl = 5 * time.Minute
+
+// DefaultDatasourceHealthBackoff is how long an unhealthy datasource is not checked again after its
+// first failed check. It doubles with every further failed check, up to DefaultDatasourceHealthBackoffMax.
+const DefaultDatasourceHealthBackoff = 1 * time.Minute
+
+// DefaultDatasourceHealthBackoffMax bounds the backoff of unhealthy datasources.
+const DefaultDatasourceHealthBackoffMax = 30 * time.Minute
+
+// DefaultInstanceName is the name of the Grafana instance configured through
+// STEADYBIT_EXTENSION_API_BASE_URL and STEADYBIT_EXTENSION_SERVICE_TOKEN, unless overridden by
+// STEADYBIT_EXTENSION_INSTANCE_NAME.
+const DefaultInstanceName = "default"
+
 // Specification is the configuration specification for the extension. Configuration values can be applied
 // through environment variables. Learn more through the documentation of the envconfig package.
 // https://github.com/kelseyhightower/envconfig
 type Specification struct {
-	ServiceToken                     string   `json:"serviceToken" split_words:"true" required:"true"`
-	ApiBaseUrl                       string   `json:"apiBaseUrl" split_words:"true" required:"true"`
+	ServiceToken                     string   `json:"serviceToken" split_words:"true" required:"false"`
+	ApiBaseUrl                       string   `json:"apiBaseUrl" split_words:"true" required:"false"`
+	InstanceName                     string   `json:"instanceName" split_words:"true" required:"false" default:"default"`
 	DiscoveryAttributesExcludesAlert []string `json:"discoveryAttributesExcludesAlertRules" split_words:"true" required:"false"`
 	SendAnnotations                  bool     `json:"sendAnnotations" split_words:"true" required:"false" default:"false"`
+	// AnnotationInstances limits the instances annotations are sent to. Annotations are sent to all
+	// instances when empty.
+	AnnotationInstances []string `json:"annotationInstances" split_words:"true" required:"false"`
 	// ApiTimeout is the timeout for a single request to the Grafana API.
 	ApiTimeout time.Duration `json:"apiTimeout" split_words:"true" required:"false" default:"5s"`
+	// DiscoveryConcurrency is the number of datasources discovered in parallel.
+	DiscoveryConcurrency int `json:"discoveryConcurrency" split_words:"true" required:"false" default:"8"`
+	// DiscoveryDatasourceTimeout is the timeout for discovering the alert rules of a single datasource.
+	DiscoveryDatasourceTimeout time.Duration `json:"discoveryDatasourceTimeout" split_words:"true" required:"false" default:"15s"`
+	// AlertRuleDatasourceTypes are datasource plugin types whose alert rules are discovered, in addition
+	// to the built-in ones.
+	AlertRuleDatasourceTypes []string `json:"alertRuleDatasourceTypes" split_words:"true" required:"false"`
+	// DiscoveryProbeRuler enables probing the rules endpoint of datasources of other types, to discover
+	// the alert rules of those which support them.
+	DiscoveryProbeRuler bool `json:"discoveryProbeRuler" split_words:"true" required:"false" default:"false"`
+	// DatasourceHealthTimeout is the timeout for the health request of the datasource health check.
+	DatasourceHealthTimeout time.Duration `json:"datasourceHealthTimeout" split_words:"true" required:"false" default:"35s"`
+	// DatasourceHealthCacheTtl is how long the health of a healthy datasource is cached.
+	DatasourceHealthCacheTtl time.Duration `json:"datasourceHealthCacheTtl" split_words:"true" required:"false" default:"5m"`
+	// DatasourceHealthBackoff is the initial backoff of an unhealthy datasource, doubled on each failed check.
+	DatasourceHealthBackoff time.Duration `json:"datasourceHealthBackoff" split_words:"true" required:"false" default:"1m"`
+	// DatasourceHealthBackoffMax bounds the backoff of an unhealthy datasource.
+	DatasourceHealthBackoffMax time.Duration `json:"datasourceHealthBackoffMax" split_words:"true" required:"false" default:"30m"`
+	// DiscoverySkipHealthCheckDatasources are uids or names of datasources which are not health checked,
+	// or "*" for all. The status of their rules endpoint decides whether their discovery failed.
+	DiscoverySkipHealthCheckDatasources []string `json:"discoverySkipHealthCheckDatasources" split_words:"true" required:"false"`
+	// DiscoveryIncludesAlertRule are comma-separated matchers limiting the discovery of alert rules and
+	// instances, e.g. folder="Shop",label.severity=~"critical|warning".
+	DiscoveryIncludesAlertRule string `json:"discoveryIncludesAlertRules" split_words:"true" required:"false"`
+	// DiscoveryAttributesExcludesAlertInstance are attributes of alert instances excluded during discovery.
+	DiscoveryAttributesExcludesAlertInstance []string `json:"discoveryAttributesExcludesAlertInstances" split_words:"true" required:"false"`
+	// DiscoveryAttributesExcludesDashboard are attributes of dashboards excluded during discovery.
+	DiscoveryAttributesExcludesDashboard []string `json:"discoveryAttributesExcludesDashboards" split_words:"true" required:"false"`
+	// DiscoveryAttributesExcludesDatasource are attributes of datasources excluded during discovery.
+	DiscoveryAttributesExcludesDatasource []string `json:"discoveryAttributesExcludesDatasources" split_words:"true" required:"false"`
+	// DiscoveryAttributesExcludesContactPoint are attributes of contact points excluded during discovery.
+	DiscoveryAttributesExcludesContactPoint []string `json:"discoveryAttributesExcludesContactPoints" split_words:"true" required:"false"`
+	// DiscoveryAttributesExcludesSlo are attributes of SLOs excluded during discovery.
+	DiscoveryAttributesExcludesSlo []string `json:"discoveryAttributesExcludesSlos" split_words:"true" required:"false"`
+	// DiscoveryAttributesExcludesSyntheticCheck are attributes of Synthetic Monitoring checks excluded during discovery.
+	DiscoveryAttributesExcludesSyntheticCheck []string `json:"discoveryAttributesExcludesSyntheticChecks" split_words:"true" required:"false"`
+	// DiscoveryAlertInstancesSource is where alert instances are discovered from, "rules" for the alerts
+	// of the rules of all datasources or "alertmanager" for the Alertmanager of Grafana.
+	DiscoveryAlertInstancesSource string `json:"discoveryAlertInstancesSource" split_words:"true" required:"false" default:"rules"`
+	// RulesPollingFreshness is how long the rules of a datasource fetched by one alert rule check are
+	// reused by the other checks of rules of the same datasource and group. 0 disables sharing.
+	RulesPollingFreshness time.Duration `json:"rulesPollingFreshness" split_words:"true" required:"false" default:"1s"`
+	// Instances are all Grafana instances the extension talks to. They are not read from a single
+	// variable, see parseInstances.
+	Instances []Instance `json:"instances" ignored:"true"`
+}
+
+// Instance is a single Grafana instance. Besides the instance configured through
+// STEADYBIT_EXTENSION_API_BASE_URL, additional instances are configured through indexed variables,
+// e.g. STEADYBIT_EXTENSION_INSTANCE_0_NAME, STEADYBIT_EXTENSION_INSTANCE_0_API_BASE_URL and
+// STEADYBIT_EXTENSION_INSTANCE_0_SERVICE_TOKEN.
+type Instance struct {
+	Name         string `json:"name" split_words:"true" required:"true"`
+	ApiBaseUrl   string `json:"apiBaseUrl" split_words:"true" required:"true"`
+	ServiceToken string `json:"serviceToken" split_words:"true" required:"true"`
 }
 
 // GetApiTimeout returns the configured timeout, falling back to DefaultApiTimeout for
@@ -40,6 +130,68 @@ func (s *Specification) GetApiTimeout() time.Duration {
 	return DefaultApiTimeout
 }
 
+// GetDiscoveryConcurrency returns the configured concurrency, falling back to DefaultDiscoveryConcurrency.
+func (s *Specification) GetDiscoveryConcurrency() int {
+	if s.DiscoveryConcurrency > 0 {
+		return s.DiscoveryConcurrency
+	}
+	return DefaultDiscoveryConcurrency
+}
+
+// GetDiscoveryDatasourceTimeout returns the configured timeout, falling back to DefaultDiscoveryDatasourceTimeout.
+func (s *Specification) GetDiscoveryDatasourceTimeout() time.Duration {
+	if s.DiscoveryDatasourceTimeout > 0 {
+		return s.DiscoveryDatasourceTimeout
+	}
+	return DefaultDiscoveryDatasourceTimeout
+}
+
+// GetDatasourceHealthTimeout returns the configured timeout, falling back to DefaultDatasourceHealthTimeout.
+func (s *Specification) GetDatasourceHealthTimeout() time.Duration {
+	if s.DatasourceHealthTimeout > 0 {
+		return s.DatasourceHealthTimeout
+	}
+	return DefaultDatasourceHealthTimeout
+}
+
+// GetDatasourceHealthCacheTtl returns the configured TTL, falling back to DefaultDatasourceHealthCacheTtl.
+func (s *Specification) GetDatasourceHealthCacheTtl() time.Duration {
+	if s.DatasourceHealthCacheTtl > 0 {
+		return s.DatasourceHealthCacheTtl
+	}
+	return DefaultDatasourceHealthCacheTtl
+}
+
+// GetDatasourceHealthBackoff returns the configured backoff, falling back to DefaultDatasourceHealthBackoff.
+func (s *Specification) GetDatasourceHealthBackoff() time.Duration {
+	if s.DatasourceHealthBackoff > 0 {
+		return s.DatasourceHealthBackoff
+	}
+	return DefaultDatasourceHealthBackoff
+}
+
+// GetDatasourceHealthBackoffMax returns the configured maximum backoff, falling back to DefaultDatasourceHealthBackoffMax.
+func (s *Specification) GetDatasourceHealthBackoffMax() time.Duration {
+	if s.DatasourceHealthBackoffMax > 0 {
+		return s.DatasourceHealthBackoffMax
+	}
+	return DefaultDatasourceHealthBackoffMax
+}
+
+// GetAnnotationInstances returns the instances annotations are sent to.
+func (s *Specification) GetAnnotationInstances() []Instance {
+	if len(s.AnnotationInstances) == 0 {
+		return s.Instances
+	}
+	instances := make([]Instance, 0, len(s.AnnotationInstances))
+	for _, instance := range s.Instances {
+		if slices.Contains(s.AnnotationInstances, instance.Name) {
+			instances = append(instances, instance)
+		}
+	}
+	return instances
+}
+
 var (
 	Config Specification
 )
@@ -49,8 +201,58 @@ func ParseConfiguration() {
 	if err != nil {
 		log.Fatal().Err(err).Msgf("Failed to parse configuration from environment.")
 	}
+	Config.Instances = parseInstances()
+}
+
+// parseInstances collects the instance configured through STEADYBIT_EXTENSION_API_BASE_URL and the
+// indexed STEADYBIT_EXTENSION_INSTANCE_<n>_* instances. Indexes have to be consecutive, starting at 0.
+func parseInstances() []Instance {
+	instances := make([]Instance, 0)
+	if Config.ApiBaseUrl != "" {
+		instances = append(instances, Instance{
+			Name:         Config.InstanceName,
+			ApiBaseUrl:   Config.ApiBaseUrl,
+			ServiceToken: Config.ServiceToken,
+		})
+	}
+
+	for i := 0; ; i++ {
+		prefix := fmt.Sprintf("steadybit_extension_instance_%d", i)
+		if _, ok := os.LookupEnv(strings.ToUpper(prefix + "_name")); !ok {
+			break
+		}
+		var instance Instance
+		if err := envconfig.Process(prefix, &instance); err != nil {
+			log.Fatal().Err(err).Msgf("Failed to parse configuration of Grafana instance %d from environment.", i)
+		}
+		instances = append(instances, instance)
+	}
+	return instances
 }
 
 func ValidateConfiguration() {
-	// You may optionally validate the configuration here.
+	if len(Config.Instances) == 0 {
+		log.Fatal().Msg("No Grafana instance configured. Set STEADYBIT_EXTENSION_API_BASE_URL and STEADYBIT_EXTENSION_SERVICE_TOKEN, or STEADYBIT_EXTENSION_INSTANCE_0_*.")
+	}
+
+	names := make(map[string]bool, len(Config.Instances))
+	for _, instance := range Config.Instances {
+		if instance.ServiceToken == "" {
+			log.Fatal().Msgf("Grafana instance '%s' has no service token configured.", instance.Name)
+		}
+		if names[instance.Name] {
+			log.Fatal().Msgf("Grafana instance name '%s' is configured more than once.", instance.Name)
+		}
+		names[instance.Name] = true
+	}
+
+	if Config.DiscoveryAlertInstancesSource != "rules" && Config.DiscoveryAlertInstancesSource != "alertmanager" {
+		log.Fatal().Msgf("Unknown alert instances source '%s', expected 'rules' or 'alertmanager'.", Config.DiscoveryAlertInstancesSource)
+	}
+
+	for _, name := range Config.AnnotationInstances {
+		if !names[name] {
+			log.Fatal().Msgf("Annotation instance '%s' is not a configured Grafana instance.", name)
+		}
+	}
 }
@@ -182,7 +182,7 @@ func testDiscovery(t *testing.T, _ *e2e.Minikube, e *e2e.Extension) {
 	defer cancel()
 
 	target, err := e2e.PollForTarget(ctx, e, "com.steadybit.extension_grafana.alert-rule", func(target discovery_kit_api.Target) bool {
-		return e2e.HasAttribute(target, "grafana.alert-rule.id", "host.minikube.internal-Prometheus-GoldenSignalsAlerts-test_firing")
+		return e2e.HasAttribute(target, "grafana.alert-rule.id", "host.minikube.internal-prometheus-GoldenSignalsAlerts-test_firing")
 	})
 	require.NoError(t, err)
 	assert.Equal(t, target.TargetType, "com.steadybit.extension_grafana.alert-rule")
@@ -0,0 +1,260 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extalertrules
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/extension-kit/extutil"
+)
+
+// The check runs once per selected alert rule. To evaluate the selection as a whole, the checks of one
+// step join an aggregation group. Each check reports whether its rule has an expected state, and the
+// first check of the group - the leader - reports the outcome for the whole selection. The groups are
+// held in memory, so all checks of a step have to be executed by the same extension instance: the chart
+// runs a single replica, and a check whose group is unknown, e.g. after a restart, errors instead of
+// reporting a partial outcome.
+//
+// The action API does not tell the step a check belongs to. Checks join the group of their experiment
+// execution and step configuration which was started within aggregationJoinWindow and doesn't contain
+// their rule yet, so that repeated steps and parallel steps selecting the same rules get groups of their
+// own. Parallel steps of identical configuration selecting disjoint rules can't be told apart.
+
+// aggregationGracePeriod is how long the leader waits at the end of the step for the other checks of the
+// group to complete, as they were prepared and are polled independently.
+const aggregationGracePeriod = 10 * time.Second
+
+// aggregationJoinWindow is how long after the first check of a step the other checks of the step are
+// expected to be prepared.
+const aggregationJoinWindow = 10 * time.Second
+
+const (
+	aggregationIndividual = "individual"
+	aggregationAtLeast    = "atLeast"
+	aggregationAtMost     = "atMost"
+	aggregationAny        = "any"
+	aggregationNone       = "none"
+)
+
+type aggregationMember struct {
+	name        string
+	reported    bool
+	matchedOnce bool
+	matchingNow bool
+	completed   bool
+}
+
+type aggregationGroup struct {
+	signature string
+	leader    string
+	members   map[string]*aggregationMember
+	started   time.Time
+	expires   time.Time
+	// done is set once the leader reported the outcome, the group is removed once all checks completed.
+	done bool
+}
+
+var aggregations = struct {
+	sync.Mutex
+	groups   map[string]*aggregationGroup
+	sequence int
+}{groups: make(map[string]*aggregationGroup)}
+
+// aggregationSignature identifies the steps the check may belong to.
+func aggregationSignature(executionId *int, config map[string]any) string {
+	configJson, _ := json.Marshal(config)
+	id := 0
+	if executionId != nil {
+		id = *executionId
+	}
+	return fmt.Sprintf("%d/%s", id, configJson)
+}
+
+// joinAggregation adds the rule to the group of its step and returns the key of the group. Groups of
+// steps ended a while ago are removed.
+func joinAggregation(signature string, member string, name string, start time.Time, end time.Time) string {
+	aggregations.Lock()
+	defer aggregations.Unlock()
+
+	now := time.Now()
+	for k, group := range aggregations.groups {
+		if now.After(group.expires) {
+			delete(aggregations.groups, k)
+		}
+	}
+
+	key := ""
+	for k, group := range aggregations.groups {
+		_, joined := group.members[member]
+		if group.signature == signature && !group.done && !joined && start.Sub(group.started).Abs() <= aggregationJoinWindow {
+			key = k
+			break
+		}
+	}
+	if key == "" {
+		aggregations.sequence++
+		key = fmt.Sprintf("%s#%d", signature, aggregations.sequence)
+		aggregations.groups[key] = &aggregationGroup{signature: signature, leader: member, members: make(map[string]*aggregationMember), started: start}
+	}
+	group := aggregations.groups[key]
+	group.members[member] = &aggregationMember{name: name}
+	if expires := end.Add(5 * time.Minute); expires.After(group.expires) {
+		group.expires = expires
+	}
+	return key
+}
+
+// aggregationSnapshot are the names of the rules of the group having an expected state now, or at
+// least once, the number of rules in the group and whether all of their checks reported and completed.
+// unknown is set if the group is not held by this extension instance.
+type aggregationSnapshot struct {
+	unknown      bool
+	leader       bool
+	matchingNow  []string
+	matchedOnce  []string
+	total        int
+	allReported  bool
+	allCompleted bool
+}
+
+func reportAggregation(key string, member string, name string, matching bool, completed bool) aggregationSnapshot {
+	aggregations.Lock()
+	defer aggregations.Unlock()
+
+	group, ok := aggregations.groups[key]
+	if !ok {
+		return aggregationSnapshot{unknown: true}
+	}
+	m, ok := group.members[member]
+	if !ok {
+		m = &aggregationMember{name: name}
+		group.members[member] = m
+	}
+	m.reported = true
+	m.matchingNow = matching
+	m.matchedOnce = m.matchedOnce || matching
+	m.completed = completed
+
+	snapshot := aggregationSnapshot{leader: group.leader == member, total: len(group.members), allReported: true, allCompleted: true}
+	for _, m := range group.members {
+		snapshot.allReported = snapshot.allReported && m.reported
+		snapshot.allCompleted = snapshot.allCompleted && m.completed
+		if m.matchingNow {
+			snapshot.matchingNow = append(snapshot.matchingNow, m.name)
+		}
+		if m.matchedOnce {
+			snapshot.matchedOnce = append(snapshot.matchedOnce, m.name)
+		}
+	}
+	slices.Sort(snapshot.matchingNow)
+	slices.Sort(snapshot.matchedOnce)
+	if group.done && snapshot.allCompleted {
+		delete(aggregations.groups, key)
+	}
+	return snapshot
+}
+
+// completeAggregation records that the leader reported the outcome of the group. The group is removed
+// once all of its checks completed.
+func completeAggregation(key string) {
+	aggregations.Lock()
+	defer aggregations.Unlock()
+
+	group, ok := aggregations.groups[key]
+	if !ok {
+		return
+	}
+	group.done = true
+	for _, m := range group.members {
+		if !m.completed {
+			return
+		}
+	}
+	delete(aggregations.groups, key)
+}
+
+// aggregationBounds turns the aggregation into the minimum and maximum number of rules expected to have
+// an expected state, -1 for no bound.
+func aggregationBounds(aggregation string, count int) (int, int) {
+	switch aggregation {
+	case aggregationAtLeast:
+		return count, -1
+	case aggregationAtMost:
+		return -1, count
+	case aggregationAny:
+		return 1, -1
+	case aggregationNone:
+		return -1, 0
+	}
+	return -1, -1
+}
+
+// checkAggregation evaluates the selection as a whole. Only the leader reports the outcome. In 'all the
+// time' mode the bounds apply to the rules having an expected state at every poll of the leader, once all
+// checks of the group reported. In 'at least once' mode they apply to the rules having had an expected
+// state at least once, so the maximum can be exceeded before the end of the step, but the minimum only be
+// missed at the end. The leader completes once all checks of the group completed, or the grace period
+// passed.
+func checkAggregation(state *AlertRuleCheckState, matching bool, name string, now time.Time) (*action_kit_api.ActionKitError, bool) {
+	completed := now.After(state.End)
+	snapshot := reportAggregation(state.AggregationKey, state.AlertRuleId, name, matching, completed)
+	if snapshot.unknown {
+		return new(action_kit_api.ActionKitError{
+			Title:  fmt.Sprintf("The selection of alert rule '%s' can't be evaluated as a whole, as the extension was restarted or runs more than one replica.", name),
+			Status: extutil.Ptr(action_kit_api.Errored),
+		}), true
+	}
+	if !snapshot.leader {
+		return nil, completed
+	}
+	if completed && !snapshot.allCompleted && now.Before(state.End.Add(aggregationGracePeriod)) {
+		completed = false
+	}
+	if completed {
+		defer completeAggregation(state.AggregationKey)
+	}
+
+	minimum, maximum := aggregationBounds(state.Aggregation, state.AggregationCount)
+	matched, when := snapshot.matchedOnce, "at least once"
+	if state.StateCheckMode == stateCheckModeAllTheTime {
+		matched, when = snapshot.matchingNow, "at the same time"
+	}
+	describe := func(expectation string) string {
+		rules := "none"
+		if len(matched) > 0 {
+			rules = strings.Join(matched, ", ")
+		}
+		return fmt.Sprintf("%d of %d selected alert rules had state '%s' %s whereas %s expected (%s).",
+			len(matched), snapshot.total, state.ExpectedState, when, expectation, rules)
+	}
+
+	var deviation string
+	if maximum >= 0 && len(matched) > maximum {
+		deviation = describe(fmt.Sprintf("at most %d are", maximum))
+	} else if minimum >= 0 && len(matched) < minimum && (completed || (state.StateCheckMode == stateCheckModeAllTheTime && snapshot.allReported)) {
+		deviation = describe(fmt.Sprintf("at least %d are", minimum))
+	}
+
+	if deviation != "" && state.FailEarly {
+		return new(action_kit_api.ActionKitError{Title: deviation, Status: extutil.Ptr(action_kit_api.Failed)}), completed
+	}
+	if deviation != "" && !state.DeviationSeen {
+		state.DeviationSeen = true
+		state.DeviationTitle = deviation
+	}
+	if completed && state.DeviationSeen {
+		return new(action_kit_api.ActionKitError{Title: state.DeviationTitle, Status: extutil.Ptr(action_kit_api.Failed)}), completed
+	}
+	return nil, completed
+}
@@ -12,12 +12,14 @@ import (
 	"fmt"
 	"net/url"
 	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/steadybit/action-kit/go/action_kit_api/v2"
 	"github.com/steadybit/action-kit/go/action_kit_sdk"
-	"github.com/steadybit/extension-grafana/config"
+	"github.com/steadybit/extension-grafana/extgrafana"
 	extension_kit "github.com/steadybit/extension-kit"
 	"github.com/steadybit/extension-kit/extbuild"
 	"github.com/steadybit/extension-kit/extutil"
@@ -29,21 +31,63 @@ type AlertRuleStateCheckAction struct{}
 var (
 	_ action_kit_sdk.Action[AlertRuleCheckState]           = (*AlertRuleStateCheckAction)(nil)
 	_ action_kit_sdk.ActionWithStatus[AlertRuleCheckState] = (*AlertRuleStateCheckAction)(nil)
+	_ action_kit_sdk.ActionWithStop[AlertRuleCheckState]   = (*AlertRuleStateCheckAction)(nil)
 )
 
 type AlertRuleCheckState struct {
+	// Instance is the name of the Grafana instance the target was discovered from.
+	Instance string
+	// OrgId is the organization the alert rule belongs to, 0 for the organization of the service token.
+	OrgId               int
 	AlertRuleId         string
 	AlertRuleDatasource string
 	AlertRuleName       string
-	End                 time.Time
-	ExpectedState       []string
-	StateCheckMode      string
-	StateCheckSuccess   bool
-	FailEarly           bool
+	// AlertRuleUid identifies Grafana-managed rules. Rules without UID are resolved by name and
+	// AlertRuleFingerprint, which tells apart rules sharing their name within a group.
+	AlertRuleUid         string
+	AlertRuleFingerprint string
+	End                  time.Time
+	ExpectedState        []string
+	StateCheckMode       string
+	StateCheckSuccess    bool
+	FailEarly            bool
+	// AlertRuleGroup and AlertRuleFolder tell rules apart which share their name, AlertRuleFolderUid
+	// allows to narrow the request of Grafana-managed rules to the group, see rulesFilter.
+	AlertRuleGroup     string
+	AlertRuleFolder    string
+	AlertRuleFolderUid string
 	// DeviationSeen and DeviationTitle are used in 'fail at end' mode (FailEarly = false) to remember
 	// that a deviating state was observed during the step so the failure can be reported once the step ends.
 	DeviationSeen  bool
 	DeviationTitle string
+	// LabelMatchers scope the check to the alert instances of the rule they match, see scopeToInstances.
+	LabelMatchers string
+	// ExpectedStateSequence is the order of states expected in 'transition sequence' mode.
+	// SequenceIndex is the number of them observed so far, SequenceError the first out of order state.
+	ExpectedStateSequence []string
+	SequenceIndex         int
+	SequenceError         string
+	// Aggregation evaluates the selected rules as a whole, see checkAggregation. AggregationKey identifies
+	// the aggregation group of the step the rules are selected by, see joinAggregation.
+	Aggregation      string
+	AggregationCount int
+	AggregationKey   string
+	// Start is the start of the step, latencies are measured from it.
+	Start     time.Time
+	Latencies AlertLatencies
+	// Timeline records the state transitions of the rule, attached as artifact at the end of the step.
+	Timeline []StateTransition
+	// UnhealthyHandling is how evaluations with health error or nodata are handled, see checkRuleHealth.
+	// UnhealthyTitle remembers the first of them until the end of the step, unless failing early.
+	UnhealthyHandling string
+	UnhealthyTitle    string
+	// MinStateDuration is how long the rule has to have an expected state in 'at least once' mode,
+	// continuously or in total depending on MinStateDurationMode. Streak tracks it.
+	MinStateDuration     time.Duration
+	MinStateDurationMode string
+	Streak               StateStreak
+	// ApiErrors counts the polls failing to retrieve the rule from Grafana, see tolerateUnavailable.
+	ApiErrors extgrafana.ApiErrorTolerance
 }
 
 func NewAlertRuleStateCheckAction() action_kit_sdk.Action[AlertRuleCheckState] {
@@ -76,7 +120,7 @@ func (m *AlertRuleStateCheckAction) Describe() action_kit_api.ActionDescription
 
 		Kind:        action_kit_api.Check,
 		TimeControl: action_kit_api.TimeControlInternal,
-		Parameters: []action_kit_api.ActionParameter{
+		Parameters: append([]action_kit_api.ActionParameter{
 			{
 				Name:         "duration",
 				Label:        "Duration",
@@ -127,10 +171,69 @@ func (m *AlertRuleStateCheckAction) Describe() action_kit_api.ActionDescription
 						Label: "At least once",
 						Value: stateCheckModeAtLeastOnce,
 					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "Transition sequence",
+						Value: stateCheckModeSequence,
+					},
 				}),
 				Required: new(true),
 				Order:    new(3),
 			},
+			{
+				Name:        "expectedStateSequence",
+				Label:       "Expected State Sequence",
+				Description: new("Only used by the 'Transition sequence' mode: the states the rule is expected to go through, in this order, e.g. pending, firing, inactive. States before the first one of the sequence and states not listed in it are ignored."),
+				Type:        action_kit_api.ActionParameterTypeStringArray,
+				Options: new([]action_kit_api.ParameterOption{
+					action_kit_api.ExplicitParameterOption{
+						Label: "Firing",
+						Value: "firing",
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "Pending",
+						Value: "pending",
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "Normal",
+						Value: "normal",
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "Inactive",
+						Value: "inactive",
+					},
+				}),
+				Required: new(false),
+				Order:    new(4),
+			},
+			{
+				Name:        "minStateDuration",
+				Label:       "Minimum State Duration",
+				Description: new("Only used by the 'At least once' mode: how long the rule has to have an expected state, e.g. firing for at least 2m, so that a flapping rule does not pass the check."),
+				Type:        action_kit_api.ActionParameterTypeDuration,
+				Advanced:    new(true),
+				Required:    new(false),
+				Order:       new(5),
+			},
+			{
+				Name:         "minStateDurationMode",
+				Label:        "Minimum State Duration Mode",
+				Description:  new("Whether the minimum state duration has to be held continuously, or may add up over several periods."),
+				Type:         action_kit_api.ActionParameterTypeString,
+				DefaultValue: new(minStateDurationContinuous),
+				Options: new([]action_kit_api.ParameterOption{
+					action_kit_api.ExplicitParameterOption{
+						Label: "Continuously",
+						Value: minStateDurationContinuous,
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "In total",
+						Value: minStateDurationCumulative,
+					},
+				}),
+				Advanced: new(true),
+				Required: new(false),
+				Order:    new(6),
+			},
 			{
 				Name:         "failEarly",
 				Label:        "Fail early",
@@ -139,9 +242,111 @@ func (m *AlertRuleStateCheckAction) Describe() action_kit_api.ActionDescription
 				DefaultValue: new("true"),
 				Advanced:     new(true),
 				Required:     new(false),
-				Order:        new(4),
+				Order:        new(7),
 			},
-		},
+			{
+				Name:        "labelMatchers",
+				Label:       "Alert Instance Label Matchers",
+				Description: new("Only check the alert instances matching these label matchers, e.g. namespace=\"shop\",pod=~\"checkout-.*\". The rule is considered firing if a matching instance fires, pending if a matching instance is pending, and inactive otherwise."),
+				Type:        action_kit_api.ActionParameterTypeString,
+				Advanced:    new(true),
+				Required:    new(false),
+				Order:       new(8),
+			},
+			{
+				Name:        "maxTimeToPending",
+				Label:       "Max Time to Pending",
+				Description: new("Fail if the rule doesn't become pending within this time after the start of the step."),
+				Type:        action_kit_api.ActionParameterTypeDuration,
+				Advanced:    new(true),
+				Required:    new(false),
+				Order:       new(9),
+			},
+			{
+				Name:        "maxTimeToFiring",
+				Label:       "Max Time to Firing",
+				Description: new("Fail if the rule doesn't fire within this time after the start of the step."),
+				Type:        action_kit_api.ActionParameterTypeDuration,
+				Advanced:    new(true),
+				Required:    new(false),
+				Order:       new(10),
+			},
+			{
+				Name:        "maxTimeToResolve",
+				Label:       "Max Time to Resolve",
+				Description: new("Fail if the rule doesn't resolve after firing within this time after the start of the step."),
+				Type:        action_kit_api.ActionParameterTypeDuration,
+				Advanced:    new(true),
+				Required:    new(false),
+				Order:       new(11),
+			},
+			{
+				Name:         "aggregation",
+				Label:        "Aggregation",
+				Description:  new("How the expected states of the selected alert rules are evaluated: each rule on its own, or the selection as a whole, e.g. at least 1 of the selected rules fires. Evaluating the selection as a whole requires a single replica of the extension."),
+				Type:         action_kit_api.ActionParameterTypeString,
+				DefaultValue: new(aggregationIndividual),
+				Options: new([]action_kit_api.ParameterOption{
+					action_kit_api.ExplicitParameterOption{
+						Label: "Each rule",
+						Value: aggregationIndividual,
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "Any rule",
+						Value: aggregationAny,
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "No rule",
+						Value: aggregationNone,
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "At least N rules",
+						Value: aggregationAtLeast,
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "At most N rules",
+						Value: aggregationAtMost,
+					},
+				}),
+				Advanced: new(true),
+				Required: new(false),
+				Order:    new(12),
+			},
+			{
+				Name:         "aggregationCount",
+				Label:        "Aggregation N",
+				Description:  new("The N of the 'At least N rules' and 'At most N rules' aggregations."),
+				Type:         action_kit_api.ActionParameterTypeInteger,
+				DefaultValue: new("1"),
+				Advanced:     new(true),
+				Required:     new(false),
+				Order:        new(13),
+			},
+			{
+				Name:         "unhealthyHandling",
+				Label:        "Error / No Data Handling",
+				Description:  new("How evaluations of the rule with health 'error' or 'nodata' are handled, e.g. because the datasource queried by the rule is attacked. Such rules keep reporting their last state."),
+				Type:         action_kit_api.ActionParameterTypeString,
+				DefaultValue: new(unhealthyIgnore),
+				Options: new([]action_kit_api.ParameterOption{
+					action_kit_api.ExplicitParameterOption{
+						Label: "Ignore the health",
+						Value: unhealthyIgnore,
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "Fail the check",
+						Value: unhealthyFailure,
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "Treat as firing",
+						Value: unhealthyFiring,
+					},
+				}),
+				Advanced: new(true),
+				Required: new(false),
+				Order:    new(14),
+			},
+		}, extgrafana.ApiErrorToleranceParameters("the alert rule", 15)...),
 		Widgets: new([]action_kit_api.Widget{
 			action_kit_api.StateOverTimeWidget{
 				Type:  action_kit_api.ComSteadybitWidgetStateOverTime,
@@ -179,7 +384,8 @@ func (m *AlertRuleStateCheckAction) Prepare(_ context.Context, state *AlertRuleC
 	}
 
 	duration := request.Config["duration"].(float64)
-	end := time.Now().Add(time.Millisecond * time.Duration(duration))
+	start := time.Now()
+	end := start.Add(time.Millisecond * time.Duration(duration))
 
 	var expectedState []string
 	if request.Config["expectedStateList"] != nil {
@@ -191,37 +397,115 @@ func (m *AlertRuleStateCheckAction) Prepare(_ context.Context, state *AlertRuleC
 		stateCheckMode = fmt.Sprintf("%v", request.Config["stateCheckMode"])
 	}
 
+	if request.Config["expectedStateSequence"] != nil {
+		state.ExpectedStateSequence = extutil.ToStringArray(request.Config["expectedStateSequence"])
+	}
+	if stateCheckMode == stateCheckModeSequence && len(state.ExpectedStateSequence) == 0 {
+		return nil, new(extension_kit.ToError("The 'Transition sequence' mode requires an expected state sequence.", nil))
+	}
+
 	// Default to failing early to preserve the previous behavior for experiments that don't set this parameter.
 	state.FailEarly = true
 	if request.Config["failEarly"] != nil {
 		state.FailEarly = extutil.ToBool(request.Config["failEarly"])
 	}
 
+	if request.Config["labelMatchers"] != nil {
+		state.LabelMatchers = fmt.Sprintf("%v", request.Config["labelMatchers"])
+		if _, err := extgrafana.ParseLabelMatchers(state.LabelMatchers); err != nil {
+			return nil, new(extension_kit.ToError(fmt.Sprintf("Invalid alert instance label matchers '%s'.", state.LabelMatchers), err))
+		}
+	}
+
+	state.ApiErrors = extgrafana.ParseApiErrorTolerance(request.Config)
+
+	state.UnhealthyHandling = unhealthyIgnore
+	if request.Config["unhealthyHandling"] != nil {
+		state.UnhealthyHandling = fmt.Sprintf("%v", request.Config["unhealthyHandling"])
+	}
+
+	if request.Config["aggregation"] != nil {
+		state.Aggregation = fmt.Sprintf("%v", request.Config["aggregation"])
+	}
+	if request.Config["aggregationCount"] != nil {
+		state.AggregationCount = extutil.ToInt(request.Config["aggregationCount"])
+	}
+
+	instance, err := extgrafana.FindInstance(Instances, extgrafana.FirstAttribute(request.Target.Attributes, "grafana.instance"), extgrafana.FirstAttribute(request.Target.Attributes, "grafana.host"))
+	if err != nil {
+		return nil, new(extension_kit.ToError("Failed to resolve the Grafana instance of the target.", err))
+	}
+
+	if orgId := extgrafana.FirstAttribute(request.Target.Attributes, "grafana.org.id"); orgId != "" {
+		state.OrgId, err = strconv.Atoi(orgId)
+		if err != nil {
+			return nil, new(extension_kit.ToError(fmt.Sprintf("Target has an invalid 'grafana.org.id' attribute '%s'.", orgId), err))
+		}
+	}
+
+	state.Instance = instance.Name
 	state.AlertRuleId = alertRuleId[0]
 	state.AlertRuleDatasource = request.Target.Attributes["grafana.alert-rule.datasource"][0]
 	state.AlertRuleName = request.Target.Attributes["grafana.alert-rule.name"][0]
+	state.AlertRuleUid = extgrafana.FirstAttribute(request.Target.Attributes, "grafana.alert-rule.uid")
+	state.AlertRuleFingerprint = extgrafana.FirstAttribute(request.Target.Attributes, "grafana.alert-rule.fingerprint")
+	state.AlertRuleGroup = extgrafana.FirstAttribute(request.Target.Attributes, "grafana.alert-rule.group")
+	state.AlertRuleFolder = extgrafana.FirstAttribute(request.Target.Attributes, "grafana.alert-rule.folder")
+	state.AlertRuleFolderUid = extgrafana.FirstAttribute(request.Target.Attributes, "grafana.alert-rule.folder-uid")
+	state.Start = start
 	state.End = end
+	state.MinStateDuration = durationParameter(request.Config, "minStateDuration")
+	state.MinStateDurationMode = minStateDurationContinuous
+	if request.Config["minStateDurationMode"] != nil {
+		state.MinStateDurationMode = fmt.Sprintf("%v", request.Config["minStateDurationMode"])
+	}
+	state.Latencies.MaxPendingAfter = durationParameter(request.Config, "maxTimeToPending")
+	state.Latencies.MaxFiringAfter = durationParameter(request.Config, "maxTimeToFiring")
+	state.Latencies.MaxResolvedAfter = durationParameter(request.Config, "maxTimeToResolve")
 	state.ExpectedState = expectedState
 	state.StateCheckMode = stateCheckMode
 
+	if state.Aggregation != "" && state.Aggregation != aggregationIndividual {
+		if len(expectedState) == 0 || stateCheckMode == stateCheckModeSequence {
+			return nil, new(extension_kit.ToError("Aggregating the selected alert rules requires an expected state list and the 'All the time' or 'At least once' mode.", nil))
+		}
+		var executionId *int
+		if request.ExecutionContext != nil {
+			executionId = request.ExecutionContext.ExecutionId
+		}
+		state.AggregationKey = joinAggregation(aggregationSignature(executionId, request.Config), state.AlertRuleId, state.AlertRuleName, start, end)
+	}
+
 	return nil, nil
 }
 
 func (m *AlertRuleStateCheckAction) Start(ctx context.Context, state *AlertRuleCheckState) (*action_kit_api.StartResult, error) {
-	statusResult, err := AlertRuleCheckStatus(ctx, state, RestyClient)
+	statusResult, err := m.Status(ctx, state)
 	if statusResult == nil {
 		return nil, err
 	}
 	return &action_kit_api.StartResult{
-		Artifacts: statusResult.Artifacts,
-		Error:     statusResult.Error,
-		Messages:  statusResult.Messages,
-		Metrics:   statusResult.Metrics,
+		Error:    statusResult.Error,
+		Messages: statusResult.Messages,
+		Metrics:  statusResult.Metrics,
 	}, err
 }
 
 func (m *AlertRuleStateCheckAction) Status(ctx context.Context, state *AlertRuleCheckState) (*action_kit_api.StatusResult, error) {
-	return AlertRuleCheckStatus(ctx, state, RestyClient)
+	instance, err := extgrafana.FindInstance(Instances, state.Instance, "")
+	if err != nil {
+		return nil, extension_kit.ToError("Failed to resolve the Grafana instance of the target.", err)
+	}
+	return AlertRuleCheckStatus(ctx, state, instance.Client)
+}
+
+// Stop attaches the timeline of the rule. Stop is called however the step ends - completed, failed, errored
+// or canceled - so the timeline is archived on every path.
+func (m *AlertRuleStateCheckAction) Stop(_ context.Context, state *AlertRuleCheckState) (*action_kit_api.StopResult, error) {
+	if len(state.Timeline) == 0 {
+		return nil, nil
+	}
+	return &action_kit_api.StopResult{Artifacts: timelineArtifacts(state)}, nil
 }
 
 func AlertRuleCheckStatus(ctx context.Context, state *AlertRuleCheckState, client *resty.Client) (*action_kit_api.StatusResult, error) {
@@ -229,13 +513,31 @@ func AlertRuleCheckStatus(ctx context.Context, state *AlertRuleCheckState, clien
 
 	alertRule, err := getAlertState(ctx, state, client)
 	if err != nil {
-		return nil, err
+		return tolerateUnavailable(state, err, client.BaseURL, now)
+	}
+	state.ApiErrors.Succeeded()
+	if state.LabelMatchers != "" {
+		matchers, err := extgrafana.ParseLabelMatchers(state.LabelMatchers)
+		if err != nil {
+			return nil, extension_kit.ToError(fmt.Sprintf("Invalid alert instance label matchers '%s'.", state.LabelMatchers), err)
+		}
+		alertRule = scopeToInstances(alertRule, matchers)
 	}
+	recordTransition(state, alertRule, now)
+	alertRule = treatUnhealthyAsFiring(state, alertRule)
+	if state.MinStateDuration > 0 {
+		trackStreak(&state.Streak, slices.Contains(state.ExpectedState, alertRule.State), now)
+	}
+	metrics := append([]action_kit_api.Metric{*toMetric(state, alertRule, client.BaseURL, now)}, trackLatencies(state, alertRule, now)...)
 
 	completed := now.After(state.End)
 	var checkError *action_kit_api.ActionKitError
 
-	if len(state.ExpectedState) > 0 {
+	if state.AggregationKey != "" {
+		checkError, completed = checkAggregation(state, slices.Contains(state.ExpectedState, alertRule.State), alertRule.Name, now)
+	} else if state.StateCheckMode == stateCheckModeSequence && len(state.ExpectedStateSequence) > 0 {
+		checkError = checkStateSequence(state, alertRule, completed)
+	} else if len(state.ExpectedState) > 0 {
 		if state.StateCheckMode == stateCheckModeAllTheTime {
 			if !slices.Contains(state.ExpectedState, alertRule.State) {
 				if state.FailEarly {
@@ -264,10 +566,22 @@ func AlertRuleCheckStatus(ctx context.Context, state *AlertRuleCheckState, clien
 				})
 			}
 		} else if state.StateCheckMode == stateCheckModeAtLeastOnce {
-			if slices.Contains(state.ExpectedState, alertRule.State) {
+			if state.MinStateDuration > 0 {
+				state.StateCheckSuccess = state.StateCheckSuccess || heldLongEnough(state)
+				if completed && !state.StateCheckSuccess {
+					checkError = new(action_kit_api.ActionKitError{
+						Title: fmt.Sprintf("AlertRule '%s' had status '%s' for %s whereas at least %s is expected.",
+							alertRule.Name,
+							state.ExpectedState,
+							describeStreak(state),
+							state.MinStateDuration),
+						Status: extutil.Ptr(action_kit_api.Failed),
+					})
+				}
+			} else if slices.Contains(state.ExpectedState, alertRule.State) {
 				state.StateCheckSuccess = true
 			}
-			if completed && !state.StateCheckSuccess {
+			if completed && !state.StateCheckSuccess && checkError == nil {
 				checkError = new(action_kit_api.ActionKitError{
 					Title: fmt.Sprintf("AlertRule '%s' didn't have status '%s' at least once.",
 						alertRule.Name,
@@ -278,51 +592,202 @@ func AlertRuleCheckStatus(ctx context.Context, state *AlertRuleCheckState, clien
 		}
 	}
 
+	if checkError == nil {
+		checkError = checkRuleHealth(state, alertRule, completed)
+	}
+	if checkError == nil {
+		checkError = checkLatencies(state, alertRule, now, completed)
+	}
+
 	return &action_kit_api.StatusResult{
 		Completed: completed,
 		Error:     checkError,
-		Metrics: &[]action_kit_api.Metric{
-			*toMetric(state.AlertRuleId, alertRule, now),
-		},
+		Metrics:   &metrics,
 	}, nil
 }
 
+// checkStateSequence advances through the expected state sequence. Once the first state of the sequence
+// is observed, every further state has to be the current or the next one of the sequence. States not
+// listed in the sequence may occur in between, e.g. pending between normal and firing of the sequence
+// normal → firing → normal.
+func checkStateSequence(state *AlertRuleCheckState, alertRule *AlertRule, completed bool) *action_kit_api.ActionKitError {
+	sequence := state.ExpectedStateSequence
+	index := state.SequenceIndex
+	switch {
+	case index < len(sequence) && alertRule.State == sequence[index]:
+		state.SequenceIndex++
+	case index == 0 || index == len(sequence) || state.SequenceError != "" || !slices.Contains(sequence, alertRule.State):
+		// states before the sequence started, after it completed, once it failed or not listed in it are not evaluated
+	case alertRule.State != sequence[index-1]:
+		state.SequenceError = fmt.Sprintf("AlertRule '%s' went to state '%s' after '%s' whereas '%s' is expected next in sequence '%s'. Observed transitions: %s.",
+			alertRule.Name, alertRule.State, sequence[index-1], sequence[index], strings.Join(sequence, " → "), observedTransitions(state))
+	}
+
+	if state.SequenceError != "" && (state.FailEarly || completed) {
+		return new(action_kit_api.ActionKitError{
+			Title:  state.SequenceError,
+			Status: extutil.Ptr(action_kit_api.Failed),
+		})
+	}
+	if completed && state.SequenceIndex < len(sequence) {
+		return new(action_kit_api.ActionKitError{
+			Title: fmt.Sprintf("AlertRule '%s' didn't go through the state sequence '%s'. Observed transitions: %s.",
+				alertRule.Name, strings.Join(sequence, " → "), observedTransitions(state)),
+			Status: extutil.Ptr(action_kit_api.Failed),
+		})
+	}
+	return nil
+}
+
+// observedTransitions lists the states recorded in the timeline, e.g. inactive → pending → firing.
+func observedTransitions(state *AlertRuleCheckState) string {
+	states := make([]string, 0, len(state.Timeline))
+	for _, transition := range state.Timeline {
+		if len(states) == 0 || states[len(states)-1] != transition.State {
+			states = append(states, transition.State)
+		}
+	}
+	return strings.Join(states, " → ")
+}
+
 func getAlertState(ctx context.Context, state *AlertRuleCheckState, client *resty.Client) (*AlertRule, error) {
-	var grafanaResponse AlertsStates
-	uri := fmt.Sprintf("/api/prometheus/%s/api/v1/rules", state.AlertRuleDatasource)
-	res, err := client.R().
-		SetContext(ctx).
-		SetResult(&grafanaResponse).
-		Get(uri)
+	uri := rulesPath(state.AlertRuleDatasource)
+	rules := rulesPolling.rules(ctx, state.Instance, client, state.OrgId, state.AlertRuleDatasource, rulesFilter(state), state.AlertRuleUid != "")
 
-	if err != nil {
-		return nil, extension_kit.ToError(fmt.Sprintf("Failed to retrieve alerts states from Grafana for Datasource %s with uri %s.", state.AlertRuleDatasource, uri), err)
+	if rules.err != nil {
+		return nil, &extgrafana.UnavailableError{Err: extension_kit.ToError(fmt.Sprintf("Failed to retrieve alerts states from Grafana for Datasource %s with uri %s.", state.AlertRuleDatasource, uri), rules.err)}
 	}
 
-	if !res.IsSuccess() {
+	if rules.statusCode == 404 {
 		return nil, &extension_kit.ExtensionError{
-			Title:  fmt.Sprintf("Grafana API responded with unexpected status code %d while retrieving alert rule states for Datasource %s", res.StatusCode(), state.AlertRuleDatasource),
-			Detail: new(fmt.Sprintf("Full response: %s", res.String())),
+			Title:  fmt.Sprintf("Datasource %s does not exist or does not support alert rules.", state.AlertRuleDatasource),
+			Detail: new(fmt.Sprintf("Supported datasource types: %s. Full response: %s", strings.Join(alertRuleDatasourceTypes(), ", "), rules.body)),
 		}
 	}
 
-	for _, alertGroup := range grafanaResponse.AlertsData.AlertsGroups {
-		if idx := slices.IndexFunc(alertGroup.AlertsRules, func(c AlertRule) bool { return c.Name == state.AlertRuleName }); idx != -1 {
-			return &alertGroup.AlertsRules[idx], nil
+	if rules.statusCode < 200 || rules.statusCode > 299 {
+		err := &extension_kit.ExtensionError{
+			Title:  fmt.Sprintf("Grafana API responded with unexpected status code %d while retrieving alert rule states for Datasource %s", rules.statusCode, state.AlertRuleDatasource),
+			Detail: new(fmt.Sprintf("Full response: %s", rules.body)),
+		}
+		if extgrafana.IsUnavailableStatus(rules.statusCode) {
+			return nil, &extgrafana.UnavailableError{Err: err}
+		}
+		return nil, err
+	}
+
+	for _, alertGroup := range rules.response.AlertsData.AlertsGroups {
+		if !isCheckedGroup(state, alertGroup) {
+			continue
+		}
+		if idx := slices.IndexFunc(alertGroup.AlertsRules, func(c AlertRule) bool { return isCheckedRule(state, c) }); idx != -1 {
+			alertRule := alertGroup.AlertsRules[idx]
+			return &alertRule, nil
 		}
 	}
 
 	return nil, &extension_kit.ExtensionError{
 		Title:  fmt.Sprintf("Failed to retrieve your alert rule %s from Grafana for Datasource %s.", state.AlertRuleName, state.AlertRuleDatasource),
-		Detail: new(fmt.Sprintf("Full response: %s", res.String())),
+		Detail: new(fmt.Sprintf("Full response: %s", rules.body)),
+	}
+}
+
+// rulesFilter narrows the rules request to the group of the checked rule. Grafana filters its own rules
+// by folder UID and group, and only by group if the folder UID is given as well. Prometheus compatible
+// rulers filter by namespace and group. Filters not supported by a version are ignored, so the response
+// is matched against group and folder regardless. Rules with a UID are not narrowed, as they are found
+// even when moved to another group. The filter does not name the rule, so that the request is shared
+// between all checks of rules of the same group, see rulesPolling.
+func rulesFilter(state *AlertRuleCheckState) url.Values {
+	filter := url.Values{}
+	if state.AlertRuleGroup == "" || state.AlertRuleUid != "" {
+		return filter
+	}
+	if state.AlertRuleDatasource == grafanaDatasource.UID {
+		if state.AlertRuleFolderUid != "" {
+			filter.Set("folder_uid", state.AlertRuleFolderUid)
+			filter.Set("rule_group", state.AlertRuleGroup)
+		}
+		return filter
 	}
+	filter.Set("rule_group[]", state.AlertRuleGroup)
+	if state.AlertRuleFolder != "" {
+		filter.Set("file[]", state.AlertRuleFolder)
+	}
+	return filter
+}
+
+// isCheckedGroup tells whether the group contains the checked rule. Grafana-managed rules are identified
+// by their UID, even when moved to another group.
+func isCheckedGroup(state *AlertRuleCheckState, alertGroup AlertGroup) bool {
+	if state.AlertRuleUid != "" {
+		return true
+	}
+	return (state.AlertRuleGroup == "" || alertGroup.Name == state.AlertRuleGroup) &&
+		(state.AlertRuleFolder == "" || alertGroup.File == state.AlertRuleFolder)
 }
 
-func toMetric(alertRuleID string, alertRule *AlertRule, now time.Time) *action_kit_api.Metric {
+// isCheckedRule tells whether the rule is the one the check was prepared for, by the identity the
+// discovery assigned to it.
+func isCheckedRule(state *AlertRuleCheckState, rule AlertRule) bool {
+	if state.AlertRuleUid != "" {
+		return rule.UID == state.AlertRuleUid
+	}
+	if rule.Name != state.AlertRuleName {
+		return false
+	}
+	return state.AlertRuleFingerprint == "" || ruleFingerprint(rule) == state.AlertRuleFingerprint
+}
+
+// scopeToInstances reduces the rule to its alert instances matching the label matchers. The state of the
+// reduced rule is the most severe state of these instances: firing if one of them fires, pending if one
+// of them is pending and inactive otherwise - or normal, if that is how the rule itself reports it.
+func scopeToInstances(alertRule *AlertRule, matchers []extgrafana.LabelMatcher) *AlertRule {
+	scoped := *alertRule
+	scoped.Alerts = make([]Alert, 0, len(alertRule.Alerts))
+	for _, alert := range alertRule.Alerts {
+		if extgrafana.MatchesLabels(matchers, alert.Labels) {
+			scoped.Alerts = append(scoped.Alerts, alert)
+		}
+	}
+
+	scoped.State = "inactive"
+	if alertRule.State == "normal" {
+		scoped.State = "normal"
+	}
+	for _, alert := range scoped.Alerts {
+		switch normalizeInstanceState(alert.State) {
+		case "firing":
+			scoped.State = "firing"
+		case "pending":
+			if scoped.State != "firing" {
+				scoped.State = "pending"
+			}
+		}
+	}
+	return &scoped
+}
+
+// normalizeInstanceState maps the instance states of Grafana-managed rules (Alerting, Pending, Normal,
+// NoData, Error) to the ones of Prometheus (firing, pending, inactive).
+func normalizeInstanceState(state string) string {
+	switch strings.ToLower(state) {
+	case "firing", "alerting":
+		return "firing"
+	case "pending":
+		return "pending"
+	}
+	return "inactive"
+}
+
+func toMetric(checkState *AlertRuleCheckState, alertRule *AlertRule, baseUrl string, now time.Time) *action_kit_api.Metric {
 	var tooltip string
 	var state string
 
 	tooltip = fmt.Sprintf("Alert rule state is: %s", alertRule.State)
+	if checkState.LabelMatchers != "" {
+		tooltip = fmt.Sprintf("Alert rule state of the %d instances matching %s is: %s", len(alertRule.Alerts), checkState.LabelMatchers, alertRule.State)
+	}
 	if alertRule.State == "normal" {
 		state = "success"
 	} else if alertRule.State == "pending" {
@@ -331,18 +796,49 @@ func toMetric(alertRuleID string, alertRule *AlertRule, now time.Time) *action_k
 		state = "success"
 	} else if alertRule.State == "firing" {
 		state = "danger"
+	} else if alertRule.State == "unknown" {
+		state = "unknown"
+	}
+	if isUnhealthy(alertRule.Health) {
+		tooltip += fmt.Sprintf("\nHealth: %s", alertRule.Health)
+		if checkState.UnhealthyHandling == unhealthyFailure {
+			state = "danger"
+		}
+	}
+	if alertRule.LastError != "" {
+		tooltip += fmt.Sprintf("\nLast error: %s", alertRule.LastError)
+	}
+	if checkState.MinStateDuration > 0 {
+		tooltip += fmt.Sprintf("\nExpected state held for %s", describeStreak(checkState))
 	}
 
 	return new(action_kit_api.Metric{
 		Name: new("grafana_alert_rule_state"),
 		Metric: map[string]string{
-			"grafana.alert-rule.id":   alertRuleID,
+			"grafana.alert-rule.id":   checkState.AlertRuleId,
 			"grafana.alert-rule.name": alertRule.Name,
 			"state":                   state,
 			"tooltip":                 tooltip,
-			"url":                     fmt.Sprintf("%s/alerting/list?search=%s", config.Config.ApiBaseUrl, url.QueryEscape(alertRule.Name)),
+			"url":                     alertListUrl(baseUrl, checkState.OrgId, alertRule.Name),
 		},
 		Timestamp: now,
 		Value:     0,
 	})
 }
+
+// alertListUrl links to the alert rule in Grafana's alert list, switching to the rule's organization.
+func alertListUrl(baseUrl string, orgId int, alertRuleName string) string {
+	listUrl := fmt.Sprintf("%s/alerting/list?search=%s", baseUrl, url.QueryEscape(alertRuleName))
+	if orgId > 0 {
+		listUrl += fmt.Sprintf("&orgId=%d", orgId)
+	}
+	return listUrl
+}
+
+// durationParameter reads an optional duration parameter, given in milliseconds.
+func durationParameter(config map[string]any, name string) time.Duration {
+	if value, ok := config[name].(float64); ok {
+		return time.Duration(value) * time.Millisecond
+	}
+	return 0
+}
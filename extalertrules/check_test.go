@@ -2,21 +2,26 @@ package extalertrules
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"github.com/go-resty/resty/v2"
 	"github.com/steadybit/action-kit/go/action_kit_api/v2"
 	"github.com/steadybit/extension-grafana/config"
+	"github.com/steadybit/extension-grafana/extgrafana"
 	"github.com/steadybit/extension-kit/extutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
 )
 
 func TestPrepareExtractsState(t *testing.T) {
+	resetState(t)
 	// Given
 	request := extutil.JsonMangle(action_kit_api.PrepareActionRequestBody{
 		Config: map[string]any{
@@ -37,6 +42,8 @@ func TestPrepareExtractsState(t *testing.T) {
 			ExecutionUri:  new("<uri-to-execution>"),
 		}),
 	})
+	Instances = []extgrafana.Instance{{Name: "default", BaseUrl: "http://grafana.local"}}
+	defer func() { Instances = nil }()
 	action := AlertRuleStateCheckAction{}
 	state := action.NewEmptyState()
 
@@ -46,6 +53,7 @@ func TestPrepareExtractsState(t *testing.T) {
 	// Then
 	require.Nil(t, result)
 	require.Nil(t, err)
+	require.Equal(t, "default", state.Instance) // targets without instance attribute resolve to the first instance
 	require.Equal(t, "prometheus-GoldenSignalsAlerts-test_firing", state.AlertRuleId)
 	//require.Equal(t, "prometheus", state.AlertRuleDatasource)
 	require.Equal(t, "test_firing", state.AlertRuleName)
@@ -64,17 +72,48 @@ func newTestClient(fn RoundTripperFunc) *resty.Client {
 	return resty.NewWithClient(&http.Client{Transport: fn})
 }
 
-func TestToMetric(t *testing.T) {
-	// override base URL
-	config.Config.ApiBaseUrl = "http://grafana.local"
+func TestPrepareResolvesInstanceOfTarget(t *testing.T) {
+	resetState(t)
+	Instances = []extgrafana.Instance{
+		{Name: "prod", BaseUrl: "http://grafana-prod.local"},
+		{Name: "staging", BaseUrl: "http://grafana-staging.local"},
+	}
+	defer func() { Instances = nil }()
+	action := AlertRuleStateCheckAction{}
+
+	prepare := func(attributes map[string][]string) (AlertRuleCheckState, error) {
+		state := action.NewEmptyState()
+		attributes["grafana.alert-rule.id"] = []string{"id"}
+		attributes["grafana.alert-rule.datasource"] = []string{"grafana"}
+		attributes["grafana.alert-rule.name"] = []string{"rule"}
+		_, err := action.Prepare(context.TODO(), &state, extutil.JsonMangle(action_kit_api.PrepareActionRequestBody{
+			Config: map[string]any{"duration": 1000},
+			Target: &action_kit_api.Target{Attributes: attributes},
+		}))
+		return state, err
+	}
+
+	state, err := prepare(map[string][]string{"grafana.instance": {"staging"}})
+	require.NoError(t, err)
+	assert.Equal(t, "staging", state.Instance)
+
+	// targets discovered before multiple instances were supported only carry the host
+	state, err = prepare(map[string][]string{"grafana.host": {"grafana-staging.local"}})
+	require.NoError(t, err)
+	assert.Equal(t, "staging", state.Instance)
+
+	_, err = prepare(map[string][]string{"grafana.instance": {"unknown"}})
+	assert.Error(t, err)
+}
 
+func TestToMetric(t *testing.T) {
 	now := time.Date(2025, 5, 20, 12, 0, 0, 0, time.UTC)
 	alert := &AlertRule{
 		Name:  "my-rule",
 		State: "normal",
 	}
 
-	m := toMetric("rule-id", alert, now)
+	m := toMetric(&AlertRuleCheckState{AlertRuleId: "rule-id"}, alert, "http://grafana.local", now)
 	metric := m.Metric
 
 	assert.Equal(t, "grafana_alert_rule_state", *m.Name)
@@ -82,9 +121,39 @@ func TestToMetric(t *testing.T) {
 	assert.Equal(t, "Alert rule state is: normal", metric["tooltip"])
 	assert.True(t, strings.HasPrefix(metric["url"], "http://grafana.local/alerting/list"), "url should start with base URL")
 	assert.Equal(t, now, m.Timestamp)
+
+	m = toMetric(&AlertRuleCheckState{AlertRuleId: "rule-id", OrgId: 2}, alert, "http://grafana.local", now)
+	assert.Equal(t, "http://grafana.local/alerting/list?search=my-rule&orgId=2", m.Metric["url"])
+}
+
+func TestAlertRuleCheckStatus_QueriesOrganizationOfTarget(t *testing.T) {
+	resetState(t)
+	body := `{"data":{"groups":[{"rules":[{"name":"r1","state":"normal"}]}]}}`
+	var orgHeader string
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		orgHeader = req.Header.Get("X-Grafana-Org-Id")
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+
+	state := &AlertRuleCheckState{
+		OrgId:               3,
+		AlertRuleDatasource: "DS1",
+		AlertRuleName:       "r1",
+		AlertRuleId:         "id1",
+		End:                 time.Now().Add(1 * time.Minute),
+	}
+
+	_, err := AlertRuleCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.Equal(t, "3", orgHeader)
 }
 
 func TestAlertRuleCheckStatus_Success_NoExpected(t *testing.T) {
+	resetState(t)
 	// stub Grafana API returning one group with our rule
 	body := `{"data":{"groups":[{"rules":[{"name":"r1","state":"firing"}]}]}}`
 	client := newTestClient(func(req *http.Request) (*http.Response, error) {
@@ -112,6 +181,7 @@ func TestAlertRuleCheckStatus_Success_NoExpected(t *testing.T) {
 }
 
 func TestAlertRuleCheckStatus_MissingRule(t *testing.T) {
+	resetState(t)
 	body := `{"data":{"groups":[{"rules":[{"name":"other","state":"pending"}]}]}}`
 	client := newTestClient(func(req *http.Request) (*http.Response, error) {
 		return &http.Response{
@@ -134,6 +204,7 @@ func TestAlertRuleCheckStatus_MissingRule(t *testing.T) {
 }
 
 func TestAlertRuleCheckStatus_HTTPError(t *testing.T) {
+	resetState(t)
 	client := newTestClient(func(req *http.Request) (*http.Response, error) {
 		return nil, errors.New("network down")
 	})
@@ -151,6 +222,7 @@ func TestAlertRuleCheckStatus_HTTPError(t *testing.T) {
 }
 
 func TestAlertRuleCheckStatus_AllTheTimeMode_Mismatch(t *testing.T) {
+	resetState(t)
 	body := `{"data":{"groups":[{"rules":[{"name":"r2","state":"firing"}]}]}}`
 	client := newTestClient(func(req *http.Request) (*http.Response, error) {
 		return &http.Response{
@@ -190,6 +262,7 @@ func newFiringClient() *resty.Client {
 }
 
 func TestAlertRuleCheckStatus_AllTheTime_FailEarly(t *testing.T) {
+	resetState(t)
 	client := newFiringClient()
 	state := &AlertRuleCheckState{
 		AlertRuleDatasource: "DS1",
@@ -209,6 +282,7 @@ func TestAlertRuleCheckStatus_AllTheTime_FailEarly(t *testing.T) {
 }
 
 func TestAlertRuleCheckStatus_AllTheTime_FailAtEnd(t *testing.T) {
+	resetState(t)
 	client := newFiringClient()
 	state := &AlertRuleCheckState{
 		AlertRuleDatasource: "DS1",
@@ -237,6 +311,7 @@ func TestAlertRuleCheckStatus_AllTheTime_FailAtEnd(t *testing.T) {
 }
 
 func TestAlertRuleCheckStatus_AllTheTime_FailAtEnd_NoDeviation(t *testing.T) {
+	resetState(t)
 	body := `{"data":{"groups":[{"rules":[{"name":"r","state":"normal"}]}]}}`
 	client := newTestClient(func(req *http.Request) (*http.Response, error) {
 		return &http.Response{
@@ -263,6 +338,7 @@ func TestAlertRuleCheckStatus_AllTheTime_FailAtEnd_NoDeviation(t *testing.T) {
 }
 
 func TestAlertRuleCheckStatus_AtLeastOnceMode(t *testing.T) {
+	resetState(t)
 	body := `{"data":{"groups":[{"rules":[{"name":"r3","state":"pending"}]}]}}`
 	client := newTestClient(func(req *http.Request) (*http.Response, error) {
 		return &http.Response{
@@ -289,6 +365,7 @@ func TestAlertRuleCheckStatus_AtLeastOnceMode(t *testing.T) {
 }
 
 func TestAlertRuleCheckStatus_AtLeastOnceMode_NoMatch(t *testing.T) {
+	resetState(t)
 	body := `{"data":{"groups":[{"rules":[{"name":"r3","state":"firing"}]}]}}`
 	client := newTestClient(func(req *http.Request) (*http.Response, error) {
 		return &http.Response{
@@ -313,3 +390,732 @@ func TestAlertRuleCheckStatus_AtLeastOnceMode_NoMatch(t *testing.T) {
 	assert.NotNil(t, res.Error)
 	assert.Contains(t, res.Error.Title, "didn't have status")
 }
+
+func TestAlertRuleCheckStatus_ResolvesRuleByIdentity(t *testing.T) {
+	resetState(t)
+	// both rules share their name, only the identity assigned by the discovery tells them apart
+	body := `{"data":{"groups":[{"name":"g","rules":[
+		{"uid":"uid-1","name":"r","state":"firing","query":"up == 0"},
+		{"uid":"uid-2","name":"r","state":"normal","query":"up < 1"}
+	]}]}}`
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+
+	byUid := &AlertRuleCheckState{AlertRuleDatasource: "grafana", AlertRuleName: "r", AlertRuleUid: "uid-2", End: time.Now().Add(time.Minute)}
+	res, err := AlertRuleCheckStatus(context.Background(), byUid, client)
+	require.NoError(t, err)
+	assert.Equal(t, "success", (*res.Metrics)[0].Metric["state"])
+
+	byFingerprint := &AlertRuleCheckState{AlertRuleDatasource: "prom", AlertRuleName: "r", AlertRuleFingerprint: ruleFingerprint(AlertRule{Query: "up < 1"}), End: time.Now().Add(time.Minute)}
+	res, err = AlertRuleCheckStatus(context.Background(), byFingerprint, client)
+	require.NoError(t, err)
+	assert.Equal(t, "success", (*res.Metrics)[0].Metric["state"])
+}
+
+func TestAlertRuleCheckStatus_ScopesToMatchingInstances(t *testing.T) {
+	resetState(t)
+	body := `{"data":{"groups":[{"rules":[{"name":"r","state":"firing","alerts":[
+		{"labels":{"namespace":"shop","pod":"checkout-1"},"state":"Normal"},
+		{"labels":{"namespace":"shop","pod":"checkout-2"},"state":"Pending"},
+		{"labels":{"namespace":"shop","pod":"cart-1"},"state":"Alerting"},
+		{"labels":{"namespace":"other","pod":"checkout-1"},"state":"firing"}
+	]}]}]}}`
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+	state := &AlertRuleCheckState{
+		AlertRuleDatasource: "DS1",
+		AlertRuleName:       "r",
+		AlertRuleId:         "id",
+		ExpectedState:       []string{"pending"},
+		StateCheckMode:      stateCheckModeAllTheTime,
+		FailEarly:           true,
+		LabelMatchers:       `namespace="shop",pod=~"checkout-.*"`,
+		End:                 time.Now().Add(1 * time.Minute),
+	}
+
+	res, err := AlertRuleCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.Nil(t, res.Error, "firing instances not matching are ignored")
+	metric := (*res.Metrics)[0]
+	assert.Equal(t, "warn", metric.Metric["state"])
+	assert.Contains(t, metric.Metric["tooltip"], "2 instances matching")
+
+	state.LabelMatchers = `namespace="shop",pod="checkout-1"`
+	res, err = AlertRuleCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	require.NotNil(t, res.Error)
+	assert.Contains(t, res.Error.Title, "has state 'inactive' whereas")
+}
+
+func TestPrepareRejectsInvalidLabelMatchers(t *testing.T) {
+	resetState(t)
+	request := extutil.JsonMangle(action_kit_api.PrepareActionRequestBody{
+		Config: map[string]any{
+			"duration":      1000,
+			"labelMatchers": `pod=~"("`,
+		},
+		Target: &action_kit_api.Target{
+			Attributes: map[string][]string{
+				"grafana.alert-rule.id":         {"id"},
+				"grafana.alert-rule.datasource": {"prometheus"},
+				"grafana.alert-rule.name":       {"r"},
+			},
+		},
+	})
+	Instances = []extgrafana.Instance{{Name: "default", BaseUrl: "http://grafana.local"}}
+	defer func() { Instances = nil }()
+	action := AlertRuleStateCheckAction{}
+	state := action.NewEmptyState()
+
+	_, err := action.Prepare(context.TODO(), &state, request)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid alert instance label matchers")
+}
+
+func TestAlertRuleCheck_AttachesTimelineWhenStopped(t *testing.T) {
+	resetState(t)
+	responses := []string{
+		`{"data":{"groups":[{"rules":[{"name":"r/1","state":"inactive","health":"ok"}]}]}}`,
+		`{"data":{"groups":[{"rules":[{"name":"r/1","state":"inactive","health":"ok"}]}]}}`,
+		`{"data":{"groups":[{"rules":[{"name":"r/1","state":"firing","health":"ok","alerts":[{"state":"firing"},{"state":"pending"}]}]}]}}`,
+		`{"data":{"groups":[{"rules":[{"name":"r/1","state":"inactive","health":"error","lastError":"query timed out"}]}]}}`,
+	}
+	call := 0
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if call == len(responses) {
+			return &http.Response{StatusCode: 503, Body: io.NopCloser(strings.NewReader(`unavailable`))}, nil
+		}
+		body := responses[call]
+		call++
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+	state := &AlertRuleCheckState{
+		AlertRuleDatasource: "DS1",
+		AlertRuleName:       "r/1",
+		AlertRuleId:         "id",
+		End:                 time.Now().Add(1 * time.Minute),
+	}
+
+	for range 4 {
+		res, err := AlertRuleCheckStatus(context.Background(), state, client)
+		require.NoError(t, err)
+		assert.Nil(t, res.Artifacts, "artifacts are only attached when the step is stopped")
+	}
+	_, err := AlertRuleCheckStatus(context.Background(), state, client)
+	require.Error(t, err, "the tolerance of API errors is exceeded")
+	res, err := (&AlertRuleStateCheckAction{}).Stop(context.Background(), state)
+	require.NoError(t, err)
+
+	require.Len(t, state.Timeline, 3, "unchanged states are not recorded")
+	assert.Equal(t, 2, state.Timeline[1].Instances)
+	assert.Equal(t, 1, state.Timeline[1].FiringInstances)
+	assert.Equal(t, 1, state.Timeline[1].PendingInstances)
+	assert.Equal(t, "query timed out", state.Timeline[2].Error)
+
+	require.NotNil(t, res.Artifacts)
+	require.Len(t, *res.Artifacts, 2)
+	jsonArtifact, csvArtifact := (*res.Artifacts)[0], (*res.Artifacts)[1]
+	assert.Equal(t, "alert-rule-timeline-r_1.json", jsonArtifact.Label)
+	assert.Equal(t, "alert-rule-timeline-r_1.csv", csvArtifact.Label)
+
+	data, err := base64.StdEncoding.DecodeString(jsonArtifact.Data)
+	require.NoError(t, err)
+	var timeline []StateTransition
+	require.NoError(t, json.Unmarshal(data, &timeline))
+	assert.Equal(t, []string{"inactive", "firing", "inactive"}, []string{timeline[0].State, timeline[1].State, timeline[2].State})
+
+	data, err = base64.StdEncoding.DecodeString(csvArtifact.Data)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, "timestamp,state,health,instances,firingInstances,pendingInstances,error", lines[0])
+	assert.True(t, strings.HasSuffix(lines[3], ",inactive,error,0,0,0,query timed out"))
+}
+
+func newSequenceClient(states ...string) *resty.Client {
+	call := 0
+	return newTestClient(func(req *http.Request) (*http.Response, error) {
+		body := `{"data":{"groups":[{"rules":[{"name":"r","state":"` + states[min(call, len(states)-1)] + `"}]}]}}`
+		call++
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+}
+
+func newSequenceState(failEarly bool) *AlertRuleCheckState {
+	return &AlertRuleCheckState{
+		AlertRuleDatasource:   "DS1",
+		AlertRuleName:         "r",
+		AlertRuleId:           "id",
+		StateCheckMode:        stateCheckModeSequence,
+		ExpectedStateSequence: []string{"pending", "firing", "inactive"},
+		FailEarly:             failEarly,
+		End:                   time.Now().Add(1 * time.Minute),
+	}
+}
+
+func TestAlertRuleCheckStatus_TransitionSequence(t *testing.T) {
+	resetState(t)
+	client := newSequenceClient("inactive", "pending", "pending", "firing", "inactive", "firing")
+	state := newSequenceState(true)
+
+	for range 5 {
+		res, err := AlertRuleCheckStatus(context.Background(), state, client)
+		require.NoError(t, err)
+		assert.Nil(t, res.Error)
+	}
+	state.End = time.Now().Add(-1 * time.Second)
+	res, err := AlertRuleCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.Nil(t, res.Error, "states after the completed sequence are not evaluated")
+	assert.Equal(t, 3, state.SequenceIndex)
+}
+
+func TestAlertRuleCheckStatus_TransitionSequence_OutOfOrder(t *testing.T) {
+	resetState(t)
+	client := newSequenceClient("inactive", "pending", "inactive")
+	state := newSequenceState(true)
+
+	for range 2 {
+		res, err := AlertRuleCheckStatus(context.Background(), state, client)
+		require.NoError(t, err)
+		assert.Nil(t, res.Error)
+	}
+	res, err := AlertRuleCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	require.NotNil(t, res.Error)
+	assert.Contains(t, res.Error.Title, "went to state 'inactive' after 'pending' whereas 'firing' is expected next")
+	assert.Contains(t, res.Error.Title, "Observed transitions: inactive → pending → inactive.")
+}
+
+func TestAlertRuleCheckStatus_TransitionSequence_IgnoresUnlistedStates(t *testing.T) {
+	resetState(t)
+	client := newSequenceClient("normal", "pending", "firing", "normal")
+	state := newSequenceState(true)
+	state.ExpectedStateSequence = []string{"normal", "firing", "normal"}
+
+	for range 3 {
+		res, err := AlertRuleCheckStatus(context.Background(), state, client)
+		require.NoError(t, err)
+		assert.Nil(t, res.Error, "pending isn't part of the sequence")
+	}
+	state.End = time.Now().Add(-1 * time.Second)
+	res, err := AlertRuleCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.Nil(t, res.Error)
+	assert.Equal(t, 3, state.SequenceIndex)
+}
+
+func TestAlertRuleCheckStatus_TransitionSequence_Incomplete(t *testing.T) {
+	resetState(t)
+	client := newSequenceClient("inactive", "pending")
+	state := newSequenceState(false)
+
+	res, err := AlertRuleCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.Nil(t, res.Error)
+	state.End = time.Now().Add(-1 * time.Second)
+	res, err = AlertRuleCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	require.NotNil(t, res.Error)
+	assert.Contains(t, res.Error.Title, "didn't go through the state sequence 'pending → firing → inactive'. Observed transitions: inactive → pending.")
+}
+
+func TestAlertRuleCheckStatus_PublishesLatencies(t *testing.T) {
+	resetState(t)
+	client := newSequenceClient("inactive", "pending", "firing", "inactive")
+	start := time.Now().Add(-10 * time.Second)
+	state := &AlertRuleCheckState{
+		AlertRuleDatasource: "DS1",
+		AlertRuleName:       "r",
+		AlertRuleId:         "id",
+		Start:               start,
+		End:                 time.Now().Add(1 * time.Minute),
+	}
+
+	metricNames := func(res *action_kit_api.StatusResult) []string {
+		names := make([]string, 0)
+		for _, metric := range *res.Metrics {
+			names = append(names, *metric.Name)
+		}
+		return names
+	}
+	res, err := AlertRuleCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"grafana_alert_rule_state"}, metricNames(res))
+	res, err = AlertRuleCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"grafana_alert_rule_state", "grafana_alert_rule_time_to_pending_seconds"}, metricNames(res))
+	assert.GreaterOrEqual(t, (*res.Metrics)[1].Value, 10.0)
+	res, err = AlertRuleCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"grafana_alert_rule_state", "grafana_alert_rule_time_to_firing_seconds"}, metricNames(res))
+	res, err = AlertRuleCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"grafana_alert_rule_state", "grafana_alert_rule_time_to_resolve_seconds"}, metricNames(res))
+
+	assert.Greater(t, state.Latencies.PendingAfter, 10*time.Second)
+	assert.GreaterOrEqual(t, state.Latencies.FiringAfter, state.Latencies.PendingAfter)
+	assert.GreaterOrEqual(t, state.Latencies.ResolvedAfter, state.Latencies.FiringAfter)
+}
+
+func TestAlertRuleCheckStatus_FailsOnExceededLatency(t *testing.T) {
+	resetState(t)
+	state := &AlertRuleCheckState{
+		AlertRuleDatasource: "DS1",
+		AlertRuleName:       "r",
+		AlertRuleId:         "id",
+		FailEarly:           true,
+		Start:               time.Now().Add(-10 * time.Second),
+		End:                 time.Now().Add(1 * time.Minute),
+		Latencies:           AlertLatencies{MaxFiringAfter: 5 * time.Second},
+	}
+
+	res, err := AlertRuleCheckStatus(context.Background(), state, newSequenceClient("pending"))
+	require.NoError(t, err)
+	require.NotNil(t, res.Error, "limit passed without firing")
+	assert.Equal(t, "AlertRule 'r' didn't fire within 5s.", res.Error.Title)
+
+	state.Latencies = AlertLatencies{MaxFiringAfter: 5 * time.Second}
+	state.FailEarly = false
+	res, err = AlertRuleCheckStatus(context.Background(), state, newSequenceClient("firing"))
+	require.NoError(t, err)
+	assert.Nil(t, res.Error, "only reported at the end of the step")
+	state.End = time.Now().Add(-1 * time.Second)
+	res, err = AlertRuleCheckStatus(context.Background(), state, newSequenceClient("firing"))
+	require.NoError(t, err)
+	require.NotNil(t, res.Error)
+	assert.Contains(t, res.Error.Title, "to fire whereas at most 5s is expected.")
+}
+
+func TestAlertRuleCheck_AggregatesSelectedRules(t *testing.T) {
+	resetState(t)
+	Instances = []extgrafana.Instance{{Name: "default", BaseUrl: "http://grafana.local"}}
+	defer func() { Instances = nil }()
+	prepare := func(ruleName string, aggregation string, count int) *AlertRuleCheckState {
+		request := extutil.JsonMangle(action_kit_api.PrepareActionRequestBody{
+			Config: map[string]any{
+				"duration":          1000 * 60,
+				"expectedStateList": []string{"firing"},
+				"stateCheckMode":    stateCheckModeAtLeastOnce,
+				"failEarly":         true,
+				"aggregation":       aggregation,
+				"aggregationCount":  count,
+			},
+			Target: &action_kit_api.Target{
+				Attributes: map[string][]string{
+					"grafana.alert-rule.id":         {"id-" + ruleName},
+					"grafana.alert-rule.datasource": {"DS1"},
+					"grafana.alert-rule.name":       {ruleName},
+				},
+			},
+			ExecutionContext: new(action_kit_api.ExecutionContext{ExecutionId: new(4711)}),
+		})
+		action := AlertRuleStateCheckAction{}
+		state := action.NewEmptyState()
+		_, err := action.Prepare(context.TODO(), &state, request)
+		require.NoError(t, err)
+		return &state
+	}
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		body := `{"data":{"groups":[{"rules":[{"name":"r1","state":"firing"},{"name":"r2","state":"inactive"},{"name":"r3","state":"firing"}]}]}}`
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+
+	// at least 2 of 3 fire: only reported at the end of the step, by the first rule of the selection
+	states := []*AlertRuleCheckState{prepare("r1", aggregationAtLeast, 2), prepare("r2", aggregationAtLeast, 2), prepare("r3", aggregationAtLeast, 2)}
+	for _, state := range states {
+		state.End = time.Now().Add(-1 * time.Second)
+	}
+	res, err := AlertRuleCheckStatus(context.Background(), states[0], client)
+	require.NoError(t, err)
+	assert.False(t, res.Completed, "the first rule waits for the others to complete")
+	for _, state := range []*AlertRuleCheckState{states[1], states[2], states[0]} {
+		res, err = AlertRuleCheckStatus(context.Background(), state, client)
+		require.NoError(t, err)
+		assert.Nil(t, res.Error, "r2 is not firing, but the selection is evaluated as a whole")
+		assert.True(t, res.Completed)
+	}
+
+	// at most 1 of 3 fires: fails once for the whole selection
+	states = []*AlertRuleCheckState{prepare("r1", aggregationAtMost, 1), prepare("r2", aggregationAtMost, 1), prepare("r3", aggregationAtMost, 1)}
+	var errs []*action_kit_api.ActionKitError
+	for range 2 {
+		for _, state := range states {
+			res, err := AlertRuleCheckStatus(context.Background(), state, client)
+			require.NoError(t, err)
+			if res.Error != nil {
+				errs = append(errs, res.Error)
+			}
+		}
+	}
+	require.Len(t, errs, 1, "the outcome is reported by the leader only, which fails early")
+	assert.Equal(t, "2 of 3 selected alert rules had state '[firing]' at least once whereas at most 1 are expected (r1, r3).", errs[0].Title)
+}
+
+func TestAlertRuleCheck_AggregatesSelectedRulesAllTheTime(t *testing.T) {
+	resetState(t)
+	Instances = []extgrafana.Instance{{Name: "default", BaseUrl: "http://grafana.local"}}
+	defer func() { Instances = nil }()
+	prepare := func(ruleName string, count int) *AlertRuleCheckState {
+		request := extutil.JsonMangle(action_kit_api.PrepareActionRequestBody{
+			Config: map[string]any{
+				"duration":          1000 * 60,
+				"expectedStateList": []string{"firing"},
+				"stateCheckMode":    stateCheckModeAllTheTime,
+				"failEarly":         true,
+				"aggregation":       aggregationAtLeast,
+				"aggregationCount":  count,
+			},
+			Target: &action_kit_api.Target{
+				Attributes: map[string][]string{
+					"grafana.alert-rule.id":         {"id-" + ruleName},
+					"grafana.alert-rule.datasource": {"DS1"},
+					"grafana.alert-rule.name":       {ruleName},
+				},
+			},
+			ExecutionContext: new(action_kit_api.ExecutionContext{ExecutionId: new(4712)}),
+		})
+		action := AlertRuleStateCheckAction{}
+		state := action.NewEmptyState()
+		_, err := action.Prepare(context.TODO(), &state, request)
+		require.NoError(t, err)
+		return &state
+	}
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		body := `{"data":{"groups":[{"rules":[{"name":"r1","state":"firing"},{"name":"r2","state":"inactive"},{"name":"r3","state":"firing"}]}]}}`
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+	poll := func(states []*AlertRuleCheckState) []*action_kit_api.ActionKitError {
+		var errs []*action_kit_api.ActionKitError
+		for _, state := range states {
+			res, err := AlertRuleCheckStatus(context.Background(), state, client)
+			require.NoError(t, err)
+			if res.Error != nil {
+				errs = append(errs, res.Error)
+			}
+		}
+		return errs
+	}
+
+	// at least 2 of 3 fire at the same time: the leader polls first, before the others reported
+	states := []*AlertRuleCheckState{prepare("r1", 2), prepare("r2", 2), prepare("r3", 2)}
+	assert.Empty(t, poll(states), "the minimum is not missed while the others didn't report yet")
+	assert.Empty(t, poll([]*AlertRuleCheckState{states[1], states[0], states[2]}))
+	for _, state := range states {
+		state.End = time.Now().Add(-1 * time.Second)
+	}
+	assert.Empty(t, poll([]*AlertRuleCheckState{states[1], states[2], states[0]}))
+
+	// at least 3 of 3 fire at the same time: missed as soon as all checks reported, before the end of the step
+	states = []*AlertRuleCheckState{prepare("r1", 3), prepare("r2", 3), prepare("r3", 3)}
+	assert.Empty(t, poll(states))
+	errs := poll(states)
+	require.Len(t, errs, 1, "the outcome is reported by the leader only, which fails early")
+	assert.Equal(t, "2 of 3 selected alert rules had state '[firing]' at the same time whereas at least 3 are expected (r1, r3).", errs[0].Title)
+}
+
+func TestCheckAggregation_ErrorsForUnknownGroup(t *testing.T) {
+	resetState(t)
+	state := &AlertRuleCheckState{
+		AlertRuleId:    "id-r1",
+		ExpectedState:  []string{"firing"},
+		StateCheckMode: stateCheckModeAllTheTime,
+		Aggregation:    aggregationAny,
+		AggregationKey: "4714/{}#1",
+		End:            time.Now().Add(time.Minute),
+	}
+
+	checkError, completed := checkAggregation(state, true, "r1", time.Now())
+	require.NotNil(t, checkError, "the group was joined on another replica or before a restart")
+	assert.Equal(t, action_kit_api.Errored, *checkError.Status)
+	assert.True(t, completed)
+}
+
+func TestJoinAggregation_SeparatesSteps(t *testing.T) {
+	resetState(t)
+	start := time.Now()
+	end := start.Add(time.Minute)
+
+	first := joinAggregation("4713/{}", "id-r1", "r1", start, end)
+	assert.Equal(t, first, joinAggregation("4713/{}", "id-r2", "r2", start.Add(time.Second), end), "checks of one step join one group")
+	assert.NotEqual(t, first, joinAggregation("4713/{}", "id-r1", "r1", start.Add(time.Second), end), "a parallel step selecting the same rule")
+	assert.NotEqual(t, first, joinAggregation("4713/{}", "id-r3", "r3", start.Add(time.Minute), end), "a later step")
+
+	reportAggregation(first, "id-r2", "r2", true, true)
+	completeAggregation(first)
+	aggregations.Lock()
+	_, ok := aggregations.groups[first]
+	aggregations.Unlock()
+	assert.True(t, ok, "the group is kept until all checks completed")
+	reportAggregation(first, "id-r1", "r1", true, true)
+	aggregations.Lock()
+	_, ok = aggregations.groups[first]
+	aggregations.Unlock()
+	assert.False(t, ok, "completed groups are removed")
+}
+
+func TestAlertRuleCheckStatus_HandlesUnhealthyRules(t *testing.T) {
+	resetState(t)
+	body := `{"data":{"groups":[{"rules":[{"name":"r","state":"inactive","health":"error","lastError":"connection refused"}]}]}}`
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+	newState := func(handling string) *AlertRuleCheckState {
+		return &AlertRuleCheckState{
+			AlertRuleDatasource: "DS1",
+			AlertRuleName:       "r",
+			AlertRuleId:         "id",
+			ExpectedState:       []string{"inactive"},
+			StateCheckMode:      stateCheckModeAllTheTime,
+			FailEarly:           true,
+			UnhealthyHandling:   handling,
+			End:                 time.Now().Add(1 * time.Minute),
+		}
+	}
+
+	res, err := AlertRuleCheckStatus(context.Background(), newState(unhealthyIgnore), client)
+	require.NoError(t, err)
+	assert.Nil(t, res.Error)
+	assert.Equal(t, "success", (*res.Metrics)[0].Metric["state"])
+	assert.Equal(t, "Alert rule state is: inactive\nHealth: error\nLast error: connection refused", (*res.Metrics)[0].Metric["tooltip"])
+
+	res, err = AlertRuleCheckStatus(context.Background(), newState(unhealthyFailure), client)
+	require.NoError(t, err)
+	require.NotNil(t, res.Error)
+	assert.Equal(t, "AlertRule 'r' has health 'error': connection refused", res.Error.Title)
+	assert.Equal(t, "danger", (*res.Metrics)[0].Metric["state"])
+
+	res, err = AlertRuleCheckStatus(context.Background(), newState(unhealthyFiring), client)
+	require.NoError(t, err)
+	require.NotNil(t, res.Error)
+	assert.Equal(t, "AlertRule 'r' has state 'firing' whereas '[inactive]' is expected.", res.Error.Title)
+
+	// unless failing early, the failure is reported at the end of the step
+	state := newState(unhealthyFailure)
+	state.FailEarly = false
+	res, err = AlertRuleCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.Nil(t, res.Error)
+	state.End = time.Now().Add(-1 * time.Second)
+	res, err = AlertRuleCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	require.NotNil(t, res.Error)
+	assert.Equal(t, "AlertRule 'r' has health 'error': connection refused", res.Error.Title)
+}
+
+func TestAlertRuleCheckStatus_ResolvesRuleByGroupAndFolder(t *testing.T) {
+	resetState(t)
+	body := `{"data":{"groups":[
+		{"name":"api","file":"shop","rules":[{"name":"HighErrorRate","state":"inactive"}]},
+		{"name":"checkout","file":"shop","rules":[{"name":"HighErrorRate","state":"firing"}]},
+		{"name":"checkout","file":"payments","rules":[{"name":"HighErrorRate","state":"pending"}]}
+	]}}`
+	var queries []url.Values
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		queries = append(queries, req.URL.Query())
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+	state := &AlertRuleCheckState{
+		AlertRuleDatasource: "DS1",
+		AlertRuleName:       "HighErrorRate",
+		AlertRuleId:         "id",
+		AlertRuleGroup:      "checkout",
+		AlertRuleFolder:     "shop",
+		End:                 time.Now().Add(1 * time.Minute),
+	}
+
+	res, err := AlertRuleCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.Equal(t, "danger", (*res.Metrics)[0].Metric["state"], "the rule of the checkout group of the shop namespace fires")
+	assert.Equal(t, url.Values{"rule_group[]": {"checkout"}, "file[]": {"shop"}}, queries[0])
+
+	// Grafana only filters its own rules by group for a given folder
+	state.AlertRuleDatasource = "grafana"
+	_, _ = AlertRuleCheckStatus(context.Background(), state, client)
+	assert.Empty(t, queries[1])
+	state.AlertRuleFolderUid = "shop-uid"
+	_, _ = AlertRuleCheckStatus(context.Background(), state, client)
+	assert.Equal(t, url.Values{"folder_uid": {"shop-uid"}, "rule_group": {"checkout"}}, queries[2])
+
+	// shared requests are narrowed to the group, and shared between the checks of the rules of that group
+	config.Config.RulesPollingFreshness = time.Minute
+	defer func() { config.Config.RulesPollingFreshness = 0 }()
+	state.AlertRuleDatasource = "DS2"
+	_, _ = AlertRuleCheckStatus(context.Background(), state, client)
+	assert.Equal(t, url.Values{"rule_group[]": {"checkout"}, "file[]": {"shop"}}, queries[3])
+	other := *state
+	other.AlertRuleName = "HighLatency"
+	other.AlertRuleId = "id-2"
+	_, _ = AlertRuleCheckStatus(context.Background(), &other, client)
+	state.AlertRuleGroup = "api"
+	_, _ = AlertRuleCheckStatus(context.Background(), state, client)
+	require.Len(t, queries, 5)
+	assert.Equal(t, url.Values{"rule_group[]": {"api"}, "file[]": {"shop"}}, queries[4])
+}
+
+func TestAlertRuleCheckStatus_FindsRuleMovedToAnotherGroup(t *testing.T) {
+	resetState(t)
+	var queries []url.Values
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		queries = append(queries, req.URL.Query())
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(`{"data":{"groups":[{"name":"payments","file":"shop","rules":[{"uid":"uid-1","name":"HighErrorRate","state":"firing"}]}]}}`)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+	state := &AlertRuleCheckState{
+		AlertRuleDatasource: "grafana",
+		AlertRuleName:       "HighErrorRate",
+		AlertRuleUid:        "uid-1",
+		AlertRuleGroup:      "checkout",
+		AlertRuleFolder:     "shop",
+		AlertRuleFolderUid:  "shop-uid",
+		End:                 time.Now().Add(time.Minute),
+	}
+
+	res, err := AlertRuleCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.Equal(t, "danger", (*res.Metrics)[0].Metric["state"])
+	assert.Empty(t, queries[0], "the request of a rule with a UID is not narrowed to the group it was discovered in")
+}
+
+func TestAlertRuleCheckStatus_FallsBackToUnfilteredRequests(t *testing.T) {
+	resetState(t)
+	var queries []string
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		queries = append(queries, req.URL.RawQuery)
+		if req.URL.RawQuery != "" {
+			return &http.Response{StatusCode: 400, Body: io.NopCloser(strings.NewReader(`unknown parameter`))}, nil
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(`{"data":{"groups":[{"name":"g","rules":[{"name":"r","state":"firing"}]}]}}`)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+	state := &AlertRuleCheckState{AlertRuleDatasource: "DS1", AlertRuleName: "r", AlertRuleId: "id", AlertRuleGroup: "g", End: time.Now().Add(1 * time.Minute)}
+
+	for range 2 {
+		res, err := AlertRuleCheckStatus(context.Background(), state, client)
+		require.NoError(t, err)
+		assert.Equal(t, "danger", (*res.Metrics)[0].Metric["state"])
+	}
+	assert.Len(t, queries, 3, "the filter is not sent again once rejected")
+	assert.Empty(t, queries[2])
+}
+
+func TestAlertRuleCheckStatus_ToleratesTransientApiErrors(t *testing.T) {
+	resetState(t)
+	statusCodes := []int{502, 200, 502, 502, 502}
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		statusCode := statusCodes[0]
+		statusCodes = statusCodes[1:]
+		return &http.Response{
+			StatusCode: statusCode,
+			Body:       io.NopCloser(strings.NewReader(`{"data":{"groups":[{"rules":[{"name":"r","state":"inactive"}]}]}}`)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+	state := &AlertRuleCheckState{
+		AlertRuleDatasource: "DS1",
+		AlertRuleName:       "r",
+		AlertRuleId:         "id",
+		ExpectedState:       []string{"inactive"},
+		StateCheckMode:      stateCheckModeAllTheTime,
+		ApiErrors:           extgrafana.ApiErrorTolerance{MaxConsecutive: 2},
+		End:                 time.Now().Add(-1 * time.Second),
+	}
+
+	res, err := AlertRuleCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.False(t, res.Completed, "the outcome can't be evaluated without the state of the rule")
+	assert.Equal(t, "unknown", (*res.Metrics)[0].Metric["state"])
+	assert.Contains(t, (*res.Metrics)[0].Metric["tooltip"], "1 of 1 polls failed")
+
+	res, err = AlertRuleCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.True(t, res.Completed)
+	assert.Nil(t, res.Error)
+
+	// the third failure in a row exceeds the tolerance
+	state.End = time.Now().Add(1 * time.Minute)
+	for range 2 {
+		_, err = AlertRuleCheckStatus(context.Background(), state, client)
+		require.NoError(t, err)
+	}
+	_, err = AlertRuleCheckStatus(context.Background(), state, client)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unexpected status code 502")
+}
+
+func TestTrackStreak(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	streak := StateStreak{}
+	for i, matching := range []bool{true, true, true, false, true, true, false} {
+		trackStreak(&streak, matching, start.Add(time.Duration(i)*time.Minute))
+	}
+	assert.Equal(t, 2*time.Minute, streak.Longest)
+	assert.Equal(t, 3*time.Minute, streak.Cumulative)
+
+	state := &AlertRuleCheckState{MinStateDuration: 3 * time.Minute, MinStateDurationMode: minStateDurationContinuous, Streak: streak}
+	assert.False(t, heldLongEnough(state))
+	state.MinStateDurationMode = minStateDurationCumulative
+	assert.True(t, heldLongEnough(state))
+}
+
+func TestAlertRuleCheckStatus_AtLeastOnceMode_MinStateDuration(t *testing.T) {
+	resetState(t)
+	state := &AlertRuleCheckState{
+		AlertRuleDatasource:  "DS1",
+		AlertRuleName:        "r",
+		AlertRuleId:          "id",
+		ExpectedState:        []string{"firing"},
+		StateCheckMode:       stateCheckModeAtLeastOnce,
+		MinStateDuration:     2 * time.Minute,
+		MinStateDurationMode: minStateDurationContinuous,
+		Streak:               StateStreak{Longest: 30 * time.Second},
+		End:                  time.Now().Add(-1 * time.Second),
+	}
+
+	res, err := AlertRuleCheckStatus(context.Background(), state, newFiringClient())
+	require.NoError(t, err)
+	require.NotNil(t, res.Error, "a single firing poll does not satisfy the minimum duration")
+	assert.Equal(t, "AlertRule 'r' had status '[firing]' for 30s continuously whereas at least 2m0s is expected.", res.Error.Title)
+	assert.Contains(t, (*res.Metrics)[0].Metric["tooltip"], "Expected state held for 30s continuously")
+}
@@ -7,13 +7,19 @@
 
 package extalertrules
 
-import "github.com/go-resty/resty/v2"
+import "github.com/steadybit/extension-grafana/extgrafana"
 
-var RestyClient *resty.Client
+// Instances are the Grafana instances alert rules are discovered from and checked against.
+var Instances []extgrafana.Instance
 
 const (
 	TargetType                = "com.steadybit.extension_grafana.alert-rule"
+	AlertInstanceTargetType   = "com.steadybit.extension_grafana.alert-instance"
 	targetIcon                = "data:image/svg+xml,%3Csvg%20width%3D%2224%22%20height%3D%2224%22%20viewBox%3D%220%200%2024%2024%22%20fill%3D%22none%22%20xmlns%3D%22http%3A%2F%2Fwww.w3.org%2F2000%2Fsvg%22%3E%0A%3Cpath%20fill-rule%3D%22evenodd%22%20clip-rule%3D%22evenodd%22%20d%3D%22M12%202C11.1614%202%2010.4433%202.51616%2010.1461%203.24812C7.17983%204.06072%205%206.77579%205%2010V14.6972L3.16795%2017.4453C2.96338%2017.7522%202.94431%2018.1467%203.11833%2018.4719C3.29235%2018.797%203.63121%2019%204%2019H8.53544C8.77806%2020.6961%2010.2368%2022%2012%2022C13.7632%2022%2015.2219%2020.6961%2015.4646%2019H20C20.3688%2019%2020.7077%2018.797%2020.8817%2018.4719C21.0557%2018.1467%2021.0366%2017.7522%2020.832%2017.4453L19%2014.6972V10C19%206.77579%2016.8202%204.06072%2013.8539%203.24812C13.5567%202.51616%2012.8386%202%2012%202ZM12%2020C11.3469%2020%2010.7913%2019.5826%2010.5854%2019H13.4146C13.2087%2019.5826%2012.6531%2020%2012%2020ZM16.7943%2010.7842C16.7962%2010.8002%2016.7981%2010.8159%2016.8%2010.8314L16.7557%2010.9069C16.7668%2011.0578%2016.7668%2011.1873%2016.7668%2011.2951C16.7668%2011.3382%2016.7335%2011.3814%2016.6892%2011.3814C16.671%2011.3902%2016.6603%2011.3845%2016.6447%2011.3762C16.6414%2011.3744%2016.6378%2011.3725%2016.6339%2011.3706C16.6117%2011.3598%2016.6007%2011.3382%2016.6007%2011.3167C16.5785%2011.2088%2016.5453%2011.0902%2016.501%2010.9608C16.4862%2010.9105%2016.4616%2010.8505%2016.437%2010.7906C16.4247%2010.7607%2016.4124%2010.7307%2016.4013%2010.702C16.3976%2010.6948%2016.3927%2010.6876%2016.3878%2010.6804C16.3779%2010.666%2016.3681%2010.6516%2016.3681%2010.6373L16.3349%2010.5725C16.3238%2010.5402%2016.3016%2010.4971%2016.3016%2010.4971L16.2795%2010.4647L16.2574%2010.4324C16.1577%2010.2167%2016.0248%2010.0118%2015.8808%209.82843C15.8033%209.73137%2015.7147%209.62353%2015.6261%209.52647C15.6034%209.51173%2015.5859%209.49195%2015.57%209.47403C15.5626%209.46572%2015.5556%209.45781%2015.5486%209.45098C15.5335%209.42887%2015.5132%209.4118%2015.4948%209.39632C15.4862%209.38915%2015.4781%209.38232%2015.4711%209.37549C15.4559%209.35338%2015.4356%209.33631%2015.4172%209.32083C15.4087%209.31366%2015.4006%209.30683%2015.3936%209.3C15.3714%209.28921%2015.3603%209.27843%2015.3493%209.26765C15.3271%209.25686%2015.316%209.24608%2015.305%209.23529C15.0835%209.05196%2014.8288%208.87941%2014.5409%208.73922C14.2529%208.59902%2013.9428%208.49118%2013.6106%208.42647C13.5706%208.42127%2013.5306%208.41545%2013.4904%208.4096C13.3638%208.39119%2013.2357%208.37255%2013.1012%208.37255H12.8354H12.769H12.7358H12.6915H12.6139H12.5918H12.5807H12.5475H12.5032H12.4257H12.3482H12.2817L12.2485%208.38333H12.2153C12.1931%208.39412%2012.171%208.39412%2012.1488%208.39412C12.1267%208.4049%2012.1045%208.4049%2012.0824%208.4049C12.0602%208.41569%2012.0381%208.41569%2012.0159%208.41569L11.883%208.44804C11.8609%208.45882%2011.8387%208.46961%2011.8166%208.46961C11.7945%208.48039%2011.7723%208.49118%2011.7502%208.49118C11.6837%208.51274%2011.6271%208.53431%2011.5705%208.55588C11.5422%208.56667%2011.5139%208.57745%2011.4844%208.58823C11.465%208.6008%2011.4419%208.60971%2011.4172%208.61922C11.3995%208.62603%2011.381%208.63315%2011.3626%208.64216C11.3404%208.65294%2011.321%208.66372%2011.3017%208.67451C11.2823%208.68529%2011.2629%208.69608%2011.2407%208.70686L11.2407%208.70688C11.1632%208.75001%2011.0857%208.79314%2011.0082%208.84706C10.9694%208.87402%2010.9334%208.90098%2010.8974%208.92794C10.8615%208.9549%2010.8255%208.98186%2010.7867%209.00882C10.7092%209.06274%2010.6427%209.12745%2010.5763%209.19216C10.3105%209.45098%2010.078%209.78529%209.91184%2010.152C9.83432%2010.3353%209.7568%2010.5294%209.70143%2010.7343C9.6682%2010.8422%209.64606%2010.9392%209.62391%2011.0471C9.62071%2011.0626%209.61751%2011.078%209.61435%2011.0931C9.5956%2011.1831%209.57801%2011.2675%209.56854%2011.3598C9.55746%2011.4676%209.54639%2011.5755%209.54639%2011.6725V11.7696V11.9422V11.9853C9.55746%2012.1902%209.59069%2012.3843%209.64606%2012.5892C9.70143%2012.7941%209.77895%2012.9882%209.86754%2013.1716C9.95613%2013.3549%2010.0669%2013.5382%2010.1998%2013.7C10.4655%2014.0235%2010.7978%2014.2931%2011.1632%2014.498C11.3515%2014.5951%2011.5508%2014.6814%2011.7502%2014.7353C11.9495%2014.7892%2012.1599%2014.8324%2012.3703%2014.8431H12.5253H12.6804C12.7801%2014.8431%2012.8797%2014.8324%2012.9794%2014.8108C13.1787%2014.7784%2013.367%2014.7245%2013.5442%2014.6382C13.9096%2014.4765%2014.2197%2014.2176%2014.4523%2013.8941C14.5741%2013.7324%2014.6627%2013.5598%2014.7402%2013.3765C14.7734%2013.2902%2014.8066%2013.1931%2014.8288%2013.0961C14.832%2013.0835%2014.8362%2013.07%2014.8405%2013.0561C14.8509%2013.0224%2014.862%2012.9864%2014.862%2012.9559C14.8731%2012.9127%2014.8842%2012.8588%2014.8842%2012.8157C14.8952%2012.7618%2014.8952%2012.7078%2014.8952%2012.6647V12.5892V12.4598V12.4274V12.3951C14.8952%2012.3666%2014.8921%2012.3412%2014.8892%2012.3171C14.8866%2012.2956%2014.8842%2012.2753%2014.8842%2012.2549C14.8509%2012.0824%2014.7956%2011.9098%2014.718%2011.748C14.5519%2011.4353%2014.2972%2011.1657%2013.9871%2010.9931C13.8321%2010.9069%2013.666%2010.8422%2013.4999%2010.8098C13.4909%2010.8076%2013.4821%2010.8054%2013.4733%2010.8033C13.3955%2010.7841%2013.3248%2010.7667%2013.2452%2010.7667H13.1234H13.0015C12.924%2010.7775%2012.8465%2010.7882%2012.769%2010.8098C12.6915%2010.8314%2012.6139%2010.8637%2012.5475%2010.8961C12.4811%2010.9284%2012.4146%2010.9716%2012.3482%2011.0147L12.3482%2011.0147C12.2928%2011.0578%2012.2263%2011.1118%2012.171%2011.1657C11.9495%2011.3814%2011.8055%2011.6618%2011.7502%2011.9529C11.7391%2011.9853%2011.7391%2012.0284%2011.7391%2012.0608V12.0931V12.1147V12.1686C11.7391%2012.201%2011.7418%2012.236%2011.7446%2012.2711C11.7474%2012.3061%2011.7502%2012.3412%2011.7502%2012.3735C11.7723%2012.5137%2011.8166%2012.6324%2011.883%2012.751C11.9384%2012.8696%2012.027%2012.9667%2012.1156%2013.0529C12.2042%2013.1392%2012.3039%2013.2039%2012.4146%2013.2578C12.5253%2013.3118%2012.6361%2013.3441%2012.7468%2013.3549H12.7911H12.8133H12.8354H12.8797H12.9572H13.0015H13.0791C13.1178%2013.3549%2013.1511%2013.3444%2013.1828%2013.3343C13.1964%2013.33%2013.2097%2013.3258%2013.223%2013.3225C13.2673%2013.3118%2013.3559%2013.2686%2013.3559%2013.2686L13.3891%2013.2471C13.4445%2013.2255%2013.4999%2013.2363%2013.5331%2013.2794C13.5663%2013.3333%2013.5552%2013.398%2013.511%2013.4412C13.4999%2013.4466%2013.4916%2013.4547%2013.4846%2013.4614C13.4777%2013.4681%2013.4722%2013.4735%2013.4667%2013.4735C13.4268%2013.4891%2013.3926%2013.5102%2013.356%2013.5329C13.3417%2013.5417%2013.3271%2013.5507%2013.3116%2013.5598C13.2752%2013.5864%2013.2239%2013.6057%2013.1761%2013.6237C13.1657%2013.6276%2013.1554%2013.6314%2013.1455%2013.6353C13.1414%2013.6373%2013.1369%2013.6397%2013.1321%2013.6422C13.111%2013.6534%2013.0839%2013.6676%2013.0569%2013.6676C13.0458%2013.6784%2013.0348%2013.6784%2013.0126%2013.6784H13.0126H12.9572H12.9351H12.924H12.9129H12.8686H12.8465H12.769C12.625%2013.6784%2012.4811%2013.6569%2012.326%2013.6137C12.182%2013.5598%2012.027%2013.4951%2011.883%2013.398C11.7391%2013.301%2011.6062%2013.1716%2011.4954%2013.0206C11.3847%2012.8696%2011.2961%2012.6863%2011.2407%2012.4922C11.2355%2012.4693%2011.2297%2012.4465%2011.2238%2012.4235C11.2048%2012.3488%2011.1854%2012.2727%2011.1854%2012.1902V12.1147V12.0284V11.8667C11.1964%2011.651%2011.2407%2011.4353%2011.3183%2011.2304C11.3958%2011.0147%2011.5176%2010.8098%2011.6616%2010.6373C11.8166%2010.4539%2012.0049%2010.2922%2012.2153%2010.1627C12.4368%2010.0333%2012.6804%209.93627%2012.9351%209.89314C13.0015%209.87157%2013.068%209.86078%2013.1344%209.86078H13.1898H13.3338H13.3338C13.4667%209.86078%2013.5885%209.86078%2013.7214%209.88235C13.9761%209.9147%2014.2308%209.9902%2014.4855%2010.098C14.7402%2010.2167%2014.9727%2010.3676%2015.1832%2010.551C15.4046%2010.7343%2015.5929%2010.9608%2015.7369%2011.2088C15.8808%2011.4569%2016.0026%2011.7373%2016.0691%2012.0284C16.0912%2012.1039%2016.1023%2012.1794%2016.1134%2012.2549L16.1134%2012.2549L16.1245%2012.3088V12.3627V12.4167V12.4706V12.5353V12.6971V12.9235V13.0529H16.1355C16.2241%2013.1176%2016.6007%2013.452%2016.7114%2014.1314C16.7114%2014.1314%2016.2574%2014.5735%2015.604%2014.5412L15.5597%2014.6167C15.3936%2014.8647%2015.1942%2015.1127%2014.9617%2015.3176C14.8509%2015.4255%2014.7402%2015.5118%2014.6184%2015.598V15.652C14.6184%2015.7814%2014.5851%2016.3961%2014.0093%2017C14.0093%2017%2013.2119%2016.9029%2012.7468%2016.2451H12.5918H12.3592C12.0602%2016.2235%2011.7502%2016.1804%2011.4512%2016.1049C11.3515%2016.0833%2011.2518%2016.051%2011.1522%2016.0186L11.1521%2016.0186C11.0193%2016.1265%2010.377%2016.5902%209.40242%2016.5578C9.40242%2016.5578%209.03698%2015.7922%209.35813%2014.8755C9.28061%2014.8%209.20309%2014.7137%209.13664%2014.6274C8.97053%2014.4225%208.82657%2014.1961%208.69368%2013.9696C8.69368%2013.9696%207.67485%2013.9049%206.79999%2012.8912C6.79999%2012.8912%207.11007%2011.8235%208.16211%2011.2951C8.16211%2011.2735%208.16488%2011.252%208.16765%2011.2304C8.17042%2011.2088%208.17319%2011.1873%208.17319%2011.1657C8.21748%2010.8745%208.27286%2010.5941%208.36145%2010.3137C8.37252%2010.276%208.38637%2010.2382%208.40021%2010.2005C8.41405%2010.1627%208.42789%2010.125%208.43897%2010.0873C8.32823%209.94706%207.78559%209.18137%207.87418%207.96274C7.87418%207.96274%208.87086%207.43431%2010.0115%207.88725H10.0447C10.1555%207.81176%2010.2662%207.73627%2010.388%207.67157C10.5098%207.60686%2010.6317%207.54216%2010.7535%207.48824C10.7867%207.47745%2010.8172%207.46397%2010.8476%207.45049C10.8781%207.43701%2010.9085%207.42353%2010.9417%207.41274C10.975%207.40196%2011.0054%207.39118%2011.0359%207.38039C11.0663%207.36961%2011.0968%207.35882%2011.13%207.34804C11.1521%207.34265%2011.1743%207.33456%2011.1964%207.32647C11.2186%207.31838%2011.2407%207.31029%2011.2629%207.3049V7.26176C11.2629%207.26176%2011.4179%206.52843%2012.2374%206C12.2374%206%2012.9683%206.3451%2013.223%207.16471H13.2784C13.3153%207.1719%2013.3522%207.17789%2013.3891%207.18388C13.463%207.19586%2013.5368%207.20784%2013.6106%207.22941C13.7003%207.24689%2013.7828%207.27144%2013.8698%207.29734C13.8901%207.30341%2013.9108%207.30955%2013.9318%207.31569C14.0425%207.34804%2014.1422%207.38039%2014.2418%207.42353C14.2492%207.42712%2014.2566%207.43192%2014.264%207.43671C14.2788%207.4463%2014.2935%207.45588%2014.3083%207.45588C14.4412%207.35882%2014.8177%207.14314%2015.4046%207.17549C15.4046%207.17549%2015.7479%207.70392%2015.5929%208.31863C15.6253%208.3537%2015.6577%208.38763%2015.6898%208.42117C15.7562%208.49074%2015.821%208.5586%2015.8808%208.63137C16.0802%208.87941%2016.2574%209.14902%2016.4013%209.4402C16.5231%209.67745%2016.6228%209.93627%2016.6892%2010.1951C16.7501%2010.4123%2016.7738%2010.6114%2016.7943%2010.7842Z%22%20fill%3D%22%231D2632%22%2F%3E%0A%3C%2Fsvg%3E%0A"
 	stateCheckModeAtLeastOnce = "atLeastOnce"
 	stateCheckModeAllTheTime  = "allTheTime"
+	stateCheckModeSequence    = "transitionSequence"
+
+	alertInstancesSourceRules        = "rules"
+	alertInstancesSourceAlertmanager = "alertmanager"
 )
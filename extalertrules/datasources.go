@@ -0,0 +1,111 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extalertrules
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/extension-grafana/config"
+	"github.com/steadybit/extension-grafana/extgrafana"
+)
+
+// defaultAlertRuleDatasourceTypes are the plugin type ids of datasources which can manage alert rules in
+// their ruler, see https://grafana.com/docs/grafana/latest/alerting/fundamentals/alert-rules/#data-source-managed-alert-rules.
+// Mimir and Cortex are usually connected through the prometheus plugin. Amazon Managed Service for
+// Prometheus and Azure Monitor managed service for Prometheus have plugins of their own.
+var defaultAlertRuleDatasourceTypes = []string{
+	"prometheus",
+	"loki",
+	"grafana-amazonprometheus-datasource",
+	"grafana-azureprometheus-datasource",
+}
+
+// rulerProbes remembers whether a datasource of a type not known to support alert rules answered the
+// rules endpoint, keyed by instance name, organization and datasource uid.
+var rulerProbes sync.Map
+
+// alertRuleDatasourceTypes returns the built-in datasource types supporting alert rules, extended by
+// the configured ones.
+func alertRuleDatasourceTypes() []string {
+	return append(slices.Clone(defaultAlertRuleDatasourceTypes), config.Config.AlertRuleDatasourceTypes...)
+}
+
+// isAlertRuleCompatible tells whether the datasource is of a type which supports alert rules.
+func isAlertRuleCompatible(ds DataSource) bool {
+	return slices.Contains(alertRuleDatasourceTypes(), ds.Type)
+}
+
+// rulesPath is the Prometheus compatible rules endpoint of a datasource, or of the Grafana-managed
+// rules for grafanaDatasource.
+func rulesPath(datasourceUid string) string {
+	return fmt.Sprintf("/api/prometheus/%s/api/v1/rules", datasourceUid)
+}
+
+// mayHaveAlertRules tells whether the datasource supports alert rules or is to be probed for them, without
+// requesting it.
+func mayHaveAlertRules(ds DataSource) bool {
+	return isAlertRuleCompatible(ds) || config.Config.DiscoveryProbeRuler
+}
+
+// supportsAlertRules tells whether the alert rules of a datasource should be discovered. Datasources of
+// other types are probed through their rules endpoint, if enabled. The outcome of a probe is
+// remembered, unless the datasource could not be reached.
+func supportsAlertRules(ctx context.Context, instance extgrafana.Instance, org extgrafana.Organization, ds DataSource) bool {
+	if isAlertRuleCompatible(ds) {
+		return true
+	}
+	if !config.Config.DiscoveryProbeRuler {
+		return false
+	}
+
+	key := fmt.Sprintf("%s/%d/%s", instance.Name, org.ID, ds.UID)
+	if supported, ok := rulerProbes.Load(key); ok {
+		return supported.(bool)
+	}
+	supported, ok := probeRuler(ctx, instance.Client, org, ds)
+	if ok {
+		rulerProbes.Store(key, supported)
+	}
+	return supported
+}
+
+// probeRuler requests the rules endpoint of the datasource. The second result is false if the probe
+// did not come to a conclusion, e.g. because of a timeout or a server error.
+func probeRuler(ctx context.Context, client *resty.Client, org extgrafana.Organization, ds DataSource) (bool, bool) {
+	res, err := extgrafana.SetOrganization(client.R(), org.ID).
+		SetContext(ctx).
+		Get(rulesPath(ds.UID))
+	if err != nil {
+		log.Debug().Err(err).Msgf("Failed to probe the ruler of datasource %s.", ds.Name)
+		return false, false
+	}
+	if res.StatusCode() >= 500 {
+		log.Debug().Msgf("Failed to probe the ruler of datasource %s, status code %d.", ds.Name, res.StatusCode())
+		return false, false
+	}
+
+	supported := res.StatusCode() == 200
+	log.Info().Msgf("Probed the ruler of datasource %s of type %s, alert rules supported: %t.", ds.Name, ds.Type, supported)
+	return supported, true
+}
+
+// isDatasourceHealthy tells whether the alert rules of a datasource should be discovered, by the health
+// shared with the datasource discovery. Datasources configured to skip the health check are always
+// considered healthy, their rules endpoint decides instead.
+func isDatasourceHealthy(ctx context.Context, instance extgrafana.Instance, org extgrafana.Organization, ds DataSource) bool {
+	if extgrafana.SkipsHealthCheck(ds) {
+		return true
+	}
+	health := extgrafana.CachedDataSourceHealth(ctx, instance, org, ds)
+	return health != nil && health.Healthy
+}
@@ -9,8 +9,14 @@ package extalertrules
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"net/url"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-resty/resty/v2"
@@ -19,10 +25,12 @@ import (
 	"github.com/steadybit/discovery-kit/go/discovery_kit_commons"
 	"github.com/steadybit/discovery-kit/go/discovery_kit_sdk"
 	"github.com/steadybit/extension-grafana/config"
+	"github.com/steadybit/extension-grafana/extgrafana"
 	"github.com/steadybit/extension-kit/extbuild"
 )
 
 type alertDiscovery struct {
+	lastTargets *extgrafana.LastTargetsByInstance
 }
 
 var (
@@ -31,13 +39,17 @@ var (
 )
 
 func NewAlertDiscovery() discovery_kit_sdk.TargetDiscovery {
-	discovery := &alertDiscovery{}
+	discovery := newAlertDiscovery()
 	return discovery_kit_sdk.NewCachedTargetDiscovery(discovery,
 		discovery_kit_sdk.WithRefreshTargetsNow(),
 		discovery_kit_sdk.WithRefreshTargetsInterval(context.Background(), 1*time.Minute),
 	)
 }
 
+func newAlertDiscovery() *alertDiscovery {
+	return &alertDiscovery{lastTargets: extgrafana.NewLastTargetsByInstance()}
+}
+
 func (d *alertDiscovery) Describe() discovery_kit_api.DiscoveryDescription {
 	return discovery_kit_api.DiscoveryDescription{
 		Id: TargetType,
@@ -59,6 +71,8 @@ func (d *alertDiscovery) DescribeTarget() discovery_kit_api.TargetDescription {
 				{Attribute: "grafana.alert-rule.name"},
 				{Attribute: "grafana.alert-rule.group"},
 				{Attribute: "grafana.alert-rule.datasource"},
+				{Attribute: "grafana.instance"},
+				{Attribute: "grafana.alert-rule.annotation.runbook_url"},
 			},
 			OrderBy: []discovery_kit_api.OrderBy{
 				{
@@ -90,107 +104,501 @@ func (d *alertDiscovery) DescribeAttributes() []discovery_kit_api.AttributeDescr
 				One:   "Grafana datasource",
 				Other: "Grafana datasources",
 			},
+		}, {
+			Attribute: "grafana.alert-rule.folder",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Grafana folder",
+				Other: "Grafana folders",
+			},
+		}, {
+			Attribute: "grafana.alert-rule.uid",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Alert rule UID",
+				Other: "Alert rule UIDs",
+			},
+		}, {
+			Attribute: "grafana.instance",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Grafana instance",
+				Other: "Grafana instances",
+			},
+		}, {
+			Attribute: "grafana.org.id",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Grafana organization id",
+				Other: "Grafana organization ids",
+			},
+		}, {
+			Attribute: "grafana.org.name",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Grafana organization",
+				Other: "Grafana organizations",
+			},
+		}, {
+			Attribute: "grafana.alert-rule.annotation.summary",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Summary",
+				Other: "Summaries",
+			},
+		}, {
+			Attribute: "grafana.alert-rule.annotation.runbook_url",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Runbook",
+				Other: "Runbooks",
+			},
+		}, {
+			Attribute: "grafana.alert-rule.query",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Query",
+				Other: "Queries",
+			},
+		}, {
+			Attribute: "grafana.alert-rule.duration",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Pending period",
+				Other: "Pending periods",
+			},
+		}, {
+			Attribute: "grafana.alert-rule.health",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Health",
+				Other: "Health",
+			},
+		}, {
+			Attribute: "grafana.alert-rule.last-error",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Last error",
+				Other: "Last errors",
+			},
+		}, {
+			Attribute: "grafana.alert-rule.evaluation-time",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Evaluation time",
+				Other: "Evaluation times",
+			},
 		},
 	}
 }
 
 func (d *alertDiscovery) DiscoverTargets(ctx context.Context) ([]discovery_kit_api.Target, error) {
-	return getAllAlertRules(ctx, RestyClient), nil
+	return d.lastTargets.Discover(ctx, Instances, "alert rules", getAllAlertRules)
+}
+
+// getAllAlertRules fails when the instance cannot be discovered as a whole, e.g. because it is down or
+// the token is rejected. Datasources failing on their own are skipped and only logged.
+func getAllAlertRules(ctx context.Context, instance extgrafana.Instance) ([]discovery_kit_api.Target, error) {
+	rules, err := discoveredRules.refresh(ctx, instance)
+	if err != nil {
+		return nil, err
+	}
+	return discovery_kit_commons.ApplyAttributeExcludes(dedupeTargetsById(buildTargets(instance, rules, toTargets)), config.Config.DiscoveryAttributesExcludesAlert), nil
 }
 
-func getAllAlertRules(ctx context.Context, client *resty.Client) []discovery_kit_api.Target {
+// targetBuilder turns the rules of a datasource into targets.
+type targetBuilder func(instance extgrafana.Instance, org extgrafana.Organization, datasource DataSource, response AlertsStates) []discovery_kit_api.Target
+
+// datasourceRules are the rules of a datasource of an organization as retrieved by the discovery. They
+// are shared between the discoveries and must not be modified.
+type datasourceRules struct {
+	org        extgrafana.Organization
+	datasource DataSource
+	response   AlertsStates
+}
+
+func buildTargets(instance extgrafana.Instance, rules []datasourceRules, build targetBuilder) []discovery_kit_api.Target {
 	result := make([]discovery_kit_api.Target, 0, 1000)
-	urlParsed, _ := url.Parse(client.BaseURL)
-	grafanaHost := urlParsed.Hostname()
-
-	datasources := getAllCompatibleDatasource(ctx, client)
-	// for every datasource compatible
-	for _, datasource := range datasources {
-		var perDatasourceResponse AlertsStates
-		res, err := client.R().
-			SetContext(ctx).
-			SetResult(&perDatasourceResponse).
-			Get(fmt.Sprintf("/api/prometheus/%s/api/v1/rules", datasource.UID))
+	for _, r := range rules {
+		result = append(result, build(instance, r.org, r.datasource, r.response)...)
+	}
+	return result
+}
+
+// discoveredRules shares the rules retrieved by the alert rule discovery with the alert instance
+// discovery, which builds its targets from the alerts of the same rules. Without sharing, every rules
+// request, datasource health check and ruler probe is made twice per discovery interval.
+var discoveredRules = newDiscoveredRulesCache(time.Now)
+
+// discoveredRulesFreshness is how long the rules retrieved for one discovery are reused by the other,
+// the interval both discoveries run at.
+const discoveredRulesFreshness = 1 * time.Minute
+
+type discoveredRulesEntry struct {
+	mu      sync.Mutex
+	rules   []datasourceRules
+	fetched time.Time
+}
+
+type discoveredRulesCache struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	entries map[string]*discoveredRulesEntry
+}
 
+func newDiscoveredRulesCache(now func() time.Time) *discoveredRulesCache {
+	return &discoveredRulesCache{now: now, entries: make(map[string]*discoveredRulesEntry)}
+}
+
+// refresh retrieves the rules of the instance and keeps them for the other discovery.
+func (c *discoveredRulesCache) refresh(ctx context.Context, instance extgrafana.Instance) ([]datasourceRules, error) {
+	entry := c.entry(instance.Name)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	return c.fetch(ctx, instance, entry)
+}
+
+// recent returns the rules of the instance retrieved within the freshness window, retrieving them if
+// there are none. A retrieval running concurrently is waited for.
+func (c *discoveredRulesCache) recent(ctx context.Context, instance extgrafana.Instance) ([]datasourceRules, error) {
+	entry := c.entry(instance.Name)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.rules != nil && c.now().Sub(entry.fetched) < discoveredRulesFreshness {
+		return entry.rules, nil
+	}
+	return c.fetch(ctx, instance, entry)
+}
+
+func (c *discoveredRulesCache) fetch(ctx context.Context, instance extgrafana.Instance, entry *discoveredRulesEntry) ([]datasourceRules, error) {
+	rules, err := retrieveRules(ctx, instance)
+	if err != nil {
+		return nil, err
+	}
+	entry.rules, entry.fetched = rules, c.now()
+	return rules, nil
+}
+
+func (c *discoveredRulesCache) entry(instanceName string) *discoveredRulesEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[instanceName]
+	if !ok {
+		entry = &discoveredRulesEntry{}
+		c.entries[instanceName] = entry
+	}
+	return entry
+}
+
+// retrieveRules retrieves the rules of all organizations of the instance. The datasources which failed are
+// logged once per retrieval.
+func retrieveRules(ctx context.Context, instance extgrafana.Instance) ([]datasourceRules, error) {
+	result := make([]datasourceRules, 0, 100)
+	var failures []error
+	for _, org := range extgrafana.GetOrganizations(ctx, instance.Client) {
+		rules, orgFailures, err := getAllAlertRulesOfOrganization(ctx, instance, org)
 		if err != nil {
-			log.Err(err).Msgf("Failed to retrieve alerts states from Grafana. Full response: %v", res.String())
-			return result
+			return nil, fmt.Errorf("organization %d: %w", org.ID, err)
 		}
+		result = append(result, rules...)
+		failures = append(failures, orgFailures...)
+	}
+	if len(failures) > 0 {
+		log.Warn().Err(errors.Join(failures...)).Msgf("Failed to discover the alert rules of %d datasources of Grafana instance %s, keeping their previously discovered rules.",
+			len(failures), instance.Name)
+	}
+	return result, nil
+}
+
+// lastDatasourceRules are the rules of the last successful retrieval per datasource, keyed by instance
+// name, organization and datasource uid. They are reported while the datasource fails, e.g. because it
+// is unhealthy, so its targets do not disappear during its outage.
+var lastDatasourceRules sync.Map
+
+// errUnhealthyDatasource is the failure of a datasource which is not healthy, or backed off after failed
+// health checks, see extgrafana.CachedDataSourceHealth.
+var errUnhealthyDatasource = errors.New("datasource is not healthy")
+
+// grafanaDatasource stands for the Grafana-managed alert rules, which are served like the rules of a
+// datasource with the UID "grafana".
+var grafanaDatasource = DataSource{Name: "Grafana", Type: "grafana", UID: "grafana"}
 
-		if res.StatusCode() != 200 && res.StatusCode() != 404 {
-			log.Warn().Msgf("Grafana API responded with unexpected status code %d while retrieving alert states. Full response: %v",
-				res.StatusCode(),
-				res.String())
-			return result
-		} else {
-			log.Trace().Msgf("Grafana response: %v", perDatasourceResponse.AlertsData)
-
-			for _, alertGroup := range perDatasourceResponse.AlertsData.AlertsGroups {
-				for _, rule := range alertGroup.AlertsRules {
-					if !isAlertingRule(rule) {
-						continue
-					}
-					Id := fmt.Sprintf("%s-%s-%s-%s", grafanaHost, datasource.Name, alertGroup.Name, rule.Name)
-					result = append(result, discovery_kit_api.Target{
-						Id:         Id,
-						TargetType: TargetType,
-						Label:      rule.Name,
-						Attributes: map[string][]string{
-							"grafana.alert-rule.type":       {rule.Type},
-							"grafana.alert-rule.datasource": {datasource.UID},
-							"grafana.alert-rule.group":      {alertGroup.Name},
-							"grafana.alert-rule.name":       {rule.Name},
-							"grafana.alert-rule.id":         {Id},
-							"grafana.host":                  {grafanaHost},
-						}})
-				}
+// getAllAlertRulesOfOrganization retrieves the rules of all compatible datasources in parallel, bounded
+// by the configured concurrency. A datasource failing or timing out only fails on its own, with the rules
+// of its last successful retrieval, while the rules of all other datasources and the Grafana-managed ones
+// are still reported. The failures of datasources are returned separately. Failing to list the
+// datasources or to retrieve the Grafana-managed rules fails the whole organization, as it means
+// Grafana itself is not available.
+func getAllAlertRulesOfOrganization(ctx context.Context, instance extgrafana.Instance, org extgrafana.Organization) ([]datasourceRules, []error, error) {
+	datasources, err := getAllCompatibleDatasource(ctx, instance, org)
+	if err != nil {
+		return nil, nil, err
+	}
+	datasources = slices.DeleteFunc(datasources, func(ds DataSource) bool { return !includesDatasource(ds) })
+	grafanaIndex := -1
+	if includesDatasource(grafanaDatasource) {
+		grafanaIndex = len(datasources)
+		datasources = append(datasources, grafanaDatasource)
+	}
+
+	perDatasource := make([]*AlertsStates, len(datasources))
+	perDatasourceErr := make([]error, len(datasources))
+	semaphore := make(chan struct{}, config.Config.GetDiscoveryConcurrency())
+	var wg sync.WaitGroup
+	for i, datasource := range datasources {
+		wg.Go(func() {
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			perDatasource[i], perDatasourceErr[i] = getAlertRulesOfDatasource(ctx, instance, org, datasource)
+		})
+	}
+	wg.Wait()
+
+	if grafanaIndex != -1 && perDatasourceErr[grafanaIndex] != nil {
+		return nil, nil, fmt.Errorf("grafana-managed alert rules: %w", perDatasourceErr[grafanaIndex])
+	}
+
+	result := make([]datasourceRules, 0, len(datasources))
+	var failures []error
+	for i, response := range perDatasource {
+		key := fmt.Sprintf("%s/%d/%s", instance.Name, org.ID, datasources[i].UID)
+		if perDatasourceErr[i] != nil {
+			failures = append(failures, fmt.Errorf("organization %d, datasource %s: %w", org.ID, datasources[i].Name, perDatasourceErr[i]))
+			if last, ok := lastDatasourceRules.Load(key); ok {
+				result = append(result, last.(datasourceRules))
 			}
+			continue
+		}
+		if response == nil {
+			lastDatasourceRules.Delete(key)
+			continue
 		}
+		rules := datasourceRules{org: org, datasource: datasources[i], response: *response}
+		lastDatasourceRules.Store(key, rules)
+		result = append(result, rules)
+	}
+	return result, failures, nil
+}
+
+// getAlertRulesOfDatasource returns no rules for datasources without ruler, and fails for unhealthy ones.
+// The ruler probe, the health check and the rules request share the timeout of the datasource.
+func getAlertRulesOfDatasource(ctx context.Context, instance extgrafana.Instance, org extgrafana.Organization, datasource DataSource) (*AlertsStates, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.Config.GetDiscoveryDatasourceTimeout())
+	defer cancel()
+	client := instance.Client
+
+	if datasource.UID != grafanaDatasource.UID && !supportsAlertRules(ctx, instance, org, datasource) {
+		return nil, nil
+	}
+	if datasource.UID != grafanaDatasource.UID && !isDatasourceHealthy(ctx, instance, org, datasource) {
+		return nil, errUnhealthyDatasource
 	}
 
-	// add the grafana ones also
-	datasource := DataSource{Name: "Grafana", Type: "grafana", UID: "grafana"}
-	var grafanaAlertRules AlertsStates
-	res, err := client.R().
+	var alertRules AlertsStates
+	res, err := extgrafana.SetOrganization(client.R(), org.ID).
 		SetContext(ctx).
-		SetResult(&grafanaAlertRules).
-		Get("/api/prometheus/grafana/api/v1/rules")
+		SetResult(&alertRules).
+		Get(rulesPath(datasource.UID))
 
 	if err != nil {
-		log.Err(err).Msgf("Failed to retrieve alerts states from Grafana. Full response: %v", res.String())
-		return result
-	}
-
-	if res.StatusCode() != 200 && res.StatusCode() != 404 {
-		log.Warn().Msgf("Grafana API responded with unexpected status code %d while retrieving alert states. Full response: %v",
-			res.StatusCode(),
-			res.String())
-	} else {
-		log.Trace().Msgf("Grafana response: %v", grafanaAlertRules.AlertsData)
-
-		for _, alertGroup := range grafanaAlertRules.AlertsData.AlertsGroups {
-			for _, rule := range alertGroup.AlertsRules {
-				if !isAlertingRule(rule) {
-					continue
-				}
-				Id := fmt.Sprintf("%s-%s-%s-%s", grafanaHost, datasource.Name, alertGroup.Name, rule.Name)
-				result = append(result, discovery_kit_api.Target{
-					Id:         Id,
-					TargetType: TargetType,
-					Label:      rule.Name,
-					Attributes: map[string][]string{
-						"grafana.alert-rule.type":       {rule.Type},
-						"grafana.alert-rule.datasource": {datasource.UID},
-						"grafana.alert-rule.group":      {alertGroup.Name},
-						"grafana.alert-rule.name":       {rule.Name},
-						"grafana.alert-rule.id":         {Id},
-						"grafana.host":                  {grafanaHost},
-					}})
+		return nil, fmt.Errorf("failed to retrieve alerts states from Grafana: %w", err)
+	}
+
+	if res.StatusCode() == 404 {
+		return nil, nil
+	}
+	if res.StatusCode() != 200 {
+		return nil, fmt.Errorf("grafana API responded with unexpected status code %d while retrieving alert states. Full response: %v", res.StatusCode(), res.String())
+	}
+
+	log.Trace().Msgf("Grafana response: %v", alertRules.AlertsData)
+	if datasource.UID == grafanaDatasource.UID {
+		assignRuleUids(ctx, client, org.ID, &alertRules)
+	}
+	return &alertRules, nil
+}
+
+func toTargets(instance extgrafana.Instance, org extgrafana.Organization, datasource DataSource, response AlertsStates) []discovery_kit_api.Target {
+	targets := make([]discovery_kit_api.Target, 0)
+	for _, rule := range toRuleTargets(instance, org, datasource, response) {
+		targets = append(targets, discovery_kit_api.Target{
+			Id:         rule.id,
+			TargetType: TargetType,
+			Label:      rule.rule.Name,
+			Attributes: rule.attributes,
+		})
+	}
+	return targets
+}
+
+// ruleTarget is an alerting rule together with the identity and attributes the discovery assigns to it.
+type ruleTarget struct {
+	rule       AlertRule
+	id         string
+	attributes map[string][]string
+}
+
+func toRuleTargets(instance extgrafana.Instance, org extgrafana.Organization, datasource DataSource, response AlertsStates) []ruleTarget {
+	grafanaHost := instance.Host()
+	idPrefix := extgrafana.TargetIdPrefix(instance, org)
+
+	rules := make([]ruleTarget, 0)
+	for _, alertGroup := range response.AlertsData.AlertsGroups {
+		if !includesGroup(alertGroup.File, alertGroup.Name) {
+			continue
+		}
+		for _, rule := range alertGroup.AlertsRules {
+			if !isAlertingRule(rule) || !includesRule(rule.Name, rule.Labels) {
+				continue
+			}
+			// Grafana-managed rules are identified by their UID, which survives renaming the rule. Rules
+			// without UID (datasource-managed rules, Grafana versions not reporting it) are identified by
+			// datasource UID, group and name plus a fingerprint of query and labels, which tells apart rules
+			// sharing their name within the group. The fingerprint is always part of the id, so the id of a
+			// rule does not change when another rule of the same name is added to its group.
+			var Id, fingerprint string
+			if rule.UID != "" {
+				Id = fmt.Sprintf("%s-%s-%s", idPrefix, datasource.UID, rule.UID)
+			} else {
+				fingerprint = ruleFingerprint(rule)
+				Id = fmt.Sprintf("%s-%s-%s-%s-%s", idPrefix, datasource.UID, alertGroup.Name, rule.Name, fingerprint)
+			}
+			attributes := map[string][]string{
+				"grafana.alert-rule.type":       {rule.Type},
+				"grafana.alert-rule.datasource": {datasource.UID},
+				"grafana.alert-rule.group":      {alertGroup.Name},
+				"grafana.alert-rule.name":       {rule.Name},
+				"grafana.alert-rule.id":         {Id},
+				"grafana.host":                  {grafanaHost},
+				"grafana.instance":              {instance.Name},
+			}
+			if rule.UID != "" {
+				attributes["grafana.alert-rule.uid"] = []string{rule.UID}
+			}
+			if alertGroup.File != "" {
+				attributes["grafana.alert-rule.folder"] = []string{alertGroup.File}
 			}
+			if alertGroup.FolderUID != "" {
+				attributes["grafana.alert-rule.folder-uid"] = []string{alertGroup.FolderUID}
+			}
+			if fingerprint != "" {
+				attributes["grafana.alert-rule.fingerprint"] = []string{fingerprint}
+			}
+			extgrafana.AddOrganizationAttributes(attributes, org)
+			addRuleMetadataAttributes(attributes, rule)
+			rules = append(rules, ruleTarget{rule: rule, id: Id, attributes: attributes})
 		}
 	}
+	return rules
+}
+
+// ruleFingerprint tells apart rules sharing their name within a group, e.g. kube-prometheus-stack
+// defines KubePersistentVolumeFillingUp twice with different thresholds. It only depends on the
+// definition of the rule, not on its state, so it is stable across discovery runs.
+func ruleFingerprint(rule AlertRule) string {
+	return labelsFingerprint(rule.Query, rule.Labels)
+}
 
-	return discovery_kit_commons.ApplyAttributeExcludes(dedupeTargetsById(result), config.Config.DiscoveryAttributesExcludesAlert)
+func labelsFingerprint(prefix string, labels map[string]string) string {
+	hash := sha256.New()
+	hash.Write([]byte(prefix))
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		hash.Write([]byte{0})
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write([]byte(labels[key]))
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
+
+// assignRuleUids fills in the UID of Grafana-managed rules for Grafana versions whose Prometheus
+// compatible API does not report it yet, by matching the provisioned rules on folder, group and title.
+func assignRuleUids(ctx context.Context, client *resty.Client, orgId int, response *AlertsStates) {
+	if !missesRuleUids(*response) {
+		return
+	}
+	if uids, ok := getProvisionedRuleUids(ctx, client, orgId); ok {
+		applyRuleUids(response, uids)
+	}
+}
+
+func missesRuleUids(response AlertsStates) bool {
+	for _, alertGroup := range response.AlertsData.AlertsGroups {
+		for _, rule := range alertGroup.AlertsRules {
+			if rule.UID == "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getProvisionedRuleUids maps the folder, group and title of the provisioned rules to their UID. Groups of
+// different folders may share their name, so the rules are mapped without folder as well, for versions not
+// reporting the folder UID of a group either. Keys of more than one rule map to no UID.
+func getProvisionedRuleUids(ctx context.Context, client *resty.Client, orgId int) (map[string]string, bool) {
+	var provisionedRules []ProvisionedAlertRule
+	res, err := extgrafana.SetOrganization(client.R(), orgId).
+		SetContext(ctx).
+		SetResult(&provisionedRules).
+		Get("/api/v1/provisioning/alert-rules")
+	if err != nil || !res.IsSuccess() {
+		log.Debug().Err(err).Msgf("Failed to retrieve provisioned alert rules from Grafana, Grafana-managed rules are identified by name. Full response: %v", res.String())
+		return nil, false
+	}
+
+	uids := make(map[string]string, 2*len(provisionedRules))
+	assign := func(key string, uid string) {
+		if _, ok := uids[key]; ok {
+			uids[key] = ""
+			return
+		}
+		uids[key] = uid
+	}
+	for _, provisionedRule := range provisionedRules {
+		if provisionedRule.FolderUID != "" {
+			assign(provisionedRuleKey(provisionedRule.FolderUID, provisionedRule.RuleGroup, provisionedRule.Title), provisionedRule.UID)
+		}
+		assign(provisionedRuleKey("", provisionedRule.RuleGroup, provisionedRule.Title), provisionedRule.UID)
+	}
+	return uids, true
+}
+
+// applyRuleUids fills in the UIDs of the rules missing one. Rules whose key is ambiguous are left without UID.
+func applyRuleUids(response *AlertsStates, uids map[string]string) {
+	for i := range response.AlertsData.AlertsGroups {
+		alertGroup := &response.AlertsData.AlertsGroups[i]
+		for j := range alertGroup.AlertsRules {
+			rule := &alertGroup.AlertsRules[j]
+			if rule.UID == "" {
+				rule.UID = uids[provisionedRuleKey(alertGroup.FolderUID, alertGroup.Name, rule.Name)]
+			}
+		}
+	}
+}
+
+func provisionedRuleKey(folderUid string, group string, title string) string {
+	return folderUid + "/" + group + "/" + title
+}
+
+// addRuleMetadataAttributes publishes the labels, annotations and query metadata of the rule, so
+// experiments can select rules by e.g. severity or team. Labels starting with "__" are internal to
+// Grafana or Prometheus and skipped.
+func addRuleMetadataAttributes(attributes map[string][]string, rule AlertRule) {
+	for key, value := range rule.Labels {
+		if strings.HasPrefix(key, "__") {
+			continue
+		}
+		attributes["grafana.alert-rule.label."+key] = []string{value}
+	}
+	for key, value := range rule.Annotations {
+		attributes["grafana.alert-rule.annotation."+key] = []string{value}
+	}
+	if rule.Query != "" {
+		attributes["grafana.alert-rule.query"] = []string{rule.Query}
+	}
+	attributes["grafana.alert-rule.duration"] = []string{secondsToDuration(rule.Duration).String()}
+	if rule.Health != "" {
+		attributes["grafana.alert-rule.health"] = []string{rule.Health}
+	}
+	if rule.LastError != "" {
+		attributes["grafana.alert-rule.last-error"] = []string{rule.LastError}
+	}
+	if rule.EvaluationTime > 0 {
+		attributes["grafana.alert-rule.evaluation-time"] = []string{secondsToDuration(rule.EvaluationTime).String()}
+	}
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
 }
 
 // isAlertingRule filters out recording rules: they have no alert state, so they cannot be checked.
@@ -199,10 +607,10 @@ func isAlertingRule(rule AlertRule) bool {
 	return rule.Type == "alerting" || rule.Type == ""
 }
 
-// dedupeTargetsById drops targets sharing an already seen id. The same rule name may appear multiple
-// times within one rule group (e.g. kube-prometheus-stack defines KubePersistentVolumeFillingUp twice
-// with different thresholds), but the check action resolves rules by name only, so such targets are
-// interchangeable and reporting them all would create duplicate targets on the platform.
+// dedupeTargetsById drops targets sharing an already seen id. Rules sharing their name within one rule
+// group get distinct ids through their fingerprint, so this only drops rules that are identical in
+// name, query and labels - the check action cannot tell them apart, and reporting them all would
+// create duplicate targets on the platform.
 func dedupeTargetsById(targets []discovery_kit_api.Target) []discovery_kit_api.Target {
 	seen := make(map[string]struct{}, len(targets))
 	deduped := make([]discovery_kit_api.Target, 0, len(targets))
@@ -217,52 +625,21 @@ func dedupeTargetsById(targets []discovery_kit_api.Target) []discovery_kit_api.T
 	return deduped
 }
 
-func getAllCompatibleDatasource(ctx context.Context, client *resty.Client) []DataSource {
-	var grafanaResponse []DataSource
-	res, err := client.R().
-		SetContext(ctx).
-		SetResult(&grafanaResponse).
-		Get("/api/datasources")
-
+// getAllCompatibleDatasource lists the datasources which may have alert rules. Datasources of other types
+// are only probed for a ruler by the bounded workers of getAllAlertRulesOfOrganization, see supportsAlertRules.
+func getAllCompatibleDatasource(ctx context.Context, instance extgrafana.Instance, org extgrafana.Organization) ([]DataSource, error) {
+	grafanaResponse, err := extgrafana.GetDataSources(ctx, instance.Client, org.ID)
 	if err != nil {
-		log.Err(err).Msgf("Failed to retrieve alerts states from Grafana. Full response: %v", res.String())
-		return grafanaResponse
+		return nil, err
 	}
 
 	grafanaResponseFiltered := make([]DataSource, 0)
-	if res.StatusCode() != 200 {
-		log.Warn().Msgf("Grafana API responded with unexpected status code %d while retrieving alert states. Full response: %v",
-			res.StatusCode(),
-			res.String())
-	} else {
-		for _, ds := range grafanaResponse {
-			if isAlertRuleCompatible(ds) && isDatasourceHealthy(ctx, client, ds) {
-				grafanaResponseFiltered = append(grafanaResponseFiltered, ds)
-			}
+	for _, ds := range grafanaResponse {
+		if mayHaveAlertRules(ds) {
+			grafanaResponseFiltered = append(grafanaResponseFiltered, ds)
 		}
-		log.Trace().Msgf("Grafana response: %v", grafanaResponse)
-		log.Trace().Msgf("Grafana filtered response: %v", grafanaResponseFiltered)
-	}
-	return grafanaResponseFiltered
-}
-
-func isAlertRuleCompatible(ds DataSource) bool {
-	// Only some datasources are compatibles with alert rules https://grafana.com/docs/grafana/latest/alerting/fundamentals/alert-rules/#data-source-managed-alert-rules
-	compatibleDatasources := map[string]bool{
-		"prometheus": true,
-		"loki":       true,
-	}
-	return compatibleDatasources[ds.Type]
-}
-
-func isDatasourceHealthy(ctx context.Context, client *resty.Client, ds DataSource) bool {
-	res, _ := client.R().
-		SetContext(ctx).
-		Get(fmt.Sprintf("/api/datasources/uid/%s/health", ds.UID))
-	// Use new endpoint because of deprecated id usage: https://grafana.com/whats-new/2026-04-14-deprecated-data-source-apis-disabled-by-default/
-	if res.StatusCode() != 200 {
-		log.Warn().Msgf("Datasource %s is not healthy, skipping discovery of alert rules for this one..", ds.Name)
 	}
-
-	return res.StatusCode() == 200
+	log.Trace().Msgf("Grafana response: %v", grafanaResponse)
+	log.Trace().Msgf("Grafana filtered response: %v", grafanaResponseFiltered)
+	return grafanaResponseFiltered, nil
 }
@@ -5,20 +5,27 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/go-resty/resty/v2"
+	"github.com/steadybit/extension-grafana/config"
+	"github.com/steadybit/extension-grafana/extgrafana"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func TestGetAllAlertRules_FiltersRecordingRulesAndDeduplicatesTargetsById(t *testing.T) {
+func TestGetAllAlertRules_FiltersRecordingRulesAndIdentifiesRulesSharingTheirName(t *testing.T) {
+	resetState(t)
 	datasources := `[{"uid":"prom-uid","name":"Prometheus","type":"prometheus"}]`
 	// kube-prometheus-stack defines the same alerting rule name twice within one group (different
 	// thresholds) and ships recording rules, which have no alert state and must not become targets
 	promRules := `{"data":{"groups":[
 		{"name":"kubernetes-storage","rules":[
-			{"name":"KubePersistentVolumeFillingUp","state":"normal","type":"alerting"},
-			{"name":"KubePersistentVolumeFillingUp","state":"normal","type":"alerting"},
+			{"name":"KubePersistentVolumeFillingUp","state":"normal","type":"alerting","query":"available < 0.15"},
+			{"name":"KubePersistentVolumeFillingUp","state":"normal","type":"alerting","query":"available < 0.03"},
+			{"name":"KubePersistentVolumeFillingUp","state":"normal","type":"alerting","query":"available < 0.03"},
 			{"name":"namespace_workload_pod:kube_pod_owner:relabel","state":"normal","type":"recording"},
 			{"name":"KubePodCrashLooping","state":"normal","type":"alerting"}
 		]},
@@ -51,19 +58,518 @@ func TestGetAllAlertRules_FiltersRecordingRulesAndDeduplicatesTargetsById(t *tes
 	})
 	client.SetBaseURL("http://grafana.local")
 
-	targets := getAllAlertRules(context.Background(), client)
+	targets, err := getAllAlertRules(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: client})
+	require.NoError(t, err)
 
-	// 4 unique targets: the duplicated alerting rule collapses to one per group, the recording
-	// rule is dropped, the rule without a type is kept
-	require.Len(t, targets, 4)
+	// 5 unique targets: rules sharing their name within a group are told apart by their fingerprint,
+	// identical rules collapse, the recording rule is dropped, the rule without a type is kept
+	require.Len(t, targets, 5)
 	seen := make(map[string]bool)
 	for _, target := range targets {
 		assert.False(t, seen[target.Id], "duplicate target id %s", target.Id)
 		seen[target.Id] = true
 	}
-	assert.True(t, seen["grafana.local-Prometheus-kubernetes-storage-KubePersistentVolumeFillingUp"])
-	assert.True(t, seen["grafana.local-Prometheus-kubernetes-storage-KubePodCrashLooping"])
-	assert.True(t, seen["grafana.local-Prometheus-other-group-KubePersistentVolumeFillingUp"])
-	assert.True(t, seen["grafana.local-Prometheus-other-group-LegacyRuleWithoutType"])
-	assert.False(t, seen["grafana.local-Prometheus-kubernetes-storage-namespace_workload_pod:kube_pod_owner:relabel"])
+	lowThreshold := ruleFingerprint(AlertRule{Query: "available < 0.15"})
+	highThreshold := ruleFingerprint(AlertRule{Query: "available < 0.03"})
+	assert.NotEqual(t, lowThreshold, highThreshold)
+	assert.True(t, seen["default-prom-uid-kubernetes-storage-KubePersistentVolumeFillingUp-"+lowThreshold])
+	assert.True(t, seen["default-prom-uid-kubernetes-storage-KubePersistentVolumeFillingUp-"+highThreshold])
+	// rules are identified the same way whether or not their name is shared
+	unique := ruleFingerprint(AlertRule{})
+	assert.True(t, seen["default-prom-uid-kubernetes-storage-KubePodCrashLooping-"+unique])
+	assert.True(t, seen["default-prom-uid-other-group-KubePersistentVolumeFillingUp-"+unique])
+	assert.True(t, seen["default-prom-uid-other-group-LegacyRuleWithoutType-"+unique])
+	assert.False(t, seen["default-prom-uid-kubernetes-storage-namespace_workload_pod:kube_pod_owner:relabel"])
+}
+
+func TestDiscoverTargets_FansOutOverAllInstances(t *testing.T) {
+	resetState(t)
+	newInstance := func(name string, baseUrl string, ruleName string) extgrafana.Instance {
+		client := newTestClient(func(req *http.Request) (*http.Response, error) {
+			body := `[]`
+			if req.URL.Path == "/api/prometheus/grafana/api/v1/rules" {
+				body = `{"data":{"groups":[{"name":"group","rules":[{"name":"` + ruleName + `","state":"normal","type":"alerting"}]}]}}`
+			}
+			return &http.Response{
+				StatusCode: 200,
+				Body:       io.NopCloser(strings.NewReader(body)),
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+			}, nil
+		})
+		client.SetBaseURL(baseUrl)
+		return extgrafana.Instance{Name: name, BaseUrl: baseUrl, Client: client}
+	}
+	Instances = []extgrafana.Instance{
+		newInstance("prod", "http://grafana-prod.local", "ProdRule"),
+		newInstance("staging", "http://grafana-staging.local", "StagingRule"),
+	}
+	defer func() { Instances = nil }()
+
+	targets, err := newAlertDiscovery().DiscoverTargets(context.Background())
+
+	require.NoError(t, err)
+	require.Len(t, targets, 2)
+	assert.Equal(t, []string{"prod"}, targets[0].Attributes["grafana.instance"])
+	assert.Equal(t, []string{"grafana-prod.local"}, targets[0].Attributes["grafana.host"])
+	assert.Equal(t, "ProdRule", targets[0].Label)
+	assert.Equal(t, []string{"staging"}, targets[1].Attributes["grafana.instance"])
+	assert.Equal(t, []string{"grafana-staging.local"}, targets[1].Attributes["grafana.host"])
+	assert.Equal(t, "StagingRule", targets[1].Label)
+}
+
+func TestGetAllAlertRules_DiscoversEveryOrganization(t *testing.T) {
+	resetState(t)
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		orgId := req.Header.Get("X-Grafana-Org-Id")
+		var body string
+		switch {
+		case req.URL.Path == "/api/org":
+			body = `{"id":1,"name":"Main Org."}`
+		case req.URL.Path == "/api/user/orgs":
+			body = `[{"orgId":1,"name":"Main Org."},{"orgId":2,"name":"Payments"}]`
+		case req.URL.Path == "/api/datasources":
+			body = `[]`
+		case req.URL.Path == "/api/prometheus/grafana/api/v1/rules":
+			body = `{"data":{"groups":[{"name":"group","rules":[{"name":"rule-of-org-` + orgId + `","state":"normal","type":"alerting"}]}]}}`
+		default:
+			return &http.Response{StatusCode: 404, Body: io.NopCloser(strings.NewReader("not found"))}, nil
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+	client.SetBaseURL("http://grafana.local")
+
+	targets, err := getAllAlertRules(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: client})
+	require.NoError(t, err)
+
+	require.Len(t, targets, 2)
+	// only rules of other organizations than the token's own one carry the organization in their id
+	assert.Equal(t, "default-grafana-group-rule-of-org-1-"+ruleFingerprint(AlertRule{}), targets[0].Id)
+	assert.Equal(t, []string{"1"}, targets[0].Attributes["grafana.org.id"])
+	assert.Equal(t, []string{"Main Org."}, targets[0].Attributes["grafana.org.name"])
+	assert.Equal(t, "default-2-grafana-group-rule-of-org-2-"+ruleFingerprint(AlertRule{}), targets[1].Id)
+	assert.Equal(t, []string{"2"}, targets[1].Attributes["grafana.org.id"])
+	assert.Equal(t, []string{"Payments"}, targets[1].Attributes["grafana.org.name"])
+}
+
+func TestGetAllAlertRules_PublishesRuleMetadata(t *testing.T) {
+	resetState(t)
+	grafanaRules := `{"data":{"groups":[{"name":"checkout","rules":[{
+		"name":"HighLatency","state":"normal","type":"alerting","health":"error",
+		"query":"histogram_quantile(0.99, rate(http_duration_seconds_bucket[5m])) > 1",
+		"duration":120,"evaluationTime":0.25,"lastError":"connection refused",
+		"labels":{"severity":"critical","team":"payments","__alert_rule_uid__":"abc"},
+		"annotations":{"summary":"Checkout is slow","runbook_url":"https://runbooks.local/latency"}
+	}]}]}}`
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		body := `[]`
+		if req.URL.Path == "/api/prometheus/grafana/api/v1/rules" {
+			body = grafanaRules
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+
+	targets, err := getAllAlertRules(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: client})
+	require.NoError(t, err)
+
+	require.Len(t, targets, 1)
+	attributes := targets[0].Attributes
+	assert.Equal(t, []string{"critical"}, attributes["grafana.alert-rule.label.severity"])
+	assert.Equal(t, []string{"payments"}, attributes["grafana.alert-rule.label.team"])
+	assert.NotContains(t, attributes, "grafana.alert-rule.label.__alert_rule_uid__")
+	assert.Equal(t, []string{"Checkout is slow"}, attributes["grafana.alert-rule.annotation.summary"])
+	assert.Equal(t, []string{"https://runbooks.local/latency"}, attributes["grafana.alert-rule.annotation.runbook_url"])
+	assert.Equal(t, []string{"histogram_quantile(0.99, rate(http_duration_seconds_bucket[5m])) > 1"}, attributes["grafana.alert-rule.query"])
+	assert.Equal(t, []string{"2m0s"}, attributes["grafana.alert-rule.duration"])
+	assert.Equal(t, []string{"250ms"}, attributes["grafana.alert-rule.evaluation-time"])
+	assert.Equal(t, []string{"error"}, attributes["grafana.alert-rule.health"])
+	assert.Equal(t, []string{"connection refused"}, attributes["grafana.alert-rule.last-error"])
+}
+
+func TestGetAllAlertRules_IdentifiesGrafanaManagedRulesByUid(t *testing.T) {
+	resetState(t)
+	// the first rule reports its UID, the second one is only known to the provisioning API
+	grafanaRules := `{"data":{"groups":[{"name":"checkout","rules":[
+		{"uid":"uid-latency","name":"HighLatency","state":"normal","type":"alerting"},
+		{"name":"HighErrorRate","state":"normal","type":"alerting"}
+	]}]}}`
+	provisionedRules := `[
+		{"uid":"uid-latency","title":"HighLatency","ruleGroup":"checkout"},
+		{"uid":"uid-errors","title":"HighErrorRate","ruleGroup":"checkout"}
+	]`
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		body := `[]`
+		switch req.URL.Path {
+		case "/api/prometheus/grafana/api/v1/rules":
+			body = grafanaRules
+		case "/api/v1/provisioning/alert-rules":
+			body = provisionedRules
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+
+	targets, err := getAllAlertRules(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: client})
+	require.NoError(t, err)
+
+	require.Len(t, targets, 2)
+	assert.Equal(t, "default-grafana-uid-latency", targets[0].Id)
+	assert.Equal(t, []string{"uid-latency"}, targets[0].Attributes["grafana.alert-rule.uid"])
+	assert.Equal(t, "default-grafana-uid-errors", targets[1].Id)
+	assert.Equal(t, []string{"uid-errors"}, targets[1].Attributes["grafana.alert-rule.uid"])
+}
+
+func TestGetAllAlertRules_MatchesProvisionedRulesByFolder(t *testing.T) {
+	resetState(t)
+	// both folders have a checkout group with a HighErrorRate rule
+	grafanaRules := `{"data":{"groups":[
+		{"name":"checkout","file":"Shop","folderUid":"shop","rules":[{"name":"HighErrorRate","state":"normal","type":"alerting"}]},
+		{"name":"checkout","file":"Payments","folderUid":"payments","rules":[{"name":"HighErrorRate","state":"normal","type":"alerting"}]},
+		{"name":"checkout","file":"Legacy","rules":[{"name":"HighErrorRate","state":"normal","type":"alerting"}]}
+	]}}`
+	provisionedRules := `[
+		{"uid":"uid-shop","title":"HighErrorRate","ruleGroup":"checkout","folderUID":"shop"},
+		{"uid":"uid-payments","title":"HighErrorRate","ruleGroup":"checkout","folderUID":"payments"}
+	]`
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		body := `[]`
+		switch req.URL.Path {
+		case "/api/prometheus/grafana/api/v1/rules":
+			body = grafanaRules
+		case "/api/v1/provisioning/alert-rules":
+			body = provisionedRules
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+
+	targets, err := getAllAlertRules(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: client})
+	require.NoError(t, err)
+
+	require.Len(t, targets, 3)
+	assert.Equal(t, []string{"uid-shop"}, targets[0].Attributes["grafana.alert-rule.uid"])
+	assert.Equal(t, []string{"uid-payments"}, targets[1].Attributes["grafana.alert-rule.uid"])
+	assert.NotContains(t, targets[2].Attributes, "grafana.alert-rule.uid", "without folder UID the rule is ambiguous")
+}
+
+func TestGetAllAlertRules_IsolatesFailingDatasources(t *testing.T) {
+	resetState(t)
+	config.Config.DiscoveryDatasourceTimeout = 100 * time.Millisecond
+	defer func() { config.Config.DiscoveryDatasourceTimeout = 0 }()
+
+	datasources := `[
+		{"uid":"broken","name":"Broken","type":"prometheus"},
+		{"uid":"slow","name":"Slow","type":"prometheus"},
+		{"uid":"healthy","name":"Healthy","type":"loki"}
+	]`
+	rules := func(name string) string {
+		return `{"data":{"groups":[{"name":"group","rules":[{"name":"` + name + `","state":"normal","type":"alerting"}]}]}}`
+	}
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		status, body := 200, `[]`
+		switch req.URL.Path {
+		case "/api/datasources":
+			body = datasources
+		case "/api/prometheus/broken/api/v1/rules":
+			status, body = 500, `internal server error`
+		case "/api/datasources/uid/slow/health":
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		case "/api/prometheus/healthy/api/v1/rules":
+			body = rules("HealthyRule")
+		case "/api/prometheus/grafana/api/v1/rules":
+			body = rules("GrafanaRule")
+		}
+		return &http.Response{
+			StatusCode: status,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+
+	targets, err := getAllAlertRules(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: client})
+	require.NoError(t, err)
+
+	require.Len(t, targets, 2)
+	assert.Equal(t, "HealthyRule", targets[0].Label)
+	assert.Equal(t, "GrafanaRule", targets[1].Label)
+}
+
+func TestGetAllAlertRules_KeepsRulesOfFailingDatasources(t *testing.T) {
+	resetState(t)
+	var healthStatus atomic.Int32
+	healthStatus.Store(200)
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		status, body := 200, `[]`
+		switch req.URL.Path {
+		case "/api/datasources":
+			body = `[{"uid":"prom","name":"Prometheus","type":"prometheus"}]`
+		case "/api/datasources/uid/prom/health":
+			status, body = int(healthStatus.Load()), `{"status":"ERROR","message":"connection refused"}`
+		case "/api/prometheus/prom/api/v1/rules":
+			body = `{"data":{"groups":[{"name":"group","rules":[{"name":"PromRule","state":"normal","type":"alerting"}]}]}}`
+		case "/api/prometheus/grafana/api/v1/rules":
+			body = `{"data":{"groups":[]}}`
+		}
+		return &http.Response{
+			StatusCode: status,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+	instance := extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: client}
+
+	targets, err := getAllAlertRules(context.Background(), instance)
+	require.NoError(t, err)
+	require.Len(t, targets, 1)
+
+	healthStatus.Store(400)
+	extgrafana.DataSourceHealthCache = extgrafana.NewHealthCache(time.Now)
+	targets, err = getAllAlertRules(context.Background(), instance)
+	require.NoError(t, err)
+	require.Len(t, targets, 1, "the rules of an unhealthy datasource are kept")
+	assert.Equal(t, "PromRule", targets[0].Label)
+}
+
+func TestDiscoverTargets_KeepsPreviousTargetsOfFailingInstances(t *testing.T) {
+	resetState(t)
+	failing := map[string]bool{}
+	newInstance := func(name string, ruleName string) extgrafana.Instance {
+		client := newTestClient(func(req *http.Request) (*http.Response, error) {
+			status, body := 200, `[]`
+			if failing[name] {
+				status, body = 401, `{"message":"invalid API key"}`
+			} else if req.URL.Path == "/api/prometheus/grafana/api/v1/rules" {
+				body = `{"data":{"groups":[{"name":"group","rules":[{"name":"` + ruleName + `","state":"normal","type":"alerting"}]}]}}`
+			}
+			return &http.Response{
+				StatusCode: status,
+				Body:       io.NopCloser(strings.NewReader(body)),
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+			}, nil
+		})
+		client.SetBaseURL("http://grafana-" + name + ".local")
+		return extgrafana.Instance{Name: name, BaseUrl: "http://grafana-" + name + ".local", Client: client}
+	}
+	Instances = []extgrafana.Instance{newInstance("prod", "ProdRule"), newInstance("staging", "StagingRule")}
+	defer func() { Instances = nil }()
+	discovery := newAlertDiscovery()
+
+	targets, err := discovery.DiscoverTargets(context.Background())
+	require.NoError(t, err)
+	require.Len(t, targets, 2)
+
+	failing["staging"] = true
+	targets, err = discovery.DiscoverTargets(context.Background())
+	require.NoError(t, err)
+	require.Len(t, targets, 2)
+	assert.Equal(t, "ProdRule", targets[0].Label)
+	assert.Equal(t, "StagingRule", targets[1].Label)
+
+	failing["prod"] = true
+	targets, err = discovery.DiscoverTargets(context.Background())
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "401")
+	assert.Nil(t, targets)
+}
+
+func TestGetAllAlertRules_DistinguishesEmptyResultsFromFailures(t *testing.T) {
+	resetState(t)
+	newClient := func(rulesStatus int) *resty.Client {
+		return newTestClient(func(req *http.Request) (*http.Response, error) {
+			status, body := 200, `[]`
+			if req.URL.Path == "/api/prometheus/grafana/api/v1/rules" {
+				status, body = rulesStatus, `{"data":{"groups":[]}}`
+			}
+			return &http.Response{
+				StatusCode: status,
+				Body:       io.NopCloser(strings.NewReader(body)),
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+			}, nil
+		})
+	}
+
+	targets, err := getAllAlertRules(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: newClient(200)})
+	require.NoError(t, err)
+	assert.Empty(t, targets)
+
+	_, err = getAllAlertRules(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: newClient(503)})
+	assert.ErrorContains(t, err, "503")
+}
+
+func TestGetAllAlertRules_DiscoversConfiguredAndProbedDatasourceTypes(t *testing.T) {
+	resetState(t)
+	config.Config.AlertRuleDatasourceTypes = []string{"custom-mimir-datasource"}
+	config.Config.DiscoveryProbeRuler = true
+	defer func() {
+		config.Config.AlertRuleDatasourceTypes = nil
+		config.Config.DiscoveryProbeRuler = false
+	}()
+
+	rulesRequests := map[string]int{}
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		status, body := 200, `[]`
+		rules := func(name string) string {
+			return `{"data":{"groups":[{"name":"group","rules":[{"name":"` + name + `","state":"normal","type":"alerting"}]}]}}`
+		}
+		switch req.URL.Path {
+		case "/api/datasources":
+			body = `[
+				{"uid":"amp","name":"AMP","type":"grafana-amazonprometheus-datasource"},
+				{"uid":"mimir","name":"Mimir","type":"custom-mimir-datasource"},
+				{"uid":"cortex","name":"Cortex","type":"custom-cortex-datasource"},
+				{"uid":"tempo","name":"Tempo","type":"tempo"}
+			]`
+		case "/api/prometheus/amp/api/v1/rules":
+			body = rules("AmpRule")
+		case "/api/prometheus/mimir/api/v1/rules":
+			body = rules("MimirRule")
+		case "/api/prometheus/cortex/api/v1/rules":
+			rulesRequests["cortex"]++
+			body = rules("CortexRule")
+		case "/api/prometheus/tempo/api/v1/rules":
+			rulesRequests["tempo"]++
+			status, body = 400, `{"message":"not supported"}`
+		case "/api/prometheus/grafana/api/v1/rules":
+			body = `{"data":{"groups":[]}}`
+		}
+		return &http.Response{
+			StatusCode: status,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+	instance := extgrafana.Instance{Name: "default", BaseUrl: "http://grafana-probe.local", Client: client}
+
+	for range 2 {
+		targets, err := getAllAlertRules(context.Background(), instance)
+		require.NoError(t, err)
+		labels := make([]string, 0, len(targets))
+		for _, target := range targets {
+			labels = append(labels, target.Label)
+		}
+		assert.ElementsMatch(t, []string{"AmpRule", "MimirRule", "CortexRule"}, labels)
+	}
+	// the probe of a datasource is remembered, only the discovery itself requests its rules again
+	assert.Equal(t, 3, rulesRequests["cortex"])
+	assert.Equal(t, 1, rulesRequests["tempo"])
+}
+
+func TestGetAllAlertRules_BoundsRulerProbesByDatasourceTimeout(t *testing.T) {
+	resetState(t)
+	config.Config.DiscoveryProbeRuler = true
+	config.Config.DiscoveryDatasourceTimeout = 50 * time.Millisecond
+	defer func() {
+		config.Config.DiscoveryProbeRuler = false
+		config.Config.DiscoveryDatasourceTimeout = 0
+	}()
+
+	var probeDeadline atomic.Bool
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		body := `[]`
+		switch req.URL.Path {
+		case "/api/datasources":
+			body = `[{"uid":"prom","name":"Prometheus","type":"prometheus"},{"uid":"stuck","name":"Stuck","type":"tempo"}]`
+		case "/api/prometheus/stuck/api/v1/rules":
+			_, ok := req.Context().Deadline()
+			probeDeadline.Store(ok)
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		case "/api/prometheus/prom/api/v1/rules":
+			body = `{"data":{"groups":[{"name":"group","rules":[{"name":"PromRule","state":"normal","type":"alerting"}]}]}}`
+		case "/api/prometheus/grafana/api/v1/rules":
+			body = `{"data":{"groups":[]}}`
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+
+	targets, err := getAllAlertRules(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: client})
+	require.NoError(t, err)
+	require.Len(t, targets, 1)
+	assert.Equal(t, "PromRule", targets[0].Label)
+	assert.True(t, probeDeadline.Load(), "the probe is bounded by the timeout of the datasource")
+}
+
+func TestParseDiscoveryIncludes_RejectsUnknownKeys(t *testing.T) {
+	includes, err := ParseDiscoveryIncludes(`datasource="prom",folder="Shop",group="checkout",name=~"High.*",label.severity="critical"`)
+	require.NoError(t, err)
+	assert.Len(t, includes, 5)
+
+	_, err = ParseDiscoveryIncludes(`severity="critical"`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown key 'severity'")
+	_, err = ParseDiscoveryIncludes(`label.="critical"`)
+	require.Error(t, err)
+}
+
+func TestGetAllAlertRules_AppliesIncludesBeforeRequestingRules(t *testing.T) {
+	resetState(t)
+	includes, err := ParseDiscoveryIncludes(`datasource=~"prom-.*|grafana",folder="Shop",label.severity="critical"`)
+	require.NoError(t, err)
+	DiscoveryIncludes = includes
+	defer func() { DiscoveryIncludes = nil }()
+
+	requested := map[string]bool{}
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		requested[req.URL.Path] = true
+		body := `[]`
+		switch req.URL.Path {
+		case "/api/datasources":
+			body = `[{"uid":"prom-shop","name":"Shop","type":"prometheus"},{"uid":"loki","name":"Loki","type":"loki"}]`
+		case "/api/prometheus/prom-shop/api/v1/rules":
+			body = `{"data":{"groups":[{"name":"other","file":"Other","rules":[{"name":"OtherRule","type":"alerting","labels":{"severity":"critical"}}]}]}}`
+		case "/api/prometheus/grafana/api/v1/rules":
+			body = `{"data":{"groups":[{"name":"checkout","file":"Shop","rules":[
+				{"uid":"critical","name":"CriticalRule","type":"alerting","labels":{"severity":"critical"}},
+				{"uid":"warning","name":"WarningRule","type":"alerting","labels":{"severity":"warning"}}
+			]}]}}`
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+
+	targets, err := getAllAlertRules(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: client})
+	require.NoError(t, err)
+
+	require.Len(t, targets, 1)
+	assert.Equal(t, "CriticalRule", targets[0].Label)
+	assert.Equal(t, []string{"Shop"}, targets[0].Attributes["grafana.alert-rule.folder"])
+	assert.True(t, requested["/api/prometheus/prom-shop/api/v1/rules"])
+	assert.False(t, requested["/api/datasources/uid/loki/health"], "datasource not included is not health checked")
+	assert.False(t, requested["/api/prometheus/loki/api/v1/rules"], "datasource not included is not requested")
+}
+
+// resetState resets the state the package shares between checks and discoveries once the test ends,
+// so tests don't see the rules, probes, health or aggregations of others.
+func resetState(t *testing.T) {
+	t.Cleanup(func() {
+		discoveredRules = newDiscoveredRulesCache(time.Now)
+		rulesPolling = newRulesPoller(time.Now)
+		rulerProbes.Clear()
+		lastDatasourceRules.Clear()
+		extgrafana.DataSourceHealthCache = extgrafana.NewHealthCache(time.Now)
+		aggregations.Lock()
+		aggregations.groups = make(map[string]*aggregationGroup)
+		aggregations.Unlock()
+	})
 }
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extalertrules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/steadybit/extension-grafana/extgrafana"
+)
+
+// DiscoveryIncludes limit the discovery to the datasources, folders, groups and rules they match. They
+// are applied before requesting the rules of a datasource and before building targets, so datasources
+// not included are neither health checked nor requested. The other includes only filter the retrieved
+// rules. Everything is included if empty.
+var DiscoveryIncludes []extgrafana.LabelMatcher
+
+const (
+	includeDatasource  = "datasource"
+	includeFolder      = "folder"
+	includeGroup       = "group"
+	includeName        = "name"
+	includeLabelPrefix = "label."
+)
+
+// ParseDiscoveryIncludes parses the matchers of DiscoveryIncludes, rejecting matchers of unknown keys as
+// they would never apply.
+func ParseDiscoveryIncludes(input string) ([]extgrafana.LabelMatcher, error) {
+	includes, err := extgrafana.ParseLabelMatchers(input)
+	if err != nil {
+		return nil, err
+	}
+	for _, matcher := range includes {
+		switch {
+		case matcher.Name == includeDatasource, matcher.Name == includeFolder, matcher.Name == includeGroup, matcher.Name == includeName:
+		case strings.HasPrefix(matcher.Name, includeLabelPrefix) && len(matcher.Name) > len(includeLabelPrefix):
+		default:
+			return nil, fmt.Errorf("unknown key '%s' of matcher %s, expected one of %s, %s, %s, %s or %s<key>",
+				matcher.Name, matcher, includeDatasource, includeFolder, includeGroup, includeName, includeLabelPrefix)
+		}
+	}
+	return includes, nil
+}
+
+// includesDatasource matches the datasource by UID or name.
+func includesDatasource(ds DataSource) bool {
+	for _, matcher := range DiscoveryIncludes {
+		if matcher.Name == includeDatasource && !matchesAny(matcher, ds.UID, ds.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+func includesGroup(folder string, group string) bool {
+	for _, matcher := range DiscoveryIncludes {
+		if matcher.Name == includeGroup && !matcher.Matches(group) {
+			return false
+		}
+	}
+	return includesFolder(folder)
+}
+
+// includesFolder only matches the folder, for alerts not telling the group of their rule, e.g. those of
+// the Alertmanager. Group matchers do not apply to them.
+func includesFolder(folder string) bool {
+	for _, matcher := range DiscoveryIncludes {
+		if matcher.Name == includeFolder && !matcher.Matches(folder) {
+			return false
+		}
+	}
+	return true
+}
+
+// includesRule matches the rule by name and labels. Rule labels are matched with a "label." prefix,
+// e.g. label.severity="critical".
+func includesRule(name string, labels map[string]string) bool {
+	for _, matcher := range DiscoveryIncludes {
+		if matcher.Name == includeName && !matcher.Matches(name) {
+			return false
+		}
+		if label, ok := strings.CutPrefix(matcher.Name, includeLabelPrefix); ok && !matcher.Matches(labels[label]) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAny tells whether a positive matcher matches any of the values, or a negative matcher all of them.
+func matchesAny(matcher extgrafana.LabelMatcher, values ...string) bool {
+	negative := matcher.Type == extgrafana.MatchNotEqual || matcher.Type == extgrafana.MatchNotRegexp
+	for _, value := range values {
+		if matcher.Matches(value) != negative {
+			return !negative
+		}
+	}
+	return negative
+}
@@ -0,0 +1,273 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extalertrules
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_api"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_commons"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_sdk"
+	"github.com/steadybit/extension-grafana/config"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	"github.com/steadybit/extension-kit/extbuild"
+)
+
+// alertInstanceDiscovery discovers the instances of alerting rules, one per label set the query of the
+// rule returned, e.g. one per pod. Instances only exist while the rule evaluates them, so they come and
+// go with the state of the rule.
+type alertInstanceDiscovery struct {
+	lastTargets *extgrafana.LastTargetsByInstance
+}
+
+var (
+	_ discovery_kit_sdk.TargetDescriber    = (*alertInstanceDiscovery)(nil)
+	_ discovery_kit_sdk.AttributeDescriber = (*alertInstanceDiscovery)(nil)
+)
+
+func NewAlertInstanceDiscovery() discovery_kit_sdk.TargetDiscovery {
+	discovery := newAlertInstanceDiscovery()
+	return discovery_kit_sdk.NewCachedTargetDiscovery(discovery,
+		discovery_kit_sdk.WithRefreshTargetsNow(),
+		discovery_kit_sdk.WithRefreshTargetsInterval(context.Background(), 1*time.Minute),
+	)
+}
+
+func newAlertInstanceDiscovery() *alertInstanceDiscovery {
+	return &alertInstanceDiscovery{lastTargets: extgrafana.NewLastTargetsByInstance()}
+}
+
+func (d *alertInstanceDiscovery) Describe() discovery_kit_api.DiscoveryDescription {
+	return discovery_kit_api.DiscoveryDescription{
+		Id: AlertInstanceTargetType,
+		Discover: discovery_kit_api.DescribingEndpointReferenceWithCallInterval{
+			CallInterval: new("1m"),
+		},
+	}
+}
+
+func (d *alertInstanceDiscovery) DescribeTarget() discovery_kit_api.TargetDescription {
+	return discovery_kit_api.TargetDescription{
+		Id:       AlertInstanceTargetType,
+		Label:    discovery_kit_api.PluralLabel{One: "Grafana Alert Instance", Other: "Grafana Alert Instances"},
+		Category: new("monitoring"),
+		Version:  extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:     new(targetIcon),
+		Table: discovery_kit_api.Table{
+			Columns: []discovery_kit_api.Column{
+				{Attribute: "steadybit.label"},
+				{Attribute: "grafana.alert-rule.name"},
+				{Attribute: "grafana.alert-instance.state"},
+				{Attribute: "grafana.instance"},
+			},
+			OrderBy: []discovery_kit_api.OrderBy{
+				{
+					Attribute: "steadybit.label",
+					Direction: "ASC",
+				},
+			},
+		},
+	}
+}
+
+func (d *alertInstanceDiscovery) DescribeAttributes() []discovery_kit_api.AttributeDescription {
+	return []discovery_kit_api.AttributeDescription{
+		{
+			Attribute: "grafana.alert-instance.id",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Alert instance id",
+				Other: "Alert instance ids",
+			},
+		}, {
+			Attribute: "grafana.alert-instance.state",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Alert instance state",
+				Other: "Alert instance states",
+			},
+		}, {
+			Attribute: "grafana.alert-instance.alertmanager-state",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Alertmanager state",
+				Other: "Alertmanager states",
+			},
+		}, {
+			Attribute: "grafana.alert-instance.active-at",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Active since",
+				Other: "Active since",
+			},
+		}, {
+			Attribute: "grafana.alert-instance.value",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Value",
+				Other: "Values",
+			},
+		}, {
+			Attribute: "grafana.alert-instance.annotation.summary",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Summary",
+				Other: "Summaries",
+			},
+		},
+	}
+}
+
+func (d *alertInstanceDiscovery) DiscoverTargets(ctx context.Context) ([]discovery_kit_api.Target, error) {
+	return d.lastTargets.Discover(ctx, Instances, "alert instances", getAllAlertInstances)
+}
+
+// getAllAlertInstances builds the instances from the alerts of the rules of all datasources, as
+// recently retrieved by the alert rule discovery, or, if configured, from the Alertmanager of Grafana,
+// which only knows the firing instances of Grafana-managed rules.
+func getAllAlertInstances(ctx context.Context, instance extgrafana.Instance) ([]discovery_kit_api.Target, error) {
+	var result []discovery_kit_api.Target
+	if config.Config.DiscoveryAlertInstancesSource == alertInstancesSourceAlertmanager {
+		var err error
+		result, err = getAlertmanagerAlertInstances(ctx, instance)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		rules, err := discoveredRules.recent(ctx, instance)
+		if err != nil {
+			return nil, err
+		}
+		result = buildTargets(instance, rules, toAlertInstanceTargets)
+	}
+	return discovery_kit_commons.ApplyAttributeExcludes(dedupeTargetsById(result), config.Config.DiscoveryAttributesExcludesAlertInstance), nil
+}
+
+func toAlertInstanceTargets(instance extgrafana.Instance, org extgrafana.Organization, datasource DataSource, response AlertsStates) []discovery_kit_api.Target {
+	targets := make([]discovery_kit_api.Target, 0)
+	for _, rule := range toRuleTargets(instance, org, datasource, response) {
+		for _, alert := range rule.rule.Alerts {
+			targets = append(targets, toAlertInstanceTarget(rule, alert))
+		}
+	}
+	return targets
+}
+
+// toAlertInstanceTarget builds an instance from the attributes of its rule. The instance is identified
+// by its rule and a fingerprint of its labels, which are the same on every evaluation.
+func toAlertInstanceTarget(rule ruleTarget, alert Alert) discovery_kit_api.Target {
+	id := fmt.Sprintf("%s-%s", rule.id, labelsFingerprint("", alert.Labels))
+	attributes := maps.Clone(rule.attributes)
+	attributes["grafana.alert-instance.id"] = []string{id}
+	attributes["grafana.alert-instance.state"] = []string{alert.State}
+	for key, value := range alert.Labels {
+		if strings.HasPrefix(key, "__") {
+			continue
+		}
+		attributes["grafana.alert-instance.label."+key] = []string{value}
+	}
+	for key, value := range alert.Annotations {
+		attributes["grafana.alert-instance.annotation."+key] = []string{value}
+	}
+	if alert.ActiveAt != nil && !alert.ActiveAt.IsZero() {
+		attributes["grafana.alert-instance.active-at"] = []string{alert.ActiveAt.UTC().Format(time.RFC3339)}
+	}
+	if alert.Value != "" {
+		attributes["grafana.alert-instance.value"] = []string{alert.Value}
+	}
+	return discovery_kit_api.Target{
+		Id:         id,
+		TargetType: AlertInstanceTargetType,
+		Label:      alertInstanceLabel(rule.rule.Name, rule.rule.Labels, alert.Labels),
+		Attributes: attributes,
+	}
+}
+
+// alertInstanceLabel names an instance by its rule and the labels telling it apart from the other
+// instances of the rule, e.g. HighLatency{service="checkout"}.
+func alertInstanceLabel(ruleName string, ruleLabels map[string]string, labels map[string]string) string {
+	distinctive := make([]string, 0, len(labels))
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		if strings.HasPrefix(key, "__") || key == "alertname" || key == "grafana_folder" {
+			continue
+		}
+		if value, ok := ruleLabels[key]; ok && value == labels[key] {
+			continue
+		}
+		distinctive = append(distinctive, fmt.Sprintf("%s=%q", key, labels[key]))
+	}
+	if len(distinctive) == 0 {
+		return ruleName
+	}
+	return fmt.Sprintf("%s{%s}", ruleName, strings.Join(distinctive, ", "))
+}
+
+// alertmanagerAlertState is the state of the alerts of the Alertmanager, in the states of the alerts of
+// the rules API.
+const alertmanagerAlertState = "Alerting"
+
+// getAlertmanagerAlertInstances retrieves the instances of Grafana-managed rules from the Alertmanager
+// of every organization. The Alertmanager identifies the rule of an instance by the __alert_rule_uid__
+// label.
+func getAlertmanagerAlertInstances(ctx context.Context, instance extgrafana.Instance) ([]discovery_kit_api.Target, error) {
+	result := make([]discovery_kit_api.Target, 0, 1000)
+	if !includesDatasource(grafanaDatasource) {
+		return result, nil
+	}
+	for _, org := range extgrafana.GetOrganizations(ctx, instance.Client) {
+		var alerts []AlertmanagerAlert
+		res, err := extgrafana.SetOrganization(instance.Client.R(), org.ID).
+			SetContext(ctx).
+			SetResult(&alerts).
+			Get("/api/alertmanager/grafana/api/v2/alerts")
+		if err != nil {
+			return nil, fmt.Errorf("organization %d: failed to retrieve alerts from the Grafana Alertmanager: %w", org.ID, err)
+		}
+		if res.StatusCode() != 200 {
+			return nil, fmt.Errorf("organization %d: grafana API responded with unexpected status code %d while retrieving alerts from the Alertmanager. Full response: %v", org.ID, res.StatusCode(), res.String())
+		}
+
+		for _, alert := range alerts {
+			ruleUid := alert.Labels["__alert_rule_uid__"]
+			if ruleUid == "" {
+				log.Debug().Msgf("Skipping alert %s without rule uid.", alert.Fingerprint)
+				continue
+			}
+			folder := alert.Labels["grafana_folder"]
+			if !includesFolder(folder) || !includesRule(alert.Labels["alertname"], alert.Labels) {
+				continue
+			}
+			rule := ruleTarget{
+				rule: AlertRule{UID: ruleUid, Name: alert.Labels["alertname"]},
+				id:   fmt.Sprintf("%s-%s-%s", extgrafana.TargetIdPrefix(instance, org), grafanaDatasource.UID, ruleUid),
+			}
+			rule.attributes = map[string][]string{
+				"grafana.alert-rule.datasource": {grafanaDatasource.UID},
+				"grafana.alert-rule.name":       {rule.rule.Name},
+				"grafana.alert-rule.id":         {rule.id},
+				"grafana.alert-rule.uid":        {ruleUid},
+				"grafana.host":                  {instance.Host()},
+				"grafana.instance":              {instance.Name},
+			}
+			if folder != "" {
+				rule.attributes["grafana.alert-rule.folder"] = []string{folder}
+			}
+			extgrafana.AddOrganizationAttributes(rule.attributes, org)
+			// the Alertmanager only receives firing alerts, its own state tells whether they are silenced or inhibited
+			target := toAlertInstanceTarget(rule, Alert{
+				Labels:      alert.Labels,
+				Annotations: alert.Annotations,
+				State:       alertmanagerAlertState,
+				ActiveAt:    &alert.StartsAt,
+			})
+			target.Attributes["grafana.alert-instance.alertmanager-state"] = []string{alert.Status.State}
+			result = append(result, target)
+		}
+	}
+	return result, nil
+}
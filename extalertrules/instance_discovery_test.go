@@ -0,0 +1,163 @@
+package extalertrules
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/steadybit/extension-grafana/config"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAllAlertInstances_FromAlertsOfRules(t *testing.T) {
+	resetState(t)
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		body := `[]`
+		if req.URL.Path == "/api/prometheus/grafana/api/v1/rules" {
+			body = `{"data":{"groups":[{"name":"latency","rules":[{
+				"uid":"uid-latency",
+				"name":"HighLatency",
+				"state":"firing",
+				"type":"alerting",
+				"labels":{"severity":"critical"},
+				"alerts":[
+					{"labels":{"alertname":"HighLatency","severity":"critical","service":"checkout","__alert_rule_uid__":"uid-latency"},"annotations":{"summary":"checkout is slow"},"state":"Alerting","activeAt":"2024-05-01T10:00:00Z","value":"1.5"},
+					{"labels":{"alertname":"HighLatency","severity":"critical","service":"cart"},"state":"Normal","activeAt":"0001-01-01T00:00:00Z"}
+				]
+			}]}]}}`
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+
+	targets, err := getAllAlertInstances(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: client})
+	require.NoError(t, err)
+
+	require.Len(t, targets, 2)
+	checkout := targets[0]
+	assert.Equal(t, AlertInstanceTargetType, checkout.TargetType)
+	assert.Equal(t, `HighLatency{service="checkout"}`, checkout.Label)
+	assert.True(t, strings.HasPrefix(checkout.Id, "default-grafana-uid-latency-"))
+	assert.Equal(t, []string{checkout.Id}, checkout.Attributes["grafana.alert-instance.id"])
+	assert.Equal(t, []string{"default-grafana-uid-latency"}, checkout.Attributes["grafana.alert-rule.id"])
+	assert.Equal(t, []string{"HighLatency"}, checkout.Attributes["grafana.alert-rule.name"])
+	assert.Equal(t, []string{"Alerting"}, checkout.Attributes["grafana.alert-instance.state"])
+	assert.Equal(t, []string{"checkout"}, checkout.Attributes["grafana.alert-instance.label.service"])
+	assert.Equal(t, []string{"critical"}, checkout.Attributes["grafana.alert-instance.label.severity"])
+	assert.Equal(t, []string{"checkout is slow"}, checkout.Attributes["grafana.alert-instance.annotation.summary"])
+	assert.Equal(t, []string{"2024-05-01T10:00:00Z"}, checkout.Attributes["grafana.alert-instance.active-at"])
+	assert.Equal(t, []string{"1.5"}, checkout.Attributes["grafana.alert-instance.value"])
+	assert.NotContains(t, checkout.Attributes, "grafana.alert-instance.label.__alert_rule_uid__")
+
+	cart := targets[1]
+	assert.Equal(t, `HighLatency{service="cart"}`, cart.Label)
+	assert.NotEqual(t, checkout.Id, cart.Id)
+	assert.NotContains(t, cart.Attributes, "grafana.alert-instance.active-at")
+}
+
+func TestGetAllAlertInstances_FromAlertmanager(t *testing.T) {
+	resetState(t)
+	config.Config.DiscoveryAlertInstancesSource = alertInstancesSourceAlertmanager
+	defer func() { config.Config.DiscoveryAlertInstancesSource = "" }()
+
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		body := `[]`
+		if req.URL.Path == "/api/alertmanager/grafana/api/v2/alerts" {
+			body = `[
+				{"labels":{"alertname":"HighLatency","service":"checkout","__alert_rule_uid__":"uid-latency"},"annotations":{"summary":"checkout is slow"},"startsAt":"2024-05-01T10:00:00Z","fingerprint":"a","status":{"state":"active"}},
+				{"labels":{"alertname":"External"},"startsAt":"2024-05-01T10:00:00Z","fingerprint":"b","status":{"state":"active"}}
+			]`
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+
+	targets, err := getAllAlertInstances(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: client})
+	require.NoError(t, err)
+
+	require.Len(t, targets, 1)
+	assert.Equal(t, `HighLatency{service="checkout"}`, targets[0].Label)
+	assert.Equal(t, []string{"default-grafana-uid-latency"}, targets[0].Attributes["grafana.alert-rule.id"])
+	assert.Equal(t, []string{"uid-latency"}, targets[0].Attributes["grafana.alert-rule.uid"])
+	assert.Equal(t, []string{"Alerting"}, targets[0].Attributes["grafana.alert-instance.state"], "in the states of the rules source")
+	assert.Equal(t, []string{"active"}, targets[0].Attributes["grafana.alert-instance.alertmanager-state"])
+	assert.Equal(t, []string{"checkout"}, targets[0].Attributes["grafana.alert-instance.label.service"])
+	assert.Equal(t, []string{"2024-05-01T10:00:00Z"}, targets[0].Attributes["grafana.alert-instance.active-at"])
+}
+
+func TestGetAllAlertInstances_ReusesRulesOfAlertRuleDiscovery(t *testing.T) {
+	resetState(t)
+	requests := map[string]int{}
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		requests[req.URL.Path]++
+		body := `[]`
+		switch req.URL.Path {
+		case "/api/datasources":
+			body = `[{"uid":"prom-uid","name":"Prometheus","type":"prometheus"}]`
+		case "/api/datasources/uid/prom-uid/health":
+			body = `{"status":"OK"}`
+		case "/api/prometheus/prom-uid/api/v1/rules":
+			body = `{"data":{"groups":[{"name":"g","rules":[{"name":"HighLatency","state":"firing","type":"alerting","alerts":[{"labels":{"service":"checkout"},"state":"firing"}]}]}]}}`
+		case "/api/prometheus/grafana/api/v1/rules":
+			body = `{"data":{"groups":[]}}`
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+	instance := extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: client}
+
+	rules, err := getAllAlertRules(context.Background(), instance)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	instances, err := getAllAlertInstances(context.Background(), instance)
+	require.NoError(t, err)
+	require.Len(t, instances, 1)
+	assert.Equal(t, []string{rules[0].Id}, instances[0].Attributes["grafana.alert-rule.id"])
+
+	assert.Equal(t, 1, requests["/api/prometheus/prom-uid/api/v1/rules"], "the rules are requested once for both discoveries")
+	assert.Equal(t, 1, requests["/api/prometheus/grafana/api/v1/rules"])
+}
+
+func TestGetAllAlertInstances_FromAlertmanagerIgnoresGroupIncludes(t *testing.T) {
+	resetState(t)
+	config.Config.DiscoveryAlertInstancesSource = alertInstancesSourceAlertmanager
+	defer func() { config.Config.DiscoveryAlertInstancesSource = "" }()
+	includes, err := ParseDiscoveryIncludes(`folder="Shop",group="checkout"`)
+	require.NoError(t, err)
+	DiscoveryIncludes = includes
+	defer func() { DiscoveryIncludes = nil }()
+
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		body := `[]`
+		if req.URL.Path == "/api/alertmanager/grafana/api/v2/alerts" {
+			body = `[
+				{"labels":{"alertname":"HighLatency","grafana_folder":"Shop","__alert_rule_uid__":"uid-latency"},"startsAt":"2024-05-01T10:00:00Z","fingerprint":"a","status":{"state":"active"}},
+				{"labels":{"alertname":"DiskFull","grafana_folder":"Infra","__alert_rule_uid__":"uid-disk"},"startsAt":"2024-05-01T10:00:00Z","fingerprint":"b","status":{"state":"active"}}
+			]`
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+
+	targets, err := getAllAlertInstances(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: client})
+	require.NoError(t, err)
+
+	require.Len(t, targets, 1, "the folder matcher applies, the group matcher does not")
+	assert.Equal(t, "HighLatency", targets[0].Label)
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extalertrules
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/extension-kit/extutil"
+)
+
+// AlertLatencies are the times the checked rule took to become pending, to fire and to resolve after
+// firing, relative to the start of the step. Zero until observed. The Max* limits are optional.
+type AlertLatencies struct {
+	PendingAfter     time.Duration
+	FiringAfter      time.Duration
+	ResolvedAfter    time.Duration
+	MaxPendingAfter  time.Duration
+	MaxFiringAfter   time.Duration
+	MaxResolvedAfter time.Duration
+}
+
+// trackLatencies records the latencies first observed with this state of the rule and returns them as
+// metrics. A rule observed firing without having been observed pending, e.g. because it has no pending
+// period, is considered pending at that time as well. Nothing is tracked for steps prepared without start.
+func trackLatencies(state *AlertRuleCheckState, alertRule *AlertRule, now time.Time) []action_kit_api.Metric {
+	if state.Start.IsZero() {
+		return nil
+	}
+	latencies := &state.Latencies
+	elapsed := max(now.Sub(state.Start), time.Nanosecond)
+	metrics := make([]action_kit_api.Metric, 0)
+	observe := func(latency *time.Duration, name string) {
+		if *latency == 0 {
+			*latency = elapsed
+			metrics = append(metrics, action_kit_api.Metric{
+				Name: new(name),
+				Metric: map[string]string{
+					"grafana.alert-rule.id":   state.AlertRuleId,
+					"grafana.alert-rule.name": alertRule.Name,
+				},
+				Timestamp: now,
+				Value:     elapsed.Seconds(),
+			})
+		}
+	}
+
+	switch alertRule.State {
+	case "firing":
+		observe(&latencies.PendingAfter, "grafana_alert_rule_time_to_pending_seconds")
+		observe(&latencies.FiringAfter, "grafana_alert_rule_time_to_firing_seconds")
+	case "pending":
+		observe(&latencies.PendingAfter, "grafana_alert_rule_time_to_pending_seconds")
+	case "inactive", "normal":
+		if latencies.FiringAfter > 0 {
+			observe(&latencies.ResolvedAfter, "grafana_alert_rule_time_to_resolve_seconds")
+		}
+	}
+	return metrics
+}
+
+// checkLatencies fails the step if a latency exceeded its limit, or if its limit passed without the
+// rule reaching the state. Unless failing early, this is only reported at the end of the step.
+func checkLatencies(state *AlertRuleCheckState, alertRule *AlertRule, now time.Time, completed bool) *action_kit_api.ActionKitError {
+	if !state.FailEarly && !completed {
+		return nil
+	}
+	latencies := state.Latencies
+	elapsed := now.Sub(state.Start)
+	for _, limit := range []struct {
+		what    string
+		latency time.Duration
+		max     time.Duration
+	}{
+		{"become pending", latencies.PendingAfter, latencies.MaxPendingAfter},
+		{"fire", latencies.FiringAfter, latencies.MaxFiringAfter},
+		{"resolve", latencies.ResolvedAfter, latencies.MaxResolvedAfter},
+	} {
+		if limit.max <= 0 {
+			continue
+		}
+		if limit.latency > limit.max {
+			return new(action_kit_api.ActionKitError{
+				Title:  fmt.Sprintf("AlertRule '%s' took %s to %s whereas at most %s is expected.", alertRule.Name, limit.latency.Round(time.Millisecond), limit.what, limit.max),
+				Status: extutil.Ptr(action_kit_api.Failed),
+			})
+		}
+		if limit.latency == 0 && elapsed > limit.max {
+			return new(action_kit_api.ActionKitError{
+				Title:  fmt.Sprintf("AlertRule '%s' didn't %s within %s.", alertRule.Name, limit.what, limit.max),
+				Status: extutil.Ptr(action_kit_api.Failed),
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extalertrules
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/steadybit/extension-grafana/config"
+	"github.com/steadybit/extension-grafana/extgrafana"
+)
+
+// rulesPolling shares the rules of a datasource between all running checks. Every check polls the state
+// of its rule once per second, and the rules endpoint returns all rules of the datasource or group, so
+// without sharing, checking 40 rules of a datasource downloads its rules 40 times per second. Checks of
+// rules of different groups share the rules of their group, see rulesFilter.
+var rulesPolling = newRulesPoller(time.Now)
+
+// rulesSnapshot is the outcome of a single request of the rules of a datasource. It is shared between
+// checks and must not be modified.
+type rulesSnapshot struct {
+	response     AlertsStates
+	statusCode   int
+	body         string
+	err          error
+	fetched      time.Time
+	uidsAssigned bool
+}
+
+type rulesPollerEntry struct {
+	mu       sync.Mutex
+	snapshot *rulesSnapshot
+}
+
+// ruleUidsEntry is the mapping of the provisioned rules of an organization to their UID, see
+// getProvisionedRuleUids.
+type ruleUidsEntry struct {
+	mu      sync.Mutex
+	uids    map[string]string
+	fetched time.Time
+}
+
+type rulesPoller struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	entries map[string]*rulesPollerEntry
+	// unfiltered are the datasources rejecting filtered requests, see rules.
+	unfiltered sync.Map
+	// ruleUids are the mappings of rule UIDs per instance and organization, see ruleUids.
+	ruleUids sync.Map
+}
+
+func newRulesPoller(now func() time.Time) *rulesPoller {
+	return &rulesPoller{now: now, entries: make(map[string]*rulesPollerEntry)}
+}
+
+// rules returns the rules of the datasource of the instance matching the filter, fetched by this or another
+// check within the configured freshness window. Concurrent callers wait for a single request. Requests
+// aborted by the context of their caller are not shared. Datasources rejecting the filter are requested
+// unfiltered.
+func (p *rulesPoller) rules(ctx context.Context, instance string, client *resty.Client, orgId int, datasource string, filter url.Values, withUids bool) *rulesSnapshot {
+	freshness := config.Config.RulesPollingFreshness
+	datasourceKey := fmt.Sprintf("%s/%d/%s", instance, orgId, datasource)
+	if _, ok := p.unfiltered.Load(datasourceKey); ok {
+		filter = nil
+	}
+	entry := p.entry(datasourceKey+"?"+filter.Encode(), freshness)
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	snapshot := entry.snapshot
+	if snapshot == nil || freshness <= 0 || p.now().Sub(snapshot.fetched) >= freshness {
+		snapshot = fetchRules(ctx, client, orgId, datasource, filter, p.now())
+		if snapshot.statusCode == 400 && len(filter) > 0 {
+			p.unfiltered.Store(datasourceKey, true)
+			snapshot = fetchRules(ctx, client, orgId, datasource, nil, p.now())
+		}
+	}
+	if withUids && !snapshot.uidsAssigned && snapshot.err == nil && snapshot.statusCode == 200 {
+		assigned := *snapshot
+		assigned.uidsAssigned = true
+		if missesRuleUids(snapshot.response) {
+			assigned.response = copyAlertsStates(snapshot.response)
+			applyRuleUids(&assigned.response, p.ruleUidsOf(ctx, fmt.Sprintf("%s/%d", instance, orgId), client, orgId))
+		}
+		snapshot = &assigned
+	}
+	if ctx.Err() == nil {
+		entry.snapshot = snapshot
+	}
+	return snapshot
+}
+
+// ruleUidsOf returns the mapping of rule UIDs of the organization, retrieved at most once per discovery
+// interval. Otherwise every new snapshot of a datasource would request the provisioned rules again.
+func (p *rulesPoller) ruleUidsOf(ctx context.Context, key string, client *resty.Client, orgId int) map[string]string {
+	value, _ := p.ruleUids.LoadOrStore(key, &ruleUidsEntry{})
+	entry := value.(*ruleUidsEntry)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.uids != nil && p.now().Sub(entry.fetched) < discoveredRulesFreshness {
+		return entry.uids
+	}
+	if uids, ok := getProvisionedRuleUids(ctx, client, orgId); ok {
+		entry.uids, entry.fetched = uids, p.now()
+	}
+	return entry.uids
+}
+
+// entry returns the entry of the key, removing entries no check asked for during a while.
+func (p *rulesPoller) entry(key string, freshness time.Duration) *rulesPollerEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	for k, e := range p.entries {
+		if e.mu.TryLock() {
+			if e.snapshot != nil && now.Sub(e.snapshot.fetched) > max(time.Minute, 10*freshness) {
+				delete(p.entries, k)
+			}
+			e.mu.Unlock()
+		}
+	}
+
+	entry, ok := p.entries[key]
+	if !ok {
+		entry = &rulesPollerEntry{}
+		p.entries[key] = entry
+	}
+	return entry
+}
+
+func fetchRules(ctx context.Context, client *resty.Client, orgId int, datasource string, filter url.Values, now time.Time) *rulesSnapshot {
+	snapshot := &rulesSnapshot{fetched: now}
+	res, err := extgrafana.SetOrganization(client.R(), orgId).
+		SetContext(ctx).
+		SetQueryParamsFromValues(filter).
+		SetResult(&snapshot.response).
+		Get(rulesPath(datasource))
+	if err != nil {
+		snapshot.err = err
+		return snapshot
+	}
+	snapshot.statusCode = res.StatusCode()
+	snapshot.body = res.String()
+	return snapshot
+}
+
+// copyAlertsStates copies the groups and rules, so that they can be modified without affecting a
+// shared snapshot.
+func copyAlertsStates(response AlertsStates) AlertsStates {
+	groups := make([]AlertGroup, len(response.AlertsData.AlertsGroups))
+	for i, group := range response.AlertsData.AlertsGroups {
+		group.AlertsRules = append([]AlertRule(nil), group.AlertsRules...)
+		groups[i] = group
+	}
+	response.AlertsData.AlertsGroups = groups
+	return response
+}
@@ -0,0 +1,127 @@
+package extalertrules
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/steadybit/extension-grafana/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRulesPoller_SharesRequestsWithinFreshnessWindow(t *testing.T) {
+	config.Config.RulesPollingFreshness = time.Second
+	defer func() { config.Config.RulesPollingFreshness = 0 }()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	poller := newRulesPoller(clock)
+	var requests atomic.Int32
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		requests.Add(1)
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(`{"data":{"groups":[{"name":"g","rules":[{"name":"r1","state":"firing"}]}]}}`)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+
+	var wg sync.WaitGroup
+	for range 40 {
+		wg.Go(func() {
+			rules := poller.rules(context.Background(), "default", client, 1, "DS1", nil, false)
+			assert.NoError(t, rules.err)
+			assert.Equal(t, "r1", rules.response.AlertsData.AlertsGroups[0].AlertsRules[0].Name)
+		})
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), requests.Load(), "40 concurrent checks share one request")
+
+	poller.rules(context.Background(), "default", client, 1, "DS2", nil, false)
+	poller.rules(context.Background(), "default", client, 2, "DS1", nil, false)
+	assert.Equal(t, int32(3), requests.Load(), "other datasources and organizations are requested on their own")
+
+	mu.Lock()
+	now = now.Add(time.Second)
+	mu.Unlock()
+	poller.rules(context.Background(), "default", client, 1, "DS1", nil, false)
+	poller.rules(context.Background(), "default", client, 1, "DS1", nil, false)
+	assert.Equal(t, int32(4), requests.Load(), "rules are fetched again once outdated")
+}
+
+func TestRulesPoller_DoesNotShareCanceledRequests(t *testing.T) {
+	config.Config.RulesPollingFreshness = time.Minute
+	defer func() { config.Config.RulesPollingFreshness = 0 }()
+
+	poller := newRulesPoller(time.Now)
+	requests := 0
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		requests++
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(`{"data":{"groups":[]}}`)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Error(t, poller.rules(ctx, "default", client, 1, "DS1", nil, false).err)
+
+	assert.NoError(t, poller.rules(context.Background(), "default", client, 1, "DS1", nil, false).err)
+	assert.Equal(t, 2, requests)
+}
+
+func TestRulesPoller_KeysByInstanceAndReusesRuleUids(t *testing.T) {
+	config.Config.RulesPollingFreshness = time.Second
+	defer func() { config.Config.RulesPollingFreshness = 0 }()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	poller := newRulesPoller(func() time.Time { return now })
+	var rules, provisioned atomic.Int32
+	transport := func(req *http.Request) (*http.Response, error) {
+		body := `{"data":{"groups":[{"name":"g","folderUid":"f","rules":[{"name":"r1","state":"firing"}]}]}}`
+		if req.URL.Path == "/api/v1/provisioning/alert-rules" {
+			provisioned.Add(1)
+			body = `[{"uid":"uid-r1","folderUID":"f","ruleGroup":"g","title":"r1"}]`
+		} else {
+			rules.Add(1)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	}
+
+	poller.rules(context.Background(), "default", newTestClient(transport), 1, "grafana", nil, true)
+	snapshot := poller.rules(context.Background(), "default", newTestClient(transport), 1, "grafana", nil, true)
+	assert.Equal(t, "uid-r1", snapshot.response.AlertsData.AlertsGroups[0].AlertsRules[0].UID)
+	assert.Equal(t, int32(1), rules.Load(), "clients of the same instance share the rules")
+
+	poller.rules(context.Background(), "other", newTestClient(transport), 1, "grafana", nil, true)
+	assert.Equal(t, int32(2), rules.Load(), "other instances are requested on their own")
+	assert.Equal(t, int32(2), provisioned.Load())
+
+	for range 5 {
+		now = now.Add(time.Second)
+		snapshot = poller.rules(context.Background(), "default", newTestClient(transport), 1, "grafana", nil, true)
+		assert.Equal(t, "uid-r1", snapshot.response.AlertsData.AlertsGroups[0].AlertsRules[0].UID)
+	}
+	assert.Equal(t, int32(7), rules.Load())
+	assert.Equal(t, int32(2), provisioned.Load(), "the rule UIDs are not requested for every new snapshot")
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extalertrules
+
+import (
+	"fmt"
+
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/extension-kit/extutil"
+)
+
+// A rule whose query fails, e.g. because the attacked Prometheus is unreachable, keeps reporting its last
+// state, usually normal or inactive. Its health tells it apart: Grafana reports "error" or "nodata",
+// Prometheus "err".
+const (
+	unhealthyIgnore  = "ignore"
+	unhealthyFailure = "failure"
+	unhealthyFiring  = "firing"
+)
+
+func isUnhealthy(health string) bool {
+	return health == "error" || health == "err" || health == "nodata"
+}
+
+// treatUnhealthyAsFiring returns the rule as firing if it is unhealthy and the check is configured to
+// treat unhealthy rules as firing, and the rule as is otherwise.
+func treatUnhealthyAsFiring(state *AlertRuleCheckState, alertRule *AlertRule) *AlertRule {
+	if state.UnhealthyHandling != unhealthyFiring || !isUnhealthy(alertRule.Health) {
+		return alertRule
+	}
+	firing := *alertRule
+	firing.State = "firing"
+	return &firing
+}
+
+// checkRuleHealth fails the step if the rule was unhealthy and the check is configured to fail for
+// unhealthy rules. Unless failing early, this is only reported at the end of the step.
+func checkRuleHealth(state *AlertRuleCheckState, alertRule *AlertRule, completed bool) *action_kit_api.ActionKitError {
+	if state.UnhealthyHandling != unhealthyFailure {
+		return nil
+	}
+	if isUnhealthy(alertRule.Health) {
+		title := fmt.Sprintf("AlertRule '%s' has health '%s'.", alertRule.Name, alertRule.Health)
+		if alertRule.LastError != "" {
+			title = fmt.Sprintf("AlertRule '%s' has health '%s': %s", alertRule.Name, alertRule.Health, alertRule.LastError)
+		}
+		if state.FailEarly {
+			return new(action_kit_api.ActionKitError{Title: title, Status: extutil.Ptr(action_kit_api.Failed)})
+		}
+		if state.UnhealthyTitle == "" {
+			state.UnhealthyTitle = title
+		}
+	}
+	if completed && state.UnhealthyTitle != "" {
+		return new(action_kit_api.ActionKitError{Title: state.UnhealthyTitle, Status: extutil.Ptr(action_kit_api.Failed)})
+	}
+	return nil
+}
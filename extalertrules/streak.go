@@ -0,0 +1,59 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extalertrules
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	minStateDurationContinuous = "continuous"
+	minStateDurationCumulative = "cumulative"
+)
+
+// StateStreak tracks for how long the rule had an expected state, as observed by the polls of the
+// check. A streak starts with the first poll observing an expected state and lasts until the last poll
+// observing it before a poll observing another one. Single polls don't add up to any duration.
+type StateStreak struct {
+	Start      time.Time
+	LastMatch  time.Time
+	Longest    time.Duration
+	Cumulative time.Duration
+}
+
+// trackStreak records whether the rule has an expected state at this poll.
+func trackStreak(streak *StateStreak, matching bool, now time.Time) {
+	if !matching {
+		streak.Start = time.Time{}
+		return
+	}
+	if streak.Start.IsZero() {
+		streak.Start = now
+	} else {
+		streak.Cumulative += now.Sub(streak.LastMatch)
+	}
+	streak.LastMatch = now
+	streak.Longest = max(streak.Longest, now.Sub(streak.Start))
+}
+
+// heldLongEnough tells whether the rule had an expected state for the minimum duration of the check,
+// either continuously or in total.
+func heldLongEnough(state *AlertRuleCheckState) bool {
+	if state.MinStateDurationMode == minStateDurationCumulative {
+		return state.Streak.Cumulative >= state.MinStateDuration
+	}
+	return state.Streak.Longest >= state.MinStateDuration
+}
+
+func describeStreak(state *AlertRuleCheckState) string {
+	if state.MinStateDurationMode == minStateDurationCumulative {
+		return fmt.Sprintf("%s in total (longest streak %s)", state.Streak.Cumulative.Round(time.Second), state.Streak.Longest.Round(time.Second))
+	}
+	return fmt.Sprintf("%s continuously", state.Streak.Longest.Round(time.Second))
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extalertrules
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+)
+
+// StateTransition is an entry of the timeline of the checked rule, recorded whenever its state, health,
+// error or the number of its firing or pending instances changes.
+type StateTransition struct {
+	Timestamp        time.Time `json:"timestamp"`
+	State            string    `json:"state"`
+	Health           string    `json:"health,omitempty"`
+	Instances        int       `json:"instances"`
+	FiringInstances  int       `json:"firingInstances"`
+	PendingInstances int       `json:"pendingInstances"`
+	Error            string    `json:"error,omitempty"`
+}
+
+func newStateTransition(alertRule *AlertRule, now time.Time) StateTransition {
+	transition := StateTransition{
+		Timestamp: now,
+		State:     alertRule.State,
+		Health:    alertRule.Health,
+		Instances: len(alertRule.Alerts),
+		Error:     alertRule.LastError,
+	}
+	for _, alert := range alertRule.Alerts {
+		switch normalizeInstanceState(alert.State) {
+		case "firing":
+			transition.FiringInstances++
+		case "pending":
+			transition.PendingInstances++
+		}
+	}
+	return transition
+}
+
+// recordTransition appends the current state to the timeline, unless it equals the last recorded one.
+func recordTransition(state *AlertRuleCheckState, alertRule *AlertRule, now time.Time) {
+	transition := newStateTransition(alertRule, now)
+	if n := len(state.Timeline); n > 0 {
+		last := state.Timeline[n-1]
+		last.Timestamp = transition.Timestamp
+		if last == transition {
+			return
+		}
+	}
+	state.Timeline = append(state.Timeline, transition)
+}
+
+var unsafeFileNameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// timelineArtifacts exports the timeline as JSON and CSV, to be archived with the experiment run.
+func timelineArtifacts(state *AlertRuleCheckState) *action_kit_api.Artifacts {
+	name := unsafeFileNameChars.ReplaceAllString(state.AlertRuleName, "_")
+
+	jsonData, err := json.MarshalIndent(state.Timeline, "", "  ")
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to export the alert rule state timeline as JSON.")
+		return nil
+	}
+
+	var csvData bytes.Buffer
+	writer := csv.NewWriter(&csvData)
+	_ = writer.Write([]string{"timestamp", "state", "health", "instances", "firingInstances", "pendingInstances", "error"})
+	for _, transition := range state.Timeline {
+		_ = writer.Write([]string{
+			transition.Timestamp.UTC().Format(time.RFC3339Nano),
+			transition.State,
+			transition.Health,
+			strconv.Itoa(transition.Instances),
+			strconv.Itoa(transition.FiringInstances),
+			strconv.Itoa(transition.PendingInstances),
+			transition.Error,
+		})
+	}
+	writer.Flush()
+
+	return &action_kit_api.Artifacts{
+		{
+			Label: fmt.Sprintf("alert-rule-timeline-%s.json", name),
+			Data:  base64.StdEncoding.EncodeToString(jsonData),
+		},
+		{
+			Label: fmt.Sprintf("alert-rule-timeline-%s.csv", name),
+			Data:  base64.StdEncoding.EncodeToString(csvData.Bytes()),
+		},
+	}
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extalertrules
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+)
+
+// tolerateUnavailable reports a failed poll as unknown state of the rule, unless the tolerance is
+// exceeded. The step is not completed by a failed poll, as its outcome can't be evaluated.
+func tolerateUnavailable(state *AlertRuleCheckState, err error, baseUrl string, now time.Time) (*action_kit_api.StatusResult, error) {
+	if exceeded := state.ApiErrors.Tolerate(err); exceeded != nil {
+		return nil, exceeded
+	}
+	log.Warn().Err(err).Msgf("Tolerating failure %d in a row to retrieve the state of alert rule %s.", state.ApiErrors.Consecutive, state.AlertRuleName)
+
+	unknown := &AlertRule{Name: state.AlertRuleName, State: "unknown", LastError: err.Error()}
+	recordTransition(state, unknown, now)
+	metric := toMetric(state, unknown, baseUrl, now)
+	metric.Metric["tooltip"] = fmt.Sprintf("Alert rule state is unknown, failed to retrieve it from Grafana (%d of %d polls failed): %s",
+		state.ApiErrors.Failures, state.ApiErrors.Polls, err.Error())
+	return &action_kit_api.StatusResult{
+		Metrics: &[]action_kit_api.Metric{*metric},
+	}, nil
+}
+
+// IsRetryable is the retry condition of the Grafana clients. Only reads of the rules and the provisioning
+// API are retried, as they are idempotent and answer with the same result when retried. Other requests
+// may have side effects, e.g. send a test notification, or answer 5xx on purpose, like the health check
+// of an unhealthy datasource. Transient errors of those are tolerated by the checks instead.
+func IsRetryable(res *resty.Response, err error) bool {
+	if res == nil || res.Request == nil || res.Request.Method != http.MethodGet {
+		return false
+	}
+	u, parseErr := url.Parse(res.Request.URL)
+	if parseErr != nil || !(strings.HasSuffix(u.Path, "/api/v1/rules") || strings.HasPrefix(u.Path, "/api/v1/provisioning/")) {
+		return false
+	}
+	return err != nil || res.StatusCode() == http.StatusTooManyRequests || res.StatusCode() >= http.StatusInternalServerError
+}
@@ -0,0 +1,48 @@
+package extalertrules
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRetryable_RetriesReadsOfRulesOnly(t *testing.T) {
+	var requests atomic.Int32
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		requests.Add(1)
+		if req.URL.Path == "/api/prometheus/prom/api/v1/rules" {
+			return nil, errors.New("connection reset")
+		}
+		return &http.Response{StatusCode: 503, Body: http.NoBody}, nil
+	})
+	client.SetBaseURL("http://grafana.local")
+	client.SetRetryCount(2)
+	client.SetRetryWaitTime(time.Millisecond)
+	client.AddRetryCondition(IsRetryable)
+
+	requests.Store(0)
+	_, err := client.R().Get("/api/prometheus/prom/api/v1/rules")
+	require.Error(t, err)
+	assert.Equal(t, int32(3), requests.Load(), "rules are requested again")
+
+	requests.Store(0)
+	res, err := client.R().Get("/api/v1/provisioning/alert-rules")
+	require.NoError(t, err)
+	assert.Equal(t, 503, res.StatusCode())
+	assert.Equal(t, int32(3), requests.Load(), "provisioned rules are requested again")
+
+	requests.Store(0)
+	_, err = client.R().Get("/api/datasources/uid/prom/health")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), requests.Load(), "503 is the answer of an unhealthy datasource")
+
+	requests.Store(0)
+	_, err = client.R().Post("/api/alertmanager/grafana/config/api/v1/receivers/test")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), requests.Load(), "test notifications are not sent again")
+}
@@ -7,23 +7,15 @@
 
 package extalertrules
 
-type DataSource struct {
-	ID          int    `json:"id"`
-	UID         string `json:"uid"`
-	OrgID       int    `json:"orgId"`
-	Name        string `json:"name"`
-	Type        string `json:"type"`
-	TypeName    string `json:"typeName"`
-	TypeLogoUrl string `json:"typeLogoUrl"`
-	Access      string `json:"access"`
-	URL         string `json:"url"`
-	User        string `json:"user"`
-	Database    string `json:"database"`
-	BasicAuth   bool   `json:"basicAuth"`
-	IsDefault   bool   `json:"isDefault"`
-	JsonData    any    `json:"jsonData"`
-	ReadOnly    bool   `json:"readOnly"`
-}
+import (
+	"time"
+
+	"github.com/steadybit/extension-grafana/extgrafana"
+)
+
+// DataSource is kept for compatibility, datasources are requested through extgrafana.
+type DataSource = extgrafana.DataSource
+
 type AlertsStates struct {
 	AlertsData AlertsData `json:"data"`
 	Status     string     `json:"status"`
@@ -34,13 +26,58 @@ type AlertsData struct {
 }
 
 type AlertGroup struct {
-	Name        string      `json:"name"`
+	Name string `json:"name"`
+	// File is the folder of Grafana-managed rules, or the namespace of datasource-managed rules.
+	File string `json:"file,omitempty"`
+	// FolderUID is the folder of Grafana-managed rules, reported by recent Grafana versions only.
+	FolderUID   string      `json:"folderUid,omitempty"`
 	AlertsRules []AlertRule `json:"rules,omitempty"`
 }
 
 type AlertRule struct {
+	// UID is only reported for Grafana-managed rules, and only by recent Grafana versions.
+	UID    string `json:"uid,omitempty"`
 	State  string `json:"state"`
 	Name   string `json:"name"`
 	Health string `json:"health"`
 	Type   string `json:"type"`
+	Query  string `json:"query,omitempty"`
+	// Duration is the 'for' of the rule in seconds.
+	Duration    float64           `json:"duration,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	LastError   string            `json:"lastError,omitempty"`
+	// EvaluationTime is the time the last evaluation took, in seconds.
+	EvaluationTime float64 `json:"evaluationTime,omitempty"`
+	// Alerts are the instances of the rule, one per label set the query returned.
+	Alerts []Alert `json:"alerts,omitempty"`
+}
+
+type Alert struct {
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	State       string            `json:"state"`
+	ActiveAt    *time.Time        `json:"activeAt,omitempty"`
+	Value       string            `json:"value,omitempty"`
+}
+
+// ProvisionedAlertRule is a Grafana-managed alert rule as returned by the provisioning API.
+type ProvisionedAlertRule struct {
+	UID       string `json:"uid"`
+	Title     string `json:"title"`
+	RuleGroup string `json:"ruleGroup"`
+	FolderUID string `json:"folderUID"`
+}
+
+// AlertmanagerAlert is an alert instance as returned by the Alertmanager API of Grafana.
+type AlertmanagerAlert struct {
+	Labels      map[string]string       `json:"labels"`
+	Annotations map[string]string       `json:"annotations"`
+	StartsAt    time.Time               `json:"startsAt"`
+	Fingerprint string                  `json:"fingerprint"`
+	Status      AlertmanagerAlertStatus `json:"status"`
+}
+
+type AlertmanagerAlertStatus struct {
+	State string `json:"state"`
 }
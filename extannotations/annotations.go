@@ -22,6 +22,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/steadybit/event-kit/go/event_kit_api"
 	"github.com/steadybit/extension-grafana/config"
+	"github.com/steadybit/extension-grafana/extgrafana"
 	extension_kit "github.com/steadybit/extension-kit"
 	"github.com/steadybit/extension-kit/exthttp"
 	"github.com/steadybit/extension-kit/extsignals"
@@ -135,10 +136,21 @@ func (w *annotationWorker) drain(timeout time.Duration) {
 	}
 }
 
+// send hands the annotation to every instance in turn. Each instance gets its own timeout, so an
+// unresponsive instance cannot use up the time of the others, and its own copy of the annotation,
+// as patching resolves the annotation id per instance.
 func (w *annotationWorker) send(ctx context.Context, annotation *AnnotationBody) {
+	for _, instance := range Instances {
+		instanceAnnotation := *annotation
+		sendAnnotationsWithTimeout(ctx, instance, &instanceAnnotation)
+	}
+}
+
+func sendAnnotationsWithTimeout(ctx context.Context, instance extgrafana.Instance, annotation *AnnotationBody) {
 	ctx, cancel := context.WithTimeout(ctx, annotationTimeout)
 	defer cancel()
-	sendAnnotations(ctx, RestyClient, annotation)
+	log.Debug().Msgf("Sending annotation to Grafana instance %s", instance.Name)
+	sendAnnotations(ctx, instance.Client, annotation)
 }
 
 // enqueue hands the annotation over to the worker, dropping it when the queue is saturated. It
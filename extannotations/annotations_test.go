@@ -17,6 +17,7 @@ import (
 	"github.com/go-resty/resty/v2"
 	"github.com/google/uuid"
 	"github.com/jarcoal/httpmock"
+	"github.com/steadybit/extension-grafana/extgrafana"
 	"github.com/steadybit/extension-kit/extutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -29,8 +30,8 @@ func TestHandleDoesNotBlockOnGrafana(t *testing.T) {
 	worker := newAnnotationWorker(annotationQueueSize)
 
 	blocked := make(chan struct{})
-	RestyClient = resty.New()
-	httpmock.ActivateNonDefault(RestyClient.GetClient())
+	Instances = []extgrafana.Instance{{Name: "default", Client: resty.New()}}
+	httpmock.ActivateNonDefault(Instances[0].Client.GetClient())
 	defer httpmock.DeactivateAndReset()
 	httpmock.RegisterResponder("GET", "/api/annotations",
 		func(*http.Request) (*http.Response, error) {
@@ -108,13 +109,35 @@ func TestEnqueueDropsWhenQueueIsFull(t *testing.T) {
 	require.Len(t, worker.queue, 4)
 }
 
+// TestSendAnnotationsToEveryInstance makes sure every configured instance gets its own annotation.
+func TestSendAnnotationsToEveryInstance(t *testing.T) {
+	worker := newAnnotationWorker(annotationQueueSize)
+
+	prod := resty.New().SetBaseURL("http://grafana-prod.local")
+	staging := resty.New().SetBaseURL("http://grafana-staging.local")
+	httpmock.ActivateNonDefault(prod.GetClient())
+	staging.SetTransport(prod.GetClient().Transport)
+	defer httpmock.DeactivateAndReset()
+	Instances = []extgrafana.Instance{{Name: "prod", Client: prod}, {Name: "staging", Client: staging}}
+	defer func() { Instances = nil }()
+	httpmock.RegisterResponder("POST", "http://grafana-prod.local/api/annotations",
+		httpmock.NewStringResponder(200, `{"id":1}`))
+	httpmock.RegisterResponder("POST", "http://grafana-staging.local/api/annotations",
+		httpmock.NewStringResponder(200, `{"id":1}`))
+
+	worker.send(t.Context(), &AnnotationBody{Tags: []string{"tag1"}})
+
+	require.Equal(t, 1, httpmock.GetCallCountInfo()["POST http://grafana-prod.local/api/annotations"])
+	require.Equal(t, 1, httpmock.GetCallCountInfo()["POST http://grafana-staging.local/api/annotations"])
+}
+
 // TestDrainWaitsForQueuedAnnotations covers the shutdown path: a rolling restart must not discard
 // annotations that are still queued.
 func TestDrainWaitsForQueuedAnnotations(t *testing.T) {
 	worker := newAnnotationWorker(annotationQueueSize)
 
-	RestyClient = resty.New()
-	httpmock.ActivateNonDefault(RestyClient.GetClient())
+	Instances = []extgrafana.Instance{{Name: "default", Client: resty.New()}}
+	httpmock.ActivateNonDefault(Instances[0].Client.GetClient())
 	defer httpmock.DeactivateAndReset()
 	httpmock.RegisterResponder("POST", "/api/annotations",
 		func(*http.Request) (*http.Response, error) {
@@ -139,8 +162,8 @@ func TestDrainWaitsForQueuedAnnotations(t *testing.T) {
 func TestDrainWaitsForAnInFlightAnnotation(t *testing.T) {
 	worker := newAnnotationWorker(annotationQueueSize)
 
-	RestyClient = resty.New()
-	httpmock.ActivateNonDefault(RestyClient.GetClient())
+	Instances = []extgrafana.Instance{{Name: "default", Client: resty.New()}}
+	httpmock.ActivateNonDefault(Instances[0].Client.GetClient())
 	defer httpmock.DeactivateAndReset()
 
 	inFlight := make(chan struct{})
@@ -7,6 +7,7 @@
 
 package extannotations
 
-import "github.com/go-resty/resty/v2"
+import "github.com/steadybit/extension-grafana/extgrafana"
 
-var RestyClient *resty.Client
+// Instances are the Grafana instances annotations are sent to.
+var Instances []extgrafana.Instance
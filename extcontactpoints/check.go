@@ -0,0 +1,276 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extcontactpoints
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/action-kit/go/action_kit_sdk"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	extension_kit "github.com/steadybit/extension-kit"
+	"github.com/steadybit/extension-kit/extbuild"
+	"github.com/steadybit/extension-kit/extutil"
+)
+
+// redacted is the value of secure settings of integrations as returned by the provisioning API.
+const redacted = "[REDACTED]"
+
+const defaultSummary = "Test notification sent by Steadybit to verify that alert notifications are delivered."
+
+// receiverTestTimeout bounds the test of the integrations. Grafana waits up to 15s for them by default and
+// up to 30s if asked to, so the client must not give up before Grafana reports their outcome.
+const receiverTestTimeout = 35 * time.Second
+
+type ContactPointReachabilityCheckAction struct{}
+
+// Make sure action implements all required interfaces
+var (
+	_ action_kit_sdk.Action[ContactPointReachabilityCheckState] = (*ContactPointReachabilityCheckAction)(nil)
+)
+
+type ContactPointReachabilityCheckState struct {
+	// Instance is the name of the Grafana instance the target was discovered from.
+	Instance string
+	// OrgId is the organization the contact point belongs to, 0 for the organization of the service token.
+	OrgId            int
+	ContactPointName string
+	Summary          string
+	ExecutionId      string
+}
+
+func NewContactPointReachabilityCheckAction() action_kit_sdk.Action[ContactPointReachabilityCheckState] {
+	return &ContactPointReachabilityCheckAction{}
+}
+
+func (m *ContactPointReachabilityCheckAction) NewEmptyState() ContactPointReachabilityCheckState {
+	return ContactPointReachabilityCheckState{}
+}
+
+func (m *ContactPointReachabilityCheckAction) Describe() action_kit_api.ActionDescription {
+	return action_kit_api.ActionDescription{
+		Id:          fmt.Sprintf("%s.reachability", TargetType),
+		Label:       "Contact Point Reachability Check",
+		Description: "sends a test notification through all integrations of the contact point and fails when one can't be delivered.",
+		Version:     extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:        new(targetIcon),
+		TargetSelection: new(action_kit_api.TargetSelection{
+			TargetType:          TargetType,
+			QuantityRestriction: extutil.Ptr(action_kit_api.QuantityRestrictionAll),
+			SelectionTemplates: new([]action_kit_api.TargetSelectionTemplate{
+				{
+					Label:       "contact point name",
+					Description: new("Find contact point by name"),
+					Query:       "grafana.contact-point.name=\"\"",
+				},
+			}),
+		}),
+		Technology: new("Grafana"),
+
+		Kind:        action_kit_api.Check,
+		TimeControl: action_kit_api.TimeControlInstantaneous,
+		Parameters: []action_kit_api.ActionParameter{
+			{
+				Name:         "summary",
+				Label:        "Summary",
+				Description:  new("The summary of the test notification, telling its recipients that it is a test."),
+				Type:         action_kit_api.ActionParameterTypeString,
+				DefaultValue: new(defaultSummary),
+				Order:        new(1),
+				Required:     new(false),
+			},
+		},
+	}
+}
+
+func (m *ContactPointReachabilityCheckAction) Prepare(_ context.Context, state *ContactPointReachabilityCheckState, request action_kit_api.PrepareActionRequestBody) (*action_kit_api.PrepareResult, error) {
+	name := extgrafana.FirstAttribute(request.Target.Attributes, "grafana.contact-point.name")
+	if name == "" {
+		return nil, new(extension_kit.ToError("Target is missing the 'grafana.contact-point.name' attribute.", nil))
+	}
+
+	instance, err := extgrafana.FindInstance(Instances, extgrafana.FirstAttribute(request.Target.Attributes, "grafana.instance"), extgrafana.FirstAttribute(request.Target.Attributes, "grafana.host"))
+	if err != nil {
+		return nil, new(extension_kit.ToError("Failed to resolve the Grafana instance of the target.", err))
+	}
+
+	if orgId := extgrafana.FirstAttribute(request.Target.Attributes, "grafana.org.id"); orgId != "" {
+		state.OrgId, err = strconv.Atoi(orgId)
+		if err != nil {
+			return nil, new(extension_kit.ToError(fmt.Sprintf("Target has an invalid 'grafana.org.id' attribute '%s'.", orgId), err))
+		}
+	}
+
+	state.Summary = defaultSummary
+	if summary, ok := request.Config["summary"].(string); ok && summary != "" {
+		state.Summary = summary
+	}
+	state.Instance = instance.Name
+	state.ContactPointName = name
+	state.ExecutionId = request.ExecutionId.String()
+	return nil, nil
+}
+
+func (m *ContactPointReachabilityCheckAction) Start(ctx context.Context, state *ContactPointReachabilityCheckState) (*action_kit_api.StartResult, error) {
+	instance, err := extgrafana.FindInstance(Instances, state.Instance, "")
+	if err != nil {
+		return nil, extension_kit.ToError("Failed to resolve the Grafana instance of the target.", err)
+	}
+	return ContactPointReachabilityCheck(ctx, state, instance.Client, instance.NewClient(receiverTestTimeout))
+}
+
+// ContactPointReachabilityCheck sends a test notification through the current integrations of the
+// contact point. Failing to deliver it fails the check, failing to request the test errors it. The test is
+// sent through testClient, which must not retry, as every attempt sends another notification. Integrations
+// that time out may still deliver the notification, so their outcome is reported as unknown.
+func ContactPointReachabilityCheck(ctx context.Context, state *ContactPointReachabilityCheckState, client *resty.Client, testClient *resty.Client) (*action_kit_api.StartResult, error) {
+	contactPoints, err := getContactPoints(ctx, client, state.OrgId, state.ContactPointName)
+	if err != nil {
+		return nil, extension_kit.ToError(fmt.Sprintf("Failed to retrieve contact point %s.", state.ContactPointName), err)
+	}
+	if len(contactPoints) == 0 {
+		return nil, extension_kit.ToError(fmt.Sprintf("Contact point %s not found.", state.ContactPointName), nil)
+	}
+
+	res, err := extgrafana.SetOrganization(testClient.R(), state.OrgId).
+		SetContext(ctx).
+		SetBody(testRequest(state, contactPoints)).
+		Post("/api/alertmanager/grafana/config/api/v1/receivers/test")
+	if err != nil && isTimeout(err) {
+		return &action_kit_api.StartResult{
+			Messages: &[]action_kit_api.Message{{
+				Level:   extutil.Ptr(action_kit_api.Warn),
+				Message: fmt.Sprintf("Grafana didn't report the outcome of the test notification through contact point %s in time: %s", state.ContactPointName, err.Error()),
+			}},
+			Error: new(action_kit_api.ActionKitError{
+				Title:  fmt.Sprintf("Delivery of the test notification through contact point '%s' is unknown, the test timed out.", state.ContactPointName),
+				Status: extutil.Ptr(action_kit_api.Errored),
+			}),
+		}, nil
+	}
+	if err != nil {
+		return nil, extension_kit.ToError(fmt.Sprintf("Failed to test contact point %s.", state.ContactPointName), err)
+	}
+	// Grafana responds with the outcome per integration, with 207, 400 or 408 if some of them failed
+	var result TestReceiversResult
+	_ = json.Unmarshal(res.Body(), &result)
+	if len(result.Receivers) == 0 {
+		return nil, extension_kit.ToError(fmt.Sprintf("Failed to test contact point %s, status code %d: %s", state.ContactPointName, res.StatusCode(), res.String()), nil)
+	}
+
+	messages := make([]action_kit_api.Message, 0, len(contactPoints))
+	failures := make([]string, 0)
+	unknowns := make([]string, 0)
+	for _, receiver := range result.Receivers {
+		for _, integration := range receiver.Integrations {
+			if integration.Status == "ok" {
+				messages = append(messages, action_kit_api.Message{
+					Level:   extutil.Ptr(action_kit_api.Info),
+					Message: fmt.Sprintf("Delivered test notification through %s.", describeIntegration(contactPoints, integration.UID)),
+				})
+				continue
+			}
+			if res.StatusCode() == http.StatusRequestTimeout || isTimeoutError(integration.Error) {
+				unknown := fmt.Sprintf("%s: %s", describeIntegration(contactPoints, integration.UID), integration.Error)
+				unknowns = append(unknowns, unknown)
+				messages = append(messages, action_kit_api.Message{
+					Level:   extutil.Ptr(action_kit_api.Warn),
+					Message: fmt.Sprintf("Test notification through %s timed out, it may still be delivered.", unknown),
+				})
+				continue
+			}
+			failure := fmt.Sprintf("%s: %s", describeIntegration(contactPoints, integration.UID), integration.Error)
+			failures = append(failures, failure)
+			messages = append(messages, action_kit_api.Message{
+				Level:   extutil.Ptr(action_kit_api.Error),
+				Message: fmt.Sprintf("Failed to deliver test notification through %s.", failure),
+			})
+		}
+	}
+
+	startResult := &action_kit_api.StartResult{Messages: &messages}
+	if len(failures) > 0 {
+		startResult.Error = new(action_kit_api.ActionKitError{
+			Title:  fmt.Sprintf("Contact point '%s' failed to deliver the test notification: %s", state.ContactPointName, strings.Join(failures, "; ")),
+			Status: extutil.Ptr(action_kit_api.Failed),
+		})
+	} else if len(unknowns) > 0 {
+		startResult.Error = new(action_kit_api.ActionKitError{
+			Title:  fmt.Sprintf("Delivery of the test notification through contact point '%s' is unknown: %s", state.ContactPointName, strings.Join(unknowns, "; ")),
+			Status: extutil.Ptr(action_kit_api.Errored),
+		})
+	}
+	return startResult, nil
+}
+
+// isTimeout tells whether the test request timed out before Grafana reported the outcome.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// isTimeoutError tells whether Grafana reports that the test of an integration timed out, as opposed to
+// e.g. a refused connection.
+func isTimeoutError(message string) bool {
+	return strings.Contains(message, "context deadline exceeded") || strings.Contains(message, "timed out")
+}
+
+// testRequest tests all integrations of the contact point. Redacted secure settings are marked as secure
+// fields instead, so that Grafana uses the ones it stored for the integration.
+func testRequest(state *ContactPointReachabilityCheckState, contactPoints []ContactPoint) TestReceiversRequest {
+	receiver := TestReceiver{Name: state.ContactPointName, Integrations: make([]TestReceiverConfig, 0, len(contactPoints))}
+	for _, cp := range contactPoints {
+		settings := make(map[string]any, len(cp.Settings))
+		maps.Copy(settings, cp.Settings)
+		secureFields := make(map[string]bool)
+		for key, value := range settings {
+			if value == redacted {
+				delete(settings, key)
+				secureFields[key] = true
+			}
+		}
+		receiver.Integrations = append(receiver.Integrations, TestReceiverConfig{
+			UID:                   cp.UID,
+			Name:                  cp.Name,
+			Type:                  cp.Type,
+			DisableResolveMessage: cp.DisableResolveMessage,
+			Settings:              settings,
+			SecureFields:          secureFields,
+		})
+	}
+	labels := map[string]string{"alertname": "SteadybitTestNotification"}
+	if state.ExecutionId != "" {
+		labels["steadybit_execution_id"] = state.ExecutionId
+	}
+	return TestReceiversRequest{
+		Receivers: []TestReceiver{receiver},
+		Alert: TestAlert{
+			Labels:      labels,
+			Annotations: map[string]string{"summary": state.Summary},
+		},
+	}
+}
+
+func describeIntegration(contactPoints []ContactPoint, uid string) string {
+	for _, cp := range contactPoints {
+		if cp.UID == uid {
+			return fmt.Sprintf("%s integration %s", cp.Type, uid)
+		}
+	}
+	return fmt.Sprintf("integration %s", uid)
+}
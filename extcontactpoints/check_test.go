@@ -0,0 +1,141 @@
+package extcontactpoints
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/google/uuid"
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareExtractsState(t *testing.T) {
+	Instances = []extgrafana.Instance{{Name: "default", BaseUrl: "http://grafana.local"}}
+	defer func() { Instances = nil }()
+
+	action := ContactPointReachabilityCheckAction{}
+	state := action.NewEmptyState()
+	executionId := uuid.New()
+	_, err := action.Prepare(context.Background(), &state, action_kit_api.PrepareActionRequestBody{
+		Config:      map[string]any{},
+		ExecutionId: executionId,
+		Target: new(action_kit_api.Target{
+			Attributes: map[string][]string{
+				"grafana.contact-point.name": {"team-shop"},
+				"grafana.instance":           {"default"},
+				"grafana.org.id":             {"2"},
+			},
+		}),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "default", state.Instance)
+	assert.Equal(t, 2, state.OrgId)
+	assert.Equal(t, "team-shop", state.ContactPointName)
+	assert.Equal(t, defaultSummary, state.Summary)
+	assert.Equal(t, executionId.String(), state.ExecutionId)
+}
+
+func testClient(t *testing.T, statusCode int, result string, sent *TestReceiversRequest) RoundTripperFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/api/v1/provisioning/contact-points":
+			assert.Equal(t, "team-shop", req.URL.Query().Get("name"))
+			return response(200, `[
+				{"uid":"slack-1","name":"team-shop","type":"slack","settings":{"recipient":"#shop","token":"[REDACTED]"}},
+				{"uid":"mail-1","name":"team-shop","type":"email","settings":{"addresses":"shop@example.com"}}
+			]`), nil
+		case "/api/alertmanager/grafana/config/api/v1/receivers/test":
+			body, _ := io.ReadAll(req.Body)
+			require.NoError(t, json.Unmarshal(body, sent))
+			return response(statusCode, result), nil
+		}
+		return response(404, "not found"), nil
+	}
+}
+
+func TestContactPointReachabilityCheck_Delivered(t *testing.T) {
+	var sent TestReceiversRequest
+	client := newTestClient(testClient(t, 200, `{"receivers":[{"name":"team-shop","grafana_managed_receiver_configs":[
+		{"uid":"slack-1","name":"team-shop","status":"ok"},
+		{"uid":"mail-1","name":"team-shop","status":"ok"}
+	]}]}`, &sent))
+	state := &ContactPointReachabilityCheckState{ContactPointName: "team-shop", Summary: defaultSummary}
+
+	result, err := ContactPointReachabilityCheck(context.Background(), state, client, client)
+	require.NoError(t, err)
+	assert.Nil(t, result.Error)
+	assert.Len(t, *result.Messages, 2)
+
+	require.Len(t, sent.Receivers, 1)
+	slack := sent.Receivers[0].Integrations[0]
+	assert.Equal(t, "slack-1", slack.UID)
+	assert.Equal(t, map[string]any{"recipient": "#shop"}, slack.Settings, "redacted settings are not sent")
+	assert.Equal(t, map[string]bool{"token": true}, slack.SecureFields, "stored secure settings are used instead")
+	assert.Equal(t, defaultSummary, sent.Alert.Annotations["summary"])
+}
+
+func TestContactPointReachabilityCheck_NotDelivered(t *testing.T) {
+	var sent TestReceiversRequest
+	client := newTestClient(testClient(t, 207, `{"receivers":[{"name":"team-shop","grafana_managed_receiver_configs":[
+		{"uid":"slack-1","name":"team-shop","status":"failed","error":"dial tcp: i/o timeout"},
+		{"uid":"mail-1","name":"team-shop","status":"ok"}
+	]}]}`, &sent))
+	state := &ContactPointReachabilityCheckState{ContactPointName: "team-shop", Summary: defaultSummary}
+
+	result, err := ContactPointReachabilityCheck(context.Background(), state, client, client)
+	require.NoError(t, err)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Contact point 'team-shop' failed to deliver the test notification: slack integration slack-1: dial tcp: i/o timeout", result.Error.Title)
+	assert.Equal(t, action_kit_api.Failed, *result.Error.Status)
+}
+
+func TestContactPointReachabilityCheck_TestRejected(t *testing.T) {
+	var sent TestReceiversRequest
+	client := newTestClient(testClient(t, 403, `{"message":"permissions needed: alert.notifications:write"}`, &sent))
+	state := &ContactPointReachabilityCheckState{ContactPointName: "team-shop", Summary: defaultSummary}
+
+	_, err := ContactPointReachabilityCheck(context.Background(), state, client, client)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status code 403")
+}
+
+func TestContactPointReachabilityCheck_IntegrationTimedOut(t *testing.T) {
+	var sent TestReceiversRequest
+	client := newTestClient(testClient(t, 408, `{"receivers":[{"name":"team-shop","grafana_managed_receiver_configs":[
+		{"uid":"slack-1","name":"team-shop","status":"failed","error":"the receiver timed out: context deadline exceeded"},
+		{"uid":"mail-1","name":"team-shop","status":"ok"}
+	]}]}`, &sent))
+	state := &ContactPointReachabilityCheckState{ContactPointName: "team-shop", Summary: defaultSummary}
+
+	result, err := ContactPointReachabilityCheck(context.Background(), state, client, client)
+	require.NoError(t, err)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Delivery of the test notification through contact point 'team-shop' is unknown: slack integration slack-1: the receiver timed out: context deadline exceeded", result.Error.Title)
+	assert.Equal(t, action_kit_api.Errored, *result.Error.Status)
+}
+
+func TestContactPointReachabilityCheck_TestTimedOutIsSentOnce(t *testing.T) {
+	var sent TestReceiversRequest
+	client := newTestClient(testClient(t, 200, "", &sent))
+	client.SetRetryCount(2).AddRetryCondition(func(*resty.Response, error) bool { return true })
+	var tests atomic.Int32
+	receiverTestClient := newTestClient(func(req *http.Request) (*http.Response, error) {
+		tests.Add(1)
+		return nil, context.DeadlineExceeded
+	})
+	state := &ContactPointReachabilityCheckState{ContactPointName: "team-shop", Summary: defaultSummary}
+
+	result, err := ContactPointReachabilityCheck(context.Background(), state, client, receiverTestClient)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), tests.Load())
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Delivery of the test notification through contact point 'team-shop' is unknown, the test timed out.", result.Error.Title)
+	assert.Equal(t, action_kit_api.Errored, *result.Error.Status)
+}
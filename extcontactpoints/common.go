@@ -0,0 +1,18 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extcontactpoints
+
+import "github.com/steadybit/extension-grafana/extgrafana"
+
+// Instances are the Grafana instances contact points are discovered from and tested against.
+var Instances []extgrafana.Instance
+
+const (
+	TargetType = "com.steadybit.extension_grafana.contact-point"
+	targetIcon = "data:image/svg+xml,%3Csvg%20width%3D%2224%22%20height%3D%2224%22%20viewBox%3D%220%200%2024%2024%22%20fill%3D%22none%22%20xmlns%3D%22http%3A%2F%2Fwww.w3.org%2F2000%2Fsvg%22%3E%0A%3Cpath%20fill-rule%3D%22evenodd%22%20clip-rule%3D%22evenodd%22%20d%3D%22M12%202C8.68629%202%206%204.68629%206%208V12.5858L4.29289%2014.2929C4.00689%2014.5789%203.92134%2015.009%204.07612%2015.3827C4.2309%2015.7564%204.59554%2016%205%2016H19C19.4045%2016%2019.7691%2015.7564%2019.9239%2015.3827C20.0787%2015.009%2019.9931%2014.5789%2019.7071%2014.2929L18%2012.5858V8C18%204.68629%2015.3137%202%2012%202ZM8%208C8%205.79086%209.79086%204%2012%204C14.2091%204%2016%205.79086%2016%208V13C16%2013.2652%2016.1054%2013.5196%2016.2929%2013.7071L16.5858%2014H7.41421L7.70711%2013.7071C7.89464%2013.5196%208%2013.2652%208%2013V8ZM10%2018C10%2019.1046%2010.8954%2020%2012%2020C13.1046%2020%2014%2019.1046%2014%2018H16C16%2020.2091%2014.2091%2022%2012%2022C9.79086%2022%208%2020.2091%208%2018H10Z%22%20fill%3D%22%231D2632%22%2F%3E%0A%3C%2Fsvg%3E%0A"
+)
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extcontactpoints
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_api"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_commons"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_sdk"
+	"github.com/steadybit/extension-grafana/config"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	"github.com/steadybit/extension-kit/extbuild"
+)
+
+type contactPointDiscovery struct {
+	lastTargets *extgrafana.LastTargetsByInstance
+}
+
+var (
+	_ discovery_kit_sdk.TargetDescriber    = (*contactPointDiscovery)(nil)
+	_ discovery_kit_sdk.AttributeDescriber = (*contactPointDiscovery)(nil)
+)
+
+func NewContactPointDiscovery() discovery_kit_sdk.TargetDiscovery {
+	discovery := &contactPointDiscovery{lastTargets: extgrafana.NewLastTargetsByInstance()}
+	return discovery_kit_sdk.NewCachedTargetDiscovery(discovery,
+		discovery_kit_sdk.WithRefreshTargetsNow(),
+		discovery_kit_sdk.WithRefreshTargetsInterval(context.Background(), 1*time.Minute),
+	)
+}
+
+func (d *contactPointDiscovery) Describe() discovery_kit_api.DiscoveryDescription {
+	return discovery_kit_api.DiscoveryDescription{
+		Id: TargetType,
+		Discover: discovery_kit_api.DescribingEndpointReferenceWithCallInterval{
+			CallInterval: new("1m"),
+		},
+	}
+}
+
+func (d *contactPointDiscovery) DescribeTarget() discovery_kit_api.TargetDescription {
+	return discovery_kit_api.TargetDescription{
+		Id:       TargetType,
+		Label:    discovery_kit_api.PluralLabel{One: "Grafana Contact Point", Other: "Grafana Contact Points"},
+		Category: new("monitoring"),
+		Version:  extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:     new(targetIcon),
+		Table: discovery_kit_api.Table{
+			Columns: []discovery_kit_api.Column{
+				{Attribute: "grafana.contact-point.name"},
+				{Attribute: "grafana.contact-point.type"},
+				{Attribute: "grafana.instance"},
+			},
+			OrderBy: []discovery_kit_api.OrderBy{
+				{
+					Attribute: "grafana.contact-point.name",
+					Direction: "ASC",
+				},
+			},
+		},
+	}
+}
+
+func (d *contactPointDiscovery) DescribeAttributes() []discovery_kit_api.AttributeDescription {
+	return []discovery_kit_api.AttributeDescription{
+		{
+			Attribute: "grafana.contact-point.name",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Contact point",
+				Other: "Contact points",
+			},
+		}, {
+			Attribute: "grafana.contact-point.type",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Integration type",
+				Other: "Integration types",
+			},
+		}, {
+			Attribute: "grafana.contact-point.uid",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Integration UID",
+				Other: "Integration UIDs",
+			},
+		},
+	}
+}
+
+func (d *contactPointDiscovery) DiscoverTargets(ctx context.Context) ([]discovery_kit_api.Target, error) {
+	return d.lastTargets.Discover(ctx, Instances, "contact points", getAllContactPoints)
+}
+
+// getAllContactPoints lists the contact points of all organizations of the instance. Failing to list the
+// contact points of an organization fails the instance, so its previous targets are kept.
+func getAllContactPoints(ctx context.Context, instance extgrafana.Instance) ([]discovery_kit_api.Target, error) {
+	result := make([]discovery_kit_api.Target, 0, 100)
+	for _, org := range extgrafana.GetOrganizations(ctx, instance.Client) {
+		contactPoints, err := getContactPoints(ctx, instance.Client, org.ID, "")
+		if err != nil {
+			return nil, fmt.Errorf("organization %d: %w", org.ID, err)
+		}
+		result = append(result, toTargets(instance, org, contactPoints)...)
+	}
+	return discovery_kit_commons.ApplyAttributeExcludes(result, config.Config.DiscoveryAttributesExcludesContactPoint), nil
+}
+
+// getContactPoints lists the integrations of all contact points, or of the contact point with the given
+// name. Secure settings are redacted.
+func getContactPoints(ctx context.Context, client *resty.Client, orgId int, name string) ([]ContactPoint, error) {
+	var contactPoints []ContactPoint
+	req := extgrafana.SetOrganization(client.R(), orgId).
+		SetContext(ctx).
+		SetResult(&contactPoints)
+	if name != "" {
+		req.SetQueryParam("name", name)
+	}
+	res, err := req.Get("/api/v1/provisioning/contact-points")
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve contact points: %w", err)
+	}
+	if !res.IsSuccess() {
+		return nil, fmt.Errorf("failed to retrieve contact points, status code %d: %s", res.StatusCode(), res.String())
+	}
+	return contactPoints, nil
+}
+
+// toTargets groups the integrations by contact point, as alert notifications are routed to the contact
+// point as a whole.
+func toTargets(instance extgrafana.Instance, org extgrafana.Organization, contactPoints []ContactPoint) []discovery_kit_api.Target {
+	idPrefix := extgrafana.TargetIdPrefix(instance, org)
+	targets := make([]discovery_kit_api.Target, 0, len(contactPoints))
+	byName := make(map[string]int)
+	for _, cp := range contactPoints {
+		i, ok := byName[cp.Name]
+		if !ok {
+			attributes := map[string][]string{
+				"grafana.contact-point.name": {cp.Name},
+				"grafana.host":               {instance.Host()},
+				"grafana.instance":           {instance.Name},
+			}
+			extgrafana.AddOrganizationAttributes(attributes, org)
+			i = len(targets)
+			byName[cp.Name] = i
+			targets = append(targets, discovery_kit_api.Target{
+				Id:         fmt.Sprintf("%s-%s", idPrefix, cp.Name),
+				TargetType: TargetType,
+				Label:      cp.Name,
+				Attributes: attributes,
+			})
+		}
+		attributes := targets[i].Attributes
+		if !slices.Contains(attributes["grafana.contact-point.type"], cp.Type) {
+			attributes["grafana.contact-point.type"] = append(attributes["grafana.contact-point.type"], cp.Type)
+		}
+		if cp.UID != "" {
+			attributes["grafana.contact-point.uid"] = append(attributes["grafana.contact-point.uid"], cp.UID)
+		}
+	}
+	return targets
+}
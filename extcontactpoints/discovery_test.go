@@ -0,0 +1,67 @@
+package extcontactpoints
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RoundTripperFunc lets us stub HTTP responses.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newTestClient(fn RoundTripperFunc) *resty.Client {
+	return resty.NewWithClient(&http.Client{Transport: fn})
+}
+
+func response(statusCode int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+	}
+}
+
+const contactPoints = `[
+	{"uid":"slack-1","name":"team-shop","type":"slack","settings":{"recipient":"#shop","token":"[REDACTED]"}},
+	{"uid":"mail-1","name":"team-shop","type":"email","settings":{"addresses":"shop@example.com"}},
+	{"uid":"slack-2","name":"on-call","type":"slack","settings":{"recipient":"#on-call"}}
+]`
+
+func TestGetAllContactPoints(t *testing.T) {
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/api/org":
+			return response(200, `{"id":1,"name":"Main Org."}`), nil
+		case "/api/user/orgs":
+			return response(200, `[{"orgId":1,"name":"Main Org."}]`), nil
+		case "/api/v1/provisioning/contact-points":
+			return response(200, contactPoints), nil
+		}
+		return response(404, "not found"), nil
+	})
+
+	targets, err := getAllContactPoints(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: client})
+	require.NoError(t, err)
+	require.Len(t, targets, 2, "integrations are grouped by contact point")
+
+	shop := targets[0]
+	assert.Equal(t, "default-team-shop", shop.Id)
+	assert.Equal(t, "team-shop", shop.Label)
+	assert.Equal(t, []string{"slack", "email"}, shop.Attributes["grafana.contact-point.type"])
+	assert.Equal(t, []string{"slack-1", "mail-1"}, shop.Attributes["grafana.contact-point.uid"])
+	assert.Equal(t, []string{"1"}, shop.Attributes["grafana.org.id"])
+
+	onCall := targets[1]
+	assert.Equal(t, []string{"slack"}, onCall.Attributes["grafana.contact-point.type"])
+}
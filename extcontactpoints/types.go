@@ -0,0 +1,56 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extcontactpoints
+
+// ContactPoint is a single integration of a contact point as listed by
+// /api/v1/provisioning/contact-points. Integrations of the same contact point share its name.
+type ContactPoint struct {
+	UID                   string         `json:"uid"`
+	Name                  string         `json:"name"`
+	Type                  string         `json:"type"`
+	Settings              map[string]any `json:"settings"`
+	DisableResolveMessage bool           `json:"disableResolveMessage"`
+}
+
+// TestReceiversRequest is the body of the receiver test endpoint of the Grafana Alertmanager.
+type TestReceiversRequest struct {
+	Receivers []TestReceiver `json:"receivers"`
+	Alert     TestAlert      `json:"alert"`
+}
+
+type TestReceiver struct {
+	Name         string               `json:"name"`
+	Integrations []TestReceiverConfig `json:"grafana_managed_receiver_configs"`
+}
+
+type TestReceiverConfig struct {
+	UID                   string          `json:"uid,omitempty"`
+	Name                  string          `json:"name"`
+	Type                  string          `json:"type"`
+	DisableResolveMessage bool            `json:"disableResolveMessage"`
+	Settings              map[string]any  `json:"settings"`
+	SecureFields          map[string]bool `json:"secureFields,omitempty"`
+}
+
+type TestAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// TestReceiversResult is the outcome of the receiver test, one status per integration.
+type TestReceiversResult struct {
+	Receivers []struct {
+		Name         string `json:"name"`
+		Integrations []struct {
+			UID    string `json:"uid"`
+			Name   string `json:"name"`
+			Status string `json:"status"`
+			Error  string `json:"error,omitempty"`
+		} `json:"grafana_managed_receiver_configs"`
+	} `json:"receivers"`
+}
@@ -0,0 +1,18 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extdashboards
+
+import "github.com/steadybit/extension-grafana/extgrafana"
+
+// Instances are the Grafana instances dashboards are discovered from.
+var Instances []extgrafana.Instance
+
+const (
+	TargetType = "com.steadybit.extension_grafana.dashboard"
+	targetIcon = "data:image/svg+xml,%3Csvg%20width%3D%2224%22%20height%3D%2224%22%20viewBox%3D%220%200%2024%2024%22%20fill%3D%22none%22%20xmlns%3D%22http%3A%2F%2Fwww.w3.org%2F2000%2Fsvg%22%3E%0A%3Cpath%20fill-rule%3D%22evenodd%22%20clip-rule%3D%22evenodd%22%20d%3D%22M3%204C3%203.44772%203.44772%203%204%203H10C10.5523%203%2011%203.44772%2011%204V12C11%2012.5523%2010.5523%2013%2010%2013H4C3.44772%2013%203%2012.5523%203%2012V4ZM5%205V11H9V5H5ZM13%204C13%203.44772%2013.4477%203%2014%203H20C20.5523%203%2021%203.44772%2021%204V8C21%208.55228%2020.5523%209%2020%209H14C13.4477%209%2013%208.55228%2013%208V4ZM15%205V7H19V5H15ZM13%2012C13%2011.4477%2013.4477%2011%2014%2011H20C20.5523%2011%2021%2011.4477%2021%2012V20C21%2020.5523%2020.5523%2021%2020%2021H14C13.4477%2021%2013%2020.5523%2013%2020V12ZM15%2013V19H19V13H15ZM3%2016C3%2015.4477%203.44772%2015%204%2015H10C10.5523%2015%2011%2015.4477%2011%2016V20C11%2020.5523%2010.5523%2021%2010%2021H4C3.44772%2021%203%2020.5523%203%2020V16ZM5%2017V19H9V17H5Z%22%20fill%3D%22%231D2632%22%2F%3E%0A%3C%2Fsvg%3E%0A"
+)
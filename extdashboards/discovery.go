@@ -0,0 +1,202 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extdashboards
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/steadybit/discovery-kit/go/discovery_kit_api"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_commons"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_sdk"
+	"github.com/steadybit/extension-grafana/config"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	"github.com/steadybit/extension-kit/extbuild"
+)
+
+// searchPageSize is the maximum page size of /api/search.
+const searchPageSize = 5000
+
+type dashboardDiscovery struct {
+	lastTargets *extgrafana.LastTargetsByInstance
+}
+
+var (
+	_ discovery_kit_sdk.TargetDescriber    = (*dashboardDiscovery)(nil)
+	_ discovery_kit_sdk.AttributeDescriber = (*dashboardDiscovery)(nil)
+)
+
+func NewDashboardDiscovery() discovery_kit_sdk.TargetDiscovery {
+	discovery := &dashboardDiscovery{lastTargets: extgrafana.NewLastTargetsByInstance()}
+	return discovery_kit_sdk.NewCachedTargetDiscovery(discovery,
+		discovery_kit_sdk.WithRefreshTargetsNow(),
+		discovery_kit_sdk.WithRefreshTargetsInterval(context.Background(), 1*time.Minute),
+	)
+}
+
+func (d *dashboardDiscovery) Describe() discovery_kit_api.DiscoveryDescription {
+	return discovery_kit_api.DiscoveryDescription{
+		Id: TargetType,
+		Discover: discovery_kit_api.DescribingEndpointReferenceWithCallInterval{
+			CallInterval: new("1m"),
+		},
+	}
+}
+
+func (d *dashboardDiscovery) DescribeTarget() discovery_kit_api.TargetDescription {
+	return discovery_kit_api.TargetDescription{
+		Id:       TargetType,
+		Label:    discovery_kit_api.PluralLabel{One: "Grafana Dashboard", Other: "Grafana Dashboards"},
+		Category: new("monitoring"),
+		Version:  extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:     new(targetIcon),
+		Table: discovery_kit_api.Table{
+			Columns: []discovery_kit_api.Column{
+				{Attribute: "grafana.dashboard.title"},
+				{Attribute: "grafana.dashboard.folder"},
+				{Attribute: "grafana.dashboard.tag"},
+				{Attribute: "grafana.instance"},
+			},
+			OrderBy: []discovery_kit_api.OrderBy{
+				{
+					Attribute: "grafana.dashboard.title",
+					Direction: "ASC",
+				},
+			},
+		},
+	}
+}
+
+func (d *dashboardDiscovery) DescribeAttributes() []discovery_kit_api.AttributeDescription {
+	return []discovery_kit_api.AttributeDescription{
+		{
+			Attribute: "grafana.dashboard.uid",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Dashboard UID",
+				Other: "Dashboard UIDs",
+			},
+		}, {
+			Attribute: "grafana.dashboard.title",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Dashboard",
+				Other: "Dashboards",
+			},
+		}, {
+			Attribute: "grafana.dashboard.folder",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Grafana folder",
+				Other: "Grafana folders",
+			},
+		}, {
+			Attribute: "grafana.dashboard.tag",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Dashboard tag",
+				Other: "Dashboard tags",
+			},
+		}, {
+			Attribute: "grafana.dashboard.url",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Dashboard URL",
+				Other: "Dashboard URLs",
+			},
+		},
+	}
+}
+
+func (d *dashboardDiscovery) DiscoverTargets(ctx context.Context) ([]discovery_kit_api.Target, error) {
+	return d.lastTargets.Discover(ctx, Instances, "dashboards", getAllDashboards)
+}
+
+// getAllDashboards lists the dashboards of all organizations of the instance. Failing to list the
+// dashboards of an organization fails the instance, so its previous targets are kept.
+func getAllDashboards(ctx context.Context, instance extgrafana.Instance) ([]discovery_kit_api.Target, error) {
+	result := make([]discovery_kit_api.Target, 0, 1000)
+	for _, org := range extgrafana.GetOrganizations(ctx, instance.Client) {
+		hits, err := searchDashboards(ctx, instance, org)
+		if err != nil {
+			return nil, fmt.Errorf("organization %d: %w", org.ID, err)
+		}
+		result = append(result, toTargets(instance, org, hits)...)
+	}
+	return discovery_kit_commons.ApplyAttributeExcludes(result, config.Config.DiscoveryAttributesExcludesDashboard), nil
+}
+
+// searchDashboards pages through /api/search until a page is not full.
+func searchDashboards(ctx context.Context, instance extgrafana.Instance, org extgrafana.Organization) ([]SearchHit, error) {
+	result := make([]SearchHit, 0)
+	for page := 1; ; page++ {
+		var hits []SearchHit
+		res, err := extgrafana.SetOrganization(instance.Client.R(), org.ID).
+			SetContext(ctx).
+			SetQueryParams(map[string]string{
+				"type":  "dash-db",
+				"limit": strconv.Itoa(searchPageSize),
+				"page":  strconv.Itoa(page),
+			}).
+			SetResult(&hits).
+			Get("/api/search")
+		if err != nil {
+			return nil, fmt.Errorf("failed to search dashboards: %w", err)
+		}
+		if !res.IsSuccess() {
+			return nil, fmt.Errorf("failed to search dashboards, status code %d: %s", res.StatusCode(), res.String())
+		}
+		result = append(result, hits...)
+		if len(hits) < searchPageSize {
+			return result, nil
+		}
+	}
+}
+
+func toTargets(instance extgrafana.Instance, org extgrafana.Organization, hits []SearchHit) []discovery_kit_api.Target {
+	idPrefix := extgrafana.TargetIdPrefix(instance, org)
+	targets := make([]discovery_kit_api.Target, 0, len(hits))
+	for _, hit := range hits {
+		attributes := map[string][]string{
+			"grafana.dashboard.uid":   {hit.UID},
+			"grafana.dashboard.title": {hit.Title},
+			"grafana.dashboard.url":   {dashboardUrl(instance.BaseUrl, hit.URL)},
+			"grafana.host":            {instance.Host()},
+			"grafana.instance":        {instance.Name},
+		}
+		if hit.FolderTitle != "" {
+			attributes["grafana.dashboard.folder"] = []string{hit.FolderTitle}
+		}
+		if hit.FolderUID != "" {
+			attributes["grafana.dashboard.folder-uid"] = []string{hit.FolderUID}
+		}
+		if len(hit.Tags) > 0 {
+			attributes["grafana.dashboard.tag"] = hit.Tags
+		}
+		extgrafana.AddOrganizationAttributes(attributes, org)
+		targets = append(targets, discovery_kit_api.Target{
+			Id:         fmt.Sprintf("%s-%s", idPrefix, hit.UID),
+			TargetType: TargetType,
+			Label:      hit.Title,
+			Attributes: attributes,
+		})
+	}
+	return targets
+}
+
+// dashboardUrl resolves the path of the dashboard against the base URL of the instance. The path
+// already contains the sub path Grafana is served from, if any.
+func dashboardUrl(baseUrl string, path string) string {
+	base, err := url.Parse(baseUrl)
+	if err != nil {
+		return path
+	}
+	ref, err := url.Parse(path)
+	if err != nil {
+		return path
+	}
+	return base.ResolveReference(ref).String()
+}
@@ -0,0 +1,78 @@
+package extdashboards
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RoundTripperFunc lets us stub HTTP responses.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newTestClient(fn RoundTripperFunc) *resty.Client {
+	return resty.NewWithClient(&http.Client{Transport: fn})
+}
+
+func jsonResponse(body string) *http.Response {
+	return &http.Response{
+		StatusCode: 200,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+	}
+}
+
+func TestGetAllDashboards(t *testing.T) {
+	var pages []string
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		switch strings.TrimPrefix(req.URL.Path, "/grafana") {
+		case "/api/org":
+			return jsonResponse(`{"id":1,"name":"Main Org."}`), nil
+		case "/api/user/orgs":
+			return jsonResponse(`[{"orgId":1,"name":"Main Org."}]`), nil
+		case "/api/search":
+			assert.Equal(t, "dash-db", req.URL.Query().Get("type"))
+			pages = append(pages, req.URL.Query().Get("page"))
+			if req.URL.Query().Get("page") == "2" {
+				return jsonResponse(`[]`), nil
+			}
+			hits := make([]string, 0, searchPageSize)
+			hits = append(hits, `{"uid":"checkout","title":"Checkout","type":"dash-db","url":"/grafana/d/checkout/checkout","tags":["team-shop","slo"],"folderUid":"shop","folderTitle":"Shop"}`)
+			hits = append(hits, `{"uid":"home","title":"Home","type":"dash-db","url":"/grafana/d/home/home","tags":[]}`)
+			for i := len(hits); i < searchPageSize; i++ {
+				hits = append(hits, fmt.Sprintf(`{"uid":"d%d","title":"Dashboard %d","type":"dash-db","url":"/grafana/d/d%d"}`, i, i, i))
+			}
+			return jsonResponse("[" + strings.Join(hits, ",") + "]"), nil
+		}
+		return &http.Response{StatusCode: 404, Body: io.NopCloser(strings.NewReader("not found"))}, nil
+	})
+	client.SetBaseURL("http://grafana.local/grafana")
+
+	targets, err := getAllDashboards(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local/grafana", Client: client})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, pages, "pages are requested until one is not full")
+	require.Len(t, targets, searchPageSize)
+
+	checkout := targets[0]
+	assert.Equal(t, "default-checkout", checkout.Id)
+	assert.Equal(t, "Checkout", checkout.Label)
+	assert.Equal(t, []string{"Shop"}, checkout.Attributes["grafana.dashboard.folder"])
+	assert.Equal(t, []string{"team-shop", "slo"}, checkout.Attributes["grafana.dashboard.tag"])
+	assert.Equal(t, []string{"http://grafana.local/grafana/d/checkout/checkout"}, checkout.Attributes["grafana.dashboard.url"])
+	assert.Equal(t, []string{"1"}, checkout.Attributes["grafana.org.id"])
+
+	home := targets[1]
+	assert.NotContains(t, home.Attributes, "grafana.dashboard.folder", "dashboards of the root folder have no folder")
+	assert.NotContains(t, home.Attributes, "grafana.dashboard.tag")
+}
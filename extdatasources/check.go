@@ -0,0 +1,340 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extdatasources
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/action-kit/go/action_kit_sdk"
+	"github.com/steadybit/extension-grafana/config"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	extension_kit "github.com/steadybit/extension-kit"
+	"github.com/steadybit/extension-kit/extbuild"
+	"github.com/steadybit/extension-kit/extutil"
+)
+
+type DatasourceHealthCheckAction struct{}
+
+// Make sure action implements all required interfaces
+var (
+	_ action_kit_sdk.Action[DatasourceHealthCheckState]           = (*DatasourceHealthCheckAction)(nil)
+	_ action_kit_sdk.ActionWithStatus[DatasourceHealthCheckState] = (*DatasourceHealthCheckAction)(nil)
+)
+
+type DatasourceHealthCheckState struct {
+	// Instance is the name of the Grafana instance the target was discovered from.
+	Instance string
+	// OrgId is the organization the datasource belongs to, 0 for the organization of the service token.
+	OrgId             int
+	DatasourceUid     string
+	DatasourceName    string
+	End               time.Time
+	ExpectedHealth    string
+	StateCheckMode    string
+	StateCheckSuccess bool
+	FailEarly         bool
+	// DeviationTitle remembers a deviating health observed in 'All the time' mode without FailEarly, to
+	// report it once the step ends.
+	DeviationTitle string
+	// ApiErrors counts the polls failing to check the health, see extgrafana.ApiErrorTolerance.
+	ApiErrors extgrafana.ApiErrorTolerance
+}
+
+func NewDatasourceHealthCheckAction() action_kit_sdk.Action[DatasourceHealthCheckState] {
+	return &DatasourceHealthCheckAction{}
+}
+
+func (m *DatasourceHealthCheckAction) NewEmptyState() DatasourceHealthCheckState {
+	return DatasourceHealthCheckState{}
+}
+
+func (m *DatasourceHealthCheckAction) Describe() action_kit_api.ActionDescription {
+	return action_kit_api.ActionDescription{
+		Id:          fmt.Sprintf("%s.check", TargetType),
+		Label:       "Datasource Health Check",
+		Description: "collects the health of the datasource and optionally verifies that it is the one expected.",
+		Version:     extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:        new(targetIcon),
+		TargetSelection: new(action_kit_api.TargetSelection{
+			TargetType:          TargetType,
+			QuantityRestriction: extutil.Ptr(action_kit_api.QuantityRestrictionAll),
+			SelectionTemplates: new([]action_kit_api.TargetSelectionTemplate{
+				{
+					Label:       "datasource name",
+					Description: new("Find datasource by name"),
+					Query:       "grafana.datasource.name=\"\"",
+				},
+			}),
+		}),
+		Technology: new("Grafana"),
+
+		Kind:        action_kit_api.Check,
+		TimeControl: action_kit_api.TimeControlInternal,
+		Parameters: append([]action_kit_api.ActionParameter{
+			{
+				Name:         "duration",
+				Label:        "Duration",
+				Description:  new(""),
+				Type:         action_kit_api.ActionParameterTypeDuration,
+				DefaultValue: new("30s"),
+				Order:        new(1),
+				Required:     new(true),
+			},
+			{
+				Name:        "expectedHealth",
+				Label:       "Expected Health",
+				Description: new("The health the datasource is expected to have, e.g. unhealthy while the database behind it is attacked."),
+				Type:        action_kit_api.ActionParameterTypeString,
+				Options: new([]action_kit_api.ParameterOption{
+					action_kit_api.ExplicitParameterOption{
+						Label: "Healthy",
+						Value: healthHealthy,
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "Unhealthy",
+						Value: healthUnhealthy,
+					},
+				}),
+				Required: new(false),
+				Order:    new(2),
+			},
+			{
+				Name:         "stateCheckMode",
+				Label:        "State Check Mode",
+				Description:  new("How often should the health be checked ?"),
+				Type:         action_kit_api.ActionParameterTypeString,
+				DefaultValue: new(stateCheckModeAllTheTime),
+				Options: new([]action_kit_api.ParameterOption{
+					action_kit_api.ExplicitParameterOption{
+						Label: "All the time",
+						Value: stateCheckModeAllTheTime,
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "At least once",
+						Value: stateCheckModeAtLeastOnce,
+					},
+				}),
+				Required: new(true),
+				Order:    new(3),
+			},
+			{
+				Name:         "failEarly",
+				Label:        "Fail early",
+				Description:  new("If enabled, the check fails as soon as a deviating health is observed. If disabled, the check keeps collecting the health for the whole duration and only fails at the end of the step. Only affects the 'All the time' mode."),
+				Type:         action_kit_api.ActionParameterTypeBoolean,
+				DefaultValue: new("true"),
+				Advanced:     new(true),
+				Required:     new(false),
+				Order:        new(4),
+			},
+		}, extgrafana.ApiErrorToleranceParameters("the health of the datasource", 5)...),
+		Widgets: new([]action_kit_api.Widget{
+			action_kit_api.StateOverTimeWidget{
+				Type:  action_kit_api.ComSteadybitWidgetStateOverTime,
+				Title: "Grafana Datasource Health",
+				Identity: action_kit_api.StateOverTimeWidgetIdentityConfig{
+					From: "grafana.datasource.uid",
+				},
+				Label: action_kit_api.StateOverTimeWidgetLabelConfig{
+					From: "grafana.datasource.name",
+				},
+				State: action_kit_api.StateOverTimeWidgetStateConfig{
+					From: "state",
+				},
+				Tooltip: action_kit_api.StateOverTimeWidgetTooltipConfig{
+					From: "tooltip",
+				},
+				Url: new(action_kit_api.StateOverTimeWidgetUrlConfig{
+					From: new("url"),
+				}),
+				Value: new(action_kit_api.StateOverTimeWidgetValueConfig{
+					Hide: new(true),
+				}),
+			},
+		}),
+		// every health check makes Grafana query the datasource
+		Status: new(action_kit_api.MutatingEndpointReferenceWithCallInterval{
+			CallInterval: new("2s"),
+		}),
+	}
+}
+
+func (m *DatasourceHealthCheckAction) Prepare(_ context.Context, state *DatasourceHealthCheckState, request action_kit_api.PrepareActionRequestBody) (*action_kit_api.PrepareResult, error) {
+	uid := extgrafana.FirstAttribute(request.Target.Attributes, "grafana.datasource.uid")
+	if uid == "" {
+		return nil, new(extension_kit.ToError("Target is missing the 'grafana.datasource.uid' attribute.", nil))
+	}
+
+	duration := request.Config["duration"].(float64)
+	state.End = time.Now().Add(time.Millisecond * time.Duration(duration))
+
+	if request.Config["expectedHealth"] != nil {
+		state.ExpectedHealth = fmt.Sprintf("%v", request.Config["expectedHealth"])
+	}
+	if request.Config["stateCheckMode"] != nil {
+		state.StateCheckMode = fmt.Sprintf("%v", request.Config["stateCheckMode"])
+	}
+	state.FailEarly = true
+	if request.Config["failEarly"] != nil {
+		state.FailEarly = extutil.ToBool(request.Config["failEarly"])
+	}
+	state.ApiErrors = extgrafana.ParseApiErrorTolerance(request.Config)
+
+	instance, err := extgrafana.FindInstance(Instances, extgrafana.FirstAttribute(request.Target.Attributes, "grafana.instance"), extgrafana.FirstAttribute(request.Target.Attributes, "grafana.host"))
+	if err != nil {
+		return nil, new(extension_kit.ToError("Failed to resolve the Grafana instance of the target.", err))
+	}
+
+	if orgId := extgrafana.FirstAttribute(request.Target.Attributes, "grafana.org.id"); orgId != "" {
+		state.OrgId, err = strconv.Atoi(orgId)
+		if err != nil {
+			return nil, new(extension_kit.ToError(fmt.Sprintf("Target has an invalid 'grafana.org.id' attribute '%s'.", orgId), err))
+		}
+	}
+
+	state.Instance = instance.Name
+	state.DatasourceUid = uid
+	state.DatasourceName = extgrafana.FirstAttribute(request.Target.Attributes, "grafana.datasource.name")
+	return nil, nil
+}
+
+func (m *DatasourceHealthCheckAction) Start(ctx context.Context, state *DatasourceHealthCheckState) (*action_kit_api.StartResult, error) {
+	statusResult, err := m.Status(ctx, state)
+	if statusResult == nil {
+		return nil, err
+	}
+	return &action_kit_api.StartResult{
+		Error:    statusResult.Error,
+		Messages: statusResult.Messages,
+		Metrics:  statusResult.Metrics,
+	}, err
+}
+
+func (m *DatasourceHealthCheckAction) Status(ctx context.Context, state *DatasourceHealthCheckState) (*action_kit_api.StatusResult, error) {
+	instance, err := extgrafana.FindInstance(Instances, state.Instance, "")
+	if err != nil {
+		return nil, extension_kit.ToError("Failed to resolve the Grafana instance of the target.", err)
+	}
+	return DatasourceHealthCheckStatus(ctx, state, healthCheckClient(instance))
+}
+
+// healthCheckClients are the clients of the health check per instance, see healthCheckClient.
+var healthCheckClients sync.Map
+
+// healthCheckClient returns the client of the health check for the instance. Unlike the shared client, it
+// waits for Grafana to give up on an unresponsive datasource.
+func healthCheckClient(instance *extgrafana.Instance) *resty.Client {
+	if client, ok := healthCheckClients.Load(instance.Name); ok {
+		return client.(*resty.Client)
+	}
+	client, _ := healthCheckClients.LoadOrStore(instance.Name, instance.NewClient(config.Config.GetDatasourceHealthTimeout()))
+	return client.(*resty.Client)
+}
+
+func DatasourceHealthCheckStatus(ctx context.Context, state *DatasourceHealthCheckState, client *resty.Client) (*action_kit_api.StatusResult, error) {
+	now := time.Now()
+
+	health, err := extgrafana.GetDataSourceHealth(ctx, client, state.OrgId, state.DatasourceUid)
+	if err != nil && state.ExpectedHealth == healthUnhealthy && extgrafana.IsTimeout(err) {
+		// a datasource that doesn't answer, e.g. because its network is blackholed, is what is expected
+		health, err = extgrafana.DataSourceHealth{Status: "ERROR", Message: fmt.Sprintf("health check timed out: %s", err.Error())}, nil
+	}
+	if err != nil {
+		return tolerateUnavailable(state, err, client.BaseURL, now)
+	}
+	state.ApiErrors.Succeeded()
+	current := healthState(health)
+
+	completed := now.After(state.End)
+	var checkError *action_kit_api.ActionKitError
+	if state.ExpectedHealth != "" {
+		if state.StateCheckMode == stateCheckModeAllTheTime {
+			if current != state.ExpectedHealth {
+				if state.FailEarly {
+					checkError = new(action_kit_api.ActionKitError{
+						Title:  fmt.Sprintf("Datasource '%s' is %s whereas %s is expected: %s", state.DatasourceName, current, state.ExpectedHealth, health.Message),
+						Status: extutil.Ptr(action_kit_api.Failed),
+					})
+				} else if state.DeviationTitle == "" {
+					state.DeviationTitle = fmt.Sprintf("Datasource '%s' was %s whereas %s is expected: %s", state.DatasourceName, current, state.ExpectedHealth, health.Message)
+				}
+			}
+			if !state.FailEarly && completed && state.DeviationTitle != "" {
+				checkError = new(action_kit_api.ActionKitError{
+					Title:  state.DeviationTitle,
+					Status: extutil.Ptr(action_kit_api.Failed),
+				})
+			}
+		} else if state.StateCheckMode == stateCheckModeAtLeastOnce {
+			state.StateCheckSuccess = state.StateCheckSuccess || current == state.ExpectedHealth
+			if completed && !state.StateCheckSuccess {
+				checkError = new(action_kit_api.ActionKitError{
+					Title:  fmt.Sprintf("Datasource '%s' wasn't %s at least once.", state.DatasourceName, state.ExpectedHealth),
+					Status: extutil.Ptr(action_kit_api.Failed),
+				})
+			}
+		}
+	}
+
+	return &action_kit_api.StatusResult{
+		Completed: completed,
+		Error:     checkError,
+		Metrics:   &[]action_kit_api.Metric{toMetric(state, health, client.BaseURL, now)},
+	}, nil
+}
+
+// tolerateUnavailable reports a failed poll as unknown health, unless the tolerance is exceeded. The
+// step is not completed by a failed poll, as its outcome can't be evaluated.
+func tolerateUnavailable(state *DatasourceHealthCheckState, err error, baseUrl string, now time.Time) (*action_kit_api.StatusResult, error) {
+	if exceeded := state.ApiErrors.Tolerate(err); exceeded != nil {
+		return nil, extension_kit.ToError(fmt.Sprintf("Failed to check the health of datasource %s.", state.DatasourceName), exceeded)
+	}
+	log.Warn().Err(err).Msgf("Tolerating failure %d in a row to check the health of datasource %s.", state.ApiErrors.Consecutive, state.DatasourceName)
+
+	metric := toMetric(state, extgrafana.DataSourceHealth{}, baseUrl, now)
+	metric.Metric["state"] = "info"
+	metric.Metric["tooltip"] = fmt.Sprintf("Datasource health is unknown, failed to check it (%d of %d polls failed): %s",
+		state.ApiErrors.Failures, state.ApiErrors.Polls, err.Error())
+	return &action_kit_api.StatusResult{
+		Metrics: &[]action_kit_api.Metric{metric},
+	}, nil
+}
+
+func toMetric(state *DatasourceHealthCheckState, health extgrafana.DataSourceHealth, baseUrl string, now time.Time) action_kit_api.Metric {
+	widgetState := "success"
+	tooltip := fmt.Sprintf("Datasource is %s", healthState(health))
+	if !health.Healthy {
+		widgetState = "danger"
+	}
+	if health.Message != "" {
+		tooltip += fmt.Sprintf(": %s", health.Message)
+	}
+	dsUrl := fmt.Sprintf("%s/connections/datasources/edit/%s", baseUrl, state.DatasourceUid)
+	if state.OrgId > 0 {
+		dsUrl += fmt.Sprintf("?orgId=%d", state.OrgId)
+	}
+	return action_kit_api.Metric{
+		Name: new("grafana_datasource_health"),
+		Metric: map[string]string{
+			"grafana.datasource.uid":  state.DatasourceUid,
+			"grafana.datasource.name": state.DatasourceName,
+			"state":                   widgetState,
+			"tooltip":                 tooltip,
+			"url":                     dsUrl,
+		},
+		Timestamp: now,
+		Value:     0,
+	}
+}
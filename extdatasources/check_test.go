@@ -0,0 +1,209 @@
+package extdatasources
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareExtractsState(t *testing.T) {
+	Instances = []extgrafana.Instance{{Name: "default", BaseUrl: "http://grafana.local"}}
+	defer func() { Instances = nil }()
+
+	action := DatasourceHealthCheckAction{}
+	state := action.NewEmptyState()
+	_, err := action.Prepare(context.Background(), &state, action_kit_api.PrepareActionRequestBody{
+		Config: map[string]any{
+			"duration":                      float64(60000),
+			"expectedHealth":                "unhealthy",
+			"stateCheckMode":                stateCheckModeAtLeastOnce,
+			"toleratedConsecutiveApiErrors": float64(3),
+		},
+		Target: new(action_kit_api.Target{
+			Attributes: map[string][]string{
+				"grafana.datasource.uid":  {"prom"},
+				"grafana.datasource.name": {"Prometheus"},
+				"grafana.instance":        {"default"},
+				"grafana.org.id":          {"2"},
+			},
+		}),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "default", state.Instance)
+	assert.Equal(t, 2, state.OrgId)
+	assert.Equal(t, "prom", state.DatasourceUid)
+	assert.Equal(t, "Prometheus", state.DatasourceName)
+	assert.Equal(t, "unhealthy", state.ExpectedHealth)
+	assert.Equal(t, stateCheckModeAtLeastOnce, state.StateCheckMode)
+	assert.True(t, state.FailEarly)
+	assert.Equal(t, 3, state.ApiErrors.MaxConsecutive)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), state.End, 5*time.Second)
+}
+
+func healthClient(statusCode *int) RoundTripperFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		if *statusCode == 200 {
+			return response(200, `{"status":"OK","message":"Successfully queried the Prometheus API."}`), nil
+		}
+		return response(*statusCode, `{"status":"ERROR","message":"connection refused"}`), nil
+	}
+}
+
+func TestDatasourceHealthCheckStatus_AllTheTime_Unhealthy(t *testing.T) {
+	statusCode := 400
+	client := newTestClient(healthClient(&statusCode))
+	client.SetBaseURL("http://grafana.local")
+	state := &DatasourceHealthCheckState{
+		DatasourceUid:  "prom",
+		DatasourceName: "Prometheus",
+		End:            time.Now().Add(time.Minute),
+		ExpectedHealth: healthHealthy,
+		StateCheckMode: stateCheckModeAllTheTime,
+		FailEarly:      true,
+	}
+
+	result, err := DatasourceHealthCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Datasource 'Prometheus' is unhealthy whereas healthy is expected: connection refused", result.Error.Title)
+	metric := (*result.Metrics)[0]
+	assert.Equal(t, "danger", metric.Metric["state"])
+	assert.Equal(t, "Datasource is unhealthy: connection refused", metric.Metric["tooltip"])
+	assert.Equal(t, "http://grafana.local/connections/datasources/edit/prom", metric.Metric["url"])
+}
+
+func TestDatasourceHealthCheckStatus_AtLeastOnce(t *testing.T) {
+	statusCode := 200
+	client := newTestClient(healthClient(&statusCode))
+	state := &DatasourceHealthCheckState{
+		DatasourceUid:  "prom",
+		DatasourceName: "Prometheus",
+		End:            time.Now().Add(time.Minute),
+		ExpectedHealth: healthUnhealthy,
+		StateCheckMode: stateCheckModeAtLeastOnce,
+	}
+
+	result, err := DatasourceHealthCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.Nil(t, result.Error, "the datasource may still become unhealthy")
+	assert.False(t, result.Completed)
+
+	statusCode = 503
+	_, err = DatasourceHealthCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+
+	statusCode = 200
+	state.End = time.Now().Add(-time.Second)
+	result, err = DatasourceHealthCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.True(t, result.Completed)
+	assert.Nil(t, result.Error, "the datasource was unhealthy once")
+}
+
+func TestDatasourceHealthCheckStatus_AtLeastOnce_NeverMatched(t *testing.T) {
+	statusCode := 200
+	client := newTestClient(healthClient(&statusCode))
+	state := &DatasourceHealthCheckState{
+		DatasourceUid:  "prom",
+		DatasourceName: "Prometheus",
+		End:            time.Now().Add(-time.Second),
+		ExpectedHealth: healthUnhealthy,
+		StateCheckMode: stateCheckModeAtLeastOnce,
+	}
+
+	result, err := DatasourceHealthCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Datasource 'Prometheus' wasn't unhealthy at least once.", result.Error.Title)
+	assert.Equal(t, action_kit_api.Failed, *result.Error.Status)
+}
+
+func TestDatasourceHealthCheckStatus_AllTheTime_FailsAtEnd(t *testing.T) {
+	statusCode := 400
+	client := newTestClient(healthClient(&statusCode))
+	state := &DatasourceHealthCheckState{
+		DatasourceUid:  "prom",
+		DatasourceName: "Prometheus",
+		End:            time.Now().Add(time.Minute),
+		ExpectedHealth: healthHealthy,
+		StateCheckMode: stateCheckModeAllTheTime,
+	}
+
+	result, err := DatasourceHealthCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.Nil(t, result.Error, "the deviation is only reported at the end of the step")
+	assert.Equal(t, "danger", (*result.Metrics)[0].Metric["state"])
+
+	statusCode = 200
+	state.End = time.Now().Add(-time.Second)
+	result, err = DatasourceHealthCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.True(t, result.Completed)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Datasource 'Prometheus' was unhealthy whereas healthy is expected: connection refused", result.Error.Title)
+}
+
+func TestDatasourceHealthCheckStatus_ToleratesTransientApiErrors(t *testing.T) {
+	statusCode := 502
+	client := newTestClient(healthClient(&statusCode))
+	state := &DatasourceHealthCheckState{
+		DatasourceUid:  "prom",
+		DatasourceName: "Prometheus",
+		End:            time.Now().Add(-time.Second),
+		ExpectedHealth: healthHealthy,
+		StateCheckMode: stateCheckModeAllTheTime,
+		FailEarly:      true,
+		ApiErrors:      extgrafana.ApiErrorTolerance{MaxConsecutive: 1},
+	}
+
+	result, err := DatasourceHealthCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.False(t, result.Completed, "the outcome can't be evaluated without the health")
+	assert.Nil(t, result.Error)
+	assert.Equal(t, "info", (*result.Metrics)[0].Metric["state"])
+	assert.Contains(t, (*result.Metrics)[0].Metric["tooltip"], "1 of 1 polls failed")
+
+	_, err = DatasourceHealthCheckStatus(context.Background(), state, client)
+	require.Error(t, err, "the second failure in a row exceeds the tolerance")
+	assert.Contains(t, err.Error(), "status code 502")
+}
+
+func TestDatasourceHealthCheckStatus_TimeoutIsUnhealthyWhenExpected(t *testing.T) {
+	statusCode := 504
+	client := newTestClient(healthClient(&statusCode))
+	state := &DatasourceHealthCheckState{
+		DatasourceUid:  "prom",
+		DatasourceName: "Prometheus",
+		End:            time.Now().Add(-time.Second),
+		ExpectedHealth: healthUnhealthy,
+		StateCheckMode: stateCheckModeAtLeastOnce,
+		ApiErrors:      extgrafana.ApiErrorTolerance{MaxConsecutive: 1},
+	}
+
+	result, err := DatasourceHealthCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.True(t, result.Completed)
+	assert.Nil(t, result.Error, "Grafana giving up on the datasource means it is unhealthy")
+	assert.Equal(t, "danger", (*result.Metrics)[0].Metric["state"])
+
+	timedOut := newTestClient(func(req *http.Request) (*http.Response, error) {
+		return nil, context.DeadlineExceeded
+	})
+	state.StateCheckSuccess = false
+	result, err = DatasourceHealthCheckStatus(context.Background(), state, timedOut)
+	require.NoError(t, err)
+	assert.Nil(t, result.Error, "a datasource health request timing out means it is unhealthy")
+	assert.Contains(t, (*result.Metrics)[0].Metric["tooltip"], "health check timed out")
+
+	state.ExpectedHealth = healthHealthy
+	result, err = DatasourceHealthCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.False(t, result.Completed, "the timeout is only tolerated when healthy is expected")
+	assert.Equal(t, "info", (*result.Metrics)[0].Metric["state"])
+}
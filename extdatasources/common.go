@@ -0,0 +1,24 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extdatasources
+
+import "github.com/steadybit/extension-grafana/extgrafana"
+
+// Instances are the Grafana instances datasources are discovered from and checked against.
+var Instances []extgrafana.Instance
+
+const (
+	TargetType                = "com.steadybit.extension_grafana.datasource"
+	targetIcon                = "data:image/svg+xml,%3Csvg%20width%3D%2224%22%20height%3D%2224%22%20viewBox%3D%220%200%2024%2024%22%20fill%3D%22none%22%20xmlns%3D%22http%3A%2F%2Fwww.w3.org%2F2000%2Fsvg%22%3E%0A%3Cpath%20fill-rule%3D%22evenodd%22%20clip-rule%3D%22evenodd%22%20d%3D%22M4%206C4%204.34315%207.58172%203%2012%203C16.4183%203%2020%204.34315%2020%206V18C20%2019.6569%2016.4183%2021%2012%2021C7.58172%2021%204%2019.6569%204%2018V6ZM6%208.56V12C6%2012.3%207.9%2013.5%2012%2013.5C16.1%2013.5%2018%2012.3%2018%2012V8.56C16.54%209.16%2014.38%209.5%2012%209.5C9.62%209.5%207.46%209.16%206%208.56ZM18%2014.56C16.54%2015.16%2014.38%2015.5%2012%2015.5C9.62%2015.5%207.46%2015.16%206%2014.56V18C6%2018.3%207.9%2019%2012%2019C16.1%2019%2018%2018.3%2018%2018V14.56ZM12%207.5C16.1%207.5%2018%206.3%2018%206C18%205.7%2016.1%205%2012%205C7.9%205%206%205.7%206%206C6%206.3%207.9%207.5%2012%207.5Z%22%20fill%3D%22%231D2632%22%2F%3E%0A%3C%2Fsvg%3E%0A"
+	stateCheckModeAtLeastOnce = "atLeastOnce"
+	stateCheckModeAllTheTime  = "allTheTime"
+
+	healthHealthy   = "healthy"
+	healthUnhealthy = "unhealthy"
+	healthUnknown   = "unknown"
+)
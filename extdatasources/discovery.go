@@ -0,0 +1,202 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extdatasources
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/steadybit/discovery-kit/go/discovery_kit_api"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_commons"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_sdk"
+	"github.com/steadybit/extension-grafana/config"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	"github.com/steadybit/extension-kit/extbuild"
+)
+
+type datasourceDiscovery struct {
+	lastTargets *extgrafana.LastTargetsByInstance
+}
+
+var (
+	_ discovery_kit_sdk.TargetDescriber    = (*datasourceDiscovery)(nil)
+	_ discovery_kit_sdk.AttributeDescriber = (*datasourceDiscovery)(nil)
+)
+
+func NewDatasourceDiscovery() discovery_kit_sdk.TargetDiscovery {
+	discovery := &datasourceDiscovery{lastTargets: extgrafana.NewLastTargetsByInstance()}
+	return discovery_kit_sdk.NewCachedTargetDiscovery(discovery,
+		discovery_kit_sdk.WithRefreshTargetsNow(),
+		discovery_kit_sdk.WithRefreshTargetsInterval(context.Background(), 1*time.Minute),
+	)
+}
+
+func (d *datasourceDiscovery) Describe() discovery_kit_api.DiscoveryDescription {
+	return discovery_kit_api.DiscoveryDescription{
+		Id: TargetType,
+		Discover: discovery_kit_api.DescribingEndpointReferenceWithCallInterval{
+			CallInterval: new("1m"),
+		},
+	}
+}
+
+func (d *datasourceDiscovery) DescribeTarget() discovery_kit_api.TargetDescription {
+	return discovery_kit_api.TargetDescription{
+		Id:       TargetType,
+		Label:    discovery_kit_api.PluralLabel{One: "Grafana Datasource", Other: "Grafana Datasources"},
+		Category: new("monitoring"),
+		Version:  extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:     new(targetIcon),
+		Table: discovery_kit_api.Table{
+			Columns: []discovery_kit_api.Column{
+				{Attribute: "grafana.datasource.name"},
+				{Attribute: "grafana.datasource.type"},
+				{Attribute: "grafana.datasource.health"},
+				{Attribute: "grafana.instance"},
+			},
+			OrderBy: []discovery_kit_api.OrderBy{
+				{
+					Attribute: "grafana.datasource.name",
+					Direction: "ASC",
+				},
+			},
+		},
+	}
+}
+
+func (d *datasourceDiscovery) DescribeAttributes() []discovery_kit_api.AttributeDescription {
+	return []discovery_kit_api.AttributeDescription{
+		{
+			Attribute: "grafana.datasource.uid",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Datasource UID",
+				Other: "Datasource UIDs",
+			},
+		}, {
+			Attribute: "grafana.datasource.name",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Grafana datasource",
+				Other: "Grafana datasources",
+			},
+		}, {
+			Attribute: "grafana.datasource.type",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Datasource type",
+				Other: "Datasource types",
+			},
+		}, {
+			Attribute: "grafana.datasource.url",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Datasource URL",
+				Other: "Datasource URLs",
+			},
+		}, {
+			Attribute: "grafana.datasource.default",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Default datasource",
+				Other: "Default datasources",
+			},
+		}, {
+			Attribute: "grafana.datasource.health",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Health",
+				Other: "Health",
+			},
+		}, {
+			Attribute: "grafana.datasource.health-message",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Health message",
+				Other: "Health messages",
+			},
+		},
+	}
+}
+
+func (d *datasourceDiscovery) DiscoverTargets(ctx context.Context) ([]discovery_kit_api.Target, error) {
+	return d.lastTargets.Discover(ctx, Instances, "datasources", getAllDatasources)
+}
+
+// getAllDatasources lists the datasources of all organizations of the instance, with their health as
+// of this discovery. Failing to list the datasources of an organization fails the instance.
+func getAllDatasources(ctx context.Context, instance extgrafana.Instance) ([]discovery_kit_api.Target, error) {
+	result := make([]discovery_kit_api.Target, 0, 100)
+	for _, org := range extgrafana.GetOrganizations(ctx, instance.Client) {
+		datasources, err := extgrafana.GetDataSources(ctx, instance.Client, org.ID)
+		if err != nil {
+			return nil, fmt.Errorf("organization %d: %w", org.ID, err)
+		}
+		health := checkAllHealth(ctx, instance, org, datasources)
+		for i, ds := range datasources {
+			result = append(result, toTarget(instance, org, ds, health[i]))
+		}
+	}
+	return discovery_kit_commons.ApplyAttributeExcludes(result, config.Config.DiscoveryAttributesExcludesDatasource), nil
+}
+
+// checkAllHealth checks the health of the datasources in parallel, bounded by the configured
+// concurrency. The health is shared with the alert rule discovery and only checked again once due, see
+// extgrafana.DataSourceHealthCache. Datasources configured to skip the health check, or whose check
+// fails, have no health.
+func checkAllHealth(ctx context.Context, instance extgrafana.Instance, org extgrafana.Organization, datasources []extgrafana.DataSource) []*extgrafana.DataSourceHealth {
+	health := make([]*extgrafana.DataSourceHealth, len(datasources))
+	semaphore := make(chan struct{}, config.Config.GetDiscoveryConcurrency())
+	var wg sync.WaitGroup
+	for i, ds := range datasources {
+		if extgrafana.SkipsHealthCheck(ds) {
+			continue
+		}
+		wg.Go(func() {
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			ctx, cancel := context.WithTimeout(ctx, config.Config.GetDiscoveryDatasourceTimeout())
+			defer cancel()
+			health[i] = extgrafana.CachedDataSourceHealth(ctx, instance, org, ds)
+		})
+	}
+	wg.Wait()
+	return health
+}
+
+func toTarget(instance extgrafana.Instance, org extgrafana.Organization, ds extgrafana.DataSource, health *extgrafana.DataSourceHealth) discovery_kit_api.Target {
+	attributes := map[string][]string{
+		"grafana.datasource.uid":     {ds.UID},
+		"grafana.datasource.name":    {ds.Name},
+		"grafana.datasource.type":    {ds.Type},
+		"grafana.datasource.default": {strconv.FormatBool(ds.IsDefault)},
+		"grafana.datasource.health":  {healthUnknown},
+		"grafana.host":               {instance.Host()},
+		"grafana.instance":           {instance.Name},
+	}
+	if ds.URL != "" {
+		attributes["grafana.datasource.url"] = []string{ds.URL}
+	}
+	if health != nil {
+		attributes["grafana.datasource.health"] = []string{healthState(*health)}
+		if health.Message != "" {
+			attributes["grafana.datasource.health-message"] = []string{health.Message}
+		}
+	}
+	extgrafana.AddOrganizationAttributes(attributes, org)
+	return discovery_kit_api.Target{
+		Id:         fmt.Sprintf("%s-%s", extgrafana.TargetIdPrefix(instance, org), ds.UID),
+		TargetType: TargetType,
+		Label:      ds.Name,
+		Attributes: attributes,
+	}
+}
+
+func healthState(health extgrafana.DataSourceHealth) string {
+	if health.Healthy {
+		return healthHealthy
+	}
+	return healthUnhealthy
+}
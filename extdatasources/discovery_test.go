@@ -0,0 +1,105 @@
+package extdatasources
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/steadybit/extension-grafana/config"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RoundTripperFunc lets us stub HTTP responses.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newTestClient(fn RoundTripperFunc) *resty.Client {
+	return resty.NewWithClient(&http.Client{Transport: fn})
+}
+
+func response(statusCode int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+	}
+}
+
+func TestGetAllDatasources(t *testing.T) {
+	config.Config.DiscoverySkipHealthCheckDatasources = []string{"Loki"}
+	defer func() { config.Config.DiscoverySkipHealthCheckDatasources = nil }()
+	t.Cleanup(func() { extgrafana.DataSourceHealthCache = extgrafana.NewHealthCache(time.Now) })
+
+	var healthChecked []string
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/api/org":
+			return response(200, `{"id":1,"name":"Main Org."}`), nil
+		case "/api/user/orgs":
+			return response(200, `[{"orgId":1,"name":"Main Org."}]`), nil
+		case "/api/datasources":
+			return response(200, `[
+				{"uid":"prom","name":"Prometheus","type":"prometheus","url":"http://prometheus:9090","isDefault":true},
+				{"uid":"mimir","name":"Mimir","type":"prometheus","url":"http://mimir:9009"},
+				{"uid":"loki","name":"Loki","type":"loki"}
+			]`), nil
+		case "/api/datasources/uid/prom/health":
+			healthChecked = append(healthChecked, "prom")
+			return response(200, `{"status":"OK","message":"Successfully queried the Prometheus API."}`), nil
+		case "/api/datasources/uid/mimir/health":
+			healthChecked = append(healthChecked, "mimir")
+			return response(400, `{"status":"ERROR","message":"connection refused"}`), nil
+		}
+		return response(404, "not found"), nil
+	})
+
+	targets, err := getAllDatasources(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: client})
+	require.NoError(t, err)
+	require.Len(t, targets, 3)
+	assert.ElementsMatch(t, []string{"prom", "mimir"}, healthChecked, "skipped datasources are not health checked")
+
+	// the health is cached, unhealthy datasources are checked again after their backoff only
+	again, err := getAllDatasources(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: client})
+	require.NoError(t, err)
+	assert.Len(t, healthChecked, 2)
+	assert.Equal(t, targets, again)
+
+	prom := targets[0]
+	assert.Equal(t, "default-prom", prom.Id)
+	assert.Equal(t, "Prometheus", prom.Label)
+	assert.Equal(t, []string{"prometheus"}, prom.Attributes["grafana.datasource.type"])
+	assert.Equal(t, []string{"http://prometheus:9090"}, prom.Attributes["grafana.datasource.url"])
+	assert.Equal(t, []string{"true"}, prom.Attributes["grafana.datasource.default"])
+	assert.Equal(t, []string{"healthy"}, prom.Attributes["grafana.datasource.health"])
+	assert.Equal(t, []string{"1"}, prom.Attributes["grafana.org.id"])
+
+	mimir := targets[1]
+	assert.Equal(t, []string{"false"}, mimir.Attributes["grafana.datasource.default"])
+	assert.Equal(t, []string{"unhealthy"}, mimir.Attributes["grafana.datasource.health"])
+	assert.Equal(t, []string{"connection refused"}, mimir.Attributes["grafana.datasource.health-message"])
+
+	loki := targets[2]
+	assert.Equal(t, []string{"unknown"}, loki.Attributes["grafana.datasource.health"])
+	assert.NotContains(t, loki.Attributes, "grafana.datasource.url")
+}
+
+func TestGetAllDatasources_ListFails(t *testing.T) {
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/api/datasources" {
+			return response(500, "internal error"), nil
+		}
+		return response(404, "not found"), nil
+	})
+
+	_, err := getAllDatasources(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: client})
+	assert.Error(t, err)
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extgrafana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/go-resty/resty/v2"
+)
+
+type DataSource struct {
+	ID          int    `json:"id"`
+	UID         string `json:"uid"`
+	OrgID       int    `json:"orgId"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	TypeName    string `json:"typeName"`
+	TypeLogoUrl string `json:"typeLogoUrl"`
+	Access      string `json:"access"`
+	URL         string `json:"url"`
+	User        string `json:"user"`
+	Database    string `json:"database"`
+	BasicAuth   bool   `json:"basicAuth"`
+	IsDefault   bool   `json:"isDefault"`
+	JsonData    any    `json:"jsonData"`
+	ReadOnly    bool   `json:"readOnly"`
+}
+
+// DataSourceHealth is the outcome of the health check of a datasource, which makes Grafana query it.
+type DataSourceHealth struct {
+	Healthy bool
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// GetDataSources lists all datasources of the organization.
+func GetDataSources(ctx context.Context, client *resty.Client, orgId int) ([]DataSource, error) {
+	var dataSources []DataSource
+	res, err := SetOrganization(client.R(), orgId).
+		SetContext(ctx).
+		SetResult(&dataSources).
+		Get("/api/datasources")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve datasources from Grafana: %w", err)
+	}
+
+	if res.StatusCode() != 200 {
+		return nil, fmt.Errorf("grafana API responded with unexpected status code %d while retrieving datasources. Full response: %v", res.StatusCode(), res.String())
+	}
+	return dataSources, nil
+}
+
+// GetDataSourceHealth checks the health of the datasource. An UnavailableError is only returned if Grafana
+// could not be reached, or responded with 429 or a gateway error of a proxy in front of it. An unhealthy
+// datasource or one not supporting health checks is reported as unhealthy, as Grafana responds to them
+// with 400, 500 or 503.
+func GetDataSourceHealth(ctx context.Context, client *resty.Client, orgId int, uid string) (DataSourceHealth, error) {
+	var health DataSourceHealth
+	// Use new endpoint because of deprecated id usage: https://grafana.com/whats-new/2026-04-14-deprecated-data-source-apis-disabled-by-default/
+	res, err := SetOrganization(client.R(), orgId).
+		SetContext(ctx).
+		Get(fmt.Sprintf("/api/datasources/uid/%s/health", uid))
+	if err != nil {
+		return DataSourceHealth{}, &UnavailableError{Err: err}
+	}
+	if slices.Contains([]int{429, 502, 504}, res.StatusCode()) {
+		return DataSourceHealth{}, &UnavailableError{Err: fmt.Errorf("grafana API responded with status code %d while checking the health of datasource %s. Full response: %v", res.StatusCode(), uid, res.String()), StatusCode: res.StatusCode()}
+	}
+	// the body is only informative, datasources not supporting health checks don't respond with JSON
+	_ = json.Unmarshal(res.Body(), &health)
+	health.Healthy = res.StatusCode() == 200
+	if health.Status == "" {
+		health.Status = "ERROR"
+		if health.Healthy {
+			health.Status = "OK"
+		}
+	}
+	if !health.Healthy && health.Message == "" {
+		health.Message = fmt.Sprintf("status code %d: %s", res.StatusCode(), res.String())
+	}
+	return health, nil
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extgrafana
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_api"
+)
+
+// LastTargetsByInstance are the targets of the last successful discovery per instance, reported again
+// while an instance cannot be discovered, so its targets do not disappear during an outage.
+type LastTargetsByInstance struct {
+	mu      sync.Mutex
+	targets map[string][]discovery_kit_api.Target
+}
+
+func NewLastTargetsByInstance() *LastTargetsByInstance {
+	return &LastTargetsByInstance{targets: make(map[string][]discovery_kit_api.Target)}
+}
+
+// Discover reports an error when no instance could be discovered, so the cached discovery keeps the
+// last known targets instead of replacing them with an empty list. Instances failing on their own are
+// reported with the targets of their last successful discovery.
+func (l *LastTargetsByInstance) Discover(ctx context.Context, instances []Instance, what string, discoverInstance func(context.Context, Instance) ([]discovery_kit_api.Target, error)) ([]discovery_kit_api.Target, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := make([]discovery_kit_api.Target, 0, 1000)
+	var errs []error
+	for _, instance := range instances {
+		targets, err := discoverInstance(ctx, instance)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("instance %s: %w", instance.Name, err))
+			result = append(result, l.targets[instance.Name]...)
+			continue
+		}
+		l.targets[instance.Name] = targets
+		result = append(result, targets...)
+	}
+
+	if len(errs) > 0 && len(errs) == len(instances) {
+		return nil, errors.Join(errs...)
+	}
+	if len(errs) > 0 {
+		log.Warn().Err(errors.Join(errs...)).Msgf("Failed to discover the %s of some Grafana instances, keeping their previously discovered targets.", what)
+	}
+	return result, nil
+}
+
+// TargetIdPrefix scopes target ids to the instance and, unless it is the home organization, to the
+// organization. The instance is identified by its name, as instances may share a host, e.g. one per
+// organization or several stacks behind the same host with different paths.
+func TargetIdPrefix(instance Instance, org Organization) string {
+	if !org.Home {
+		return fmt.Sprintf("%s-%d", instance.Name, org.ID)
+	}
+	return instance.Name
+}
+
+func AddOrganizationAttributes(attributes map[string][]string, org Organization) {
+	if org.ID > 0 {
+		attributes["grafana.org.id"] = []string{strconv.Itoa(org.ID)}
+		attributes["grafana.org.name"] = []string{org.Name}
+	}
+}
+
+// FirstAttribute returns the first value of the attribute of a target, or "" if it has none.
+func FirstAttribute(attributes map[string][]string, key string) string {
+	if values := attributes[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
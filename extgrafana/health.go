@@ -0,0 +1,126 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extgrafana
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/extension-grafana/config"
+)
+
+// DataSourceHealthCache caches the outcome of datasource health checks across discovery runs and
+// between the discoveries, as a health check makes Grafana query the datasource.
+var DataSourceHealthCache = NewHealthCache(time.Now)
+
+type healthEntry struct {
+	health    *DataSourceHealth
+	failures  int
+	nextCheck time.Time
+	// checking is closed once the running check of the entry is done, nil if none is running.
+	checking chan struct{}
+}
+
+type HealthCache struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	entries map[string]*healthEntry
+}
+
+func NewHealthCache(now func() time.Time) *HealthCache {
+	return &HealthCache{now: now, entries: make(map[string]*healthEntry)}
+}
+
+// CachedDataSourceHealth returns the health of the datasource, or nil if it could not be checked.
+// Healthy datasources are checked again after the configured TTL, unhealthy ones with an exponential
+// backoff.
+func CachedDataSourceHealth(ctx context.Context, instance Instance, org Organization, ds DataSource) *DataSourceHealth {
+	return DataSourceHealthCache.Check(ctx, fmt.Sprintf("%s/%d/%s", instance.Name, org.ID, ds.UID), ds.Name, func(ctx context.Context) *DataSourceHealth {
+		health, err := GetDataSourceHealth(ctx, instance.Client, org.ID, ds.UID)
+		if err != nil {
+			log.Debug().Err(err).Msgf("Failed to check the health of datasource %s.", ds.Name)
+			return nil
+		}
+		return &health
+	})
+}
+
+// SkipsHealthCheck tells whether the datasource is configured not to be health checked.
+func SkipsHealthCheck(ds DataSource) bool {
+	skipped := config.Config.DiscoverySkipHealthCheckDatasources
+	return slices.Contains(skipped, "*") || slices.Contains(skipped, ds.UID) || slices.Contains(skipped, ds.Name)
+}
+
+// Check returns the cached health of the key, requesting it once it is due. A request returning nil
+// counts as unhealthy. Concurrent callers of a due key wait for a single request instead of all
+// requesting the health.
+func (c *HealthCache) Check(ctx context.Context, key string, name string, request func(ctx context.Context) *DataSourceHealth) *DataSourceHealth {
+	for {
+		c.mu.Lock()
+		entry, ok := c.entries[key]
+		if !ok {
+			entry = &healthEntry{}
+			c.entries[key] = entry
+		}
+		if checking := entry.checking; checking != nil {
+			c.mu.Unlock()
+			select {
+			case <-checking:
+				continue
+			case <-ctx.Done():
+				c.mu.Lock()
+				health := entry.health
+				c.mu.Unlock()
+				return health
+			}
+		}
+		if c.now().Before(entry.nextCheck) {
+			health := entry.health
+			c.mu.Unlock()
+			return health
+		}
+		checking := make(chan struct{})
+		entry.checking = checking
+		c.mu.Unlock()
+
+		health := request(ctx)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		entry.checking = nil
+		close(checking)
+		c.update(entry, name, health)
+		return health
+	}
+}
+
+func (c *HealthCache) update(entry *healthEntry, name string, health *DataSourceHealth) {
+	wasHealthy := entry.failures == 0
+	entry.health = health
+	if health != nil && health.Healthy {
+		if !wasHealthy {
+			log.Info().Msgf("Datasource %s is healthy again.", name)
+		}
+		entry.failures = 0
+		entry.nextCheck = c.now().Add(config.Config.GetDatasourceHealthCacheTtl())
+		return
+	}
+
+	entry.failures++
+	backoff := min(config.Config.GetDatasourceHealthBackoff()<<min(entry.failures-1, 16), config.Config.GetDatasourceHealthBackoffMax())
+	if wasHealthy {
+		log.Warn().Msgf("Datasource %s is not healthy, checking it again in %s.", name, backoff)
+	} else {
+		log.Debug().Msgf("Datasource %s is still not healthy after %d checks, checking it again in %s.", name, entry.failures, backoff)
+	}
+	entry.nextCheck = c.now().Add(backoff)
+}
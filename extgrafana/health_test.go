@@ -0,0 +1,115 @@
+package extgrafana
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/steadybit/extension-grafana/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthCache_CachesHealthyAndBacksOffUnhealthyDatasources(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewHealthCache(func() time.Time { return now })
+	healthy := true
+	requests := 0
+	check := func() bool {
+		return cache.Check(context.Background(), "grafana.local/0/prom", "Prometheus", func(ctx context.Context) *DataSourceHealth {
+			requests++
+			return &DataSourceHealth{Healthy: healthy}
+		}).Healthy
+	}
+
+	assert.True(t, check())
+	now = now.Add(config.DefaultDatasourceHealthCacheTtl - time.Second)
+	assert.True(t, check())
+	assert.Equal(t, 1, requests, "healthy datasource is cached for the TTL")
+
+	healthy = false
+	now = now.Add(time.Second)
+	assert.False(t, check())
+	assert.Equal(t, 2, requests)
+
+	// backoff doubles with every failed check: 1m, 2m, 4m
+	for _, backoff := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute} {
+		now = now.Add(backoff - time.Second)
+		before := requests
+		assert.False(t, check())
+		assert.Equal(t, before, requests, "unhealthy datasource is not checked during its backoff of %s", backoff)
+		now = now.Add(time.Second)
+		assert.False(t, check())
+		assert.Equal(t, before+1, requests)
+	}
+
+	healthy = true
+	now = now.Add(8 * time.Minute)
+	assert.True(t, check())
+	now = now.Add(time.Minute)
+	assert.True(t, check())
+	assert.Equal(t, 6, requests, "recovered datasource is cached for the TTL again")
+}
+
+func TestHealthCache_BoundsBackoff(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewHealthCache(func() time.Time { return now })
+	requests := 0
+	for range 40 {
+		cache.Check(context.Background(), "key", "Prometheus", func(ctx context.Context) *DataSourceHealth {
+			requests++
+			return nil
+		})
+		now = now.Add(config.DefaultDatasourceHealthBackoffMax)
+	}
+	assert.Equal(t, 40, requests)
+}
+
+func TestHealthCache_ChecksDueDatasourceOnceForConcurrentCallers(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewHealthCache(func() time.Time { return now })
+	var requests atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	request := func(ctx context.Context) *DataSourceHealth {
+		if requests.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		return &DataSourceHealth{Healthy: true}
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan bool, 10)
+	check := func() {
+		defer wg.Done()
+		results <- cache.Check(context.Background(), "key", "Prometheus", request).Healthy
+	}
+	wg.Add(1)
+	go check()
+	<-started
+	for range 9 {
+		wg.Add(1)
+		go check()
+	}
+	close(release)
+	wg.Wait()
+	close(results)
+
+	for healthy := range results {
+		assert.True(t, healthy)
+	}
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestSkipsHealthCheck_SkipsConfiguredDatasources(t *testing.T) {
+	config.Config.DiscoverySkipHealthCheckDatasources = []string{"skipped-uid"}
+	defer func() { config.Config.DiscoverySkipHealthCheckDatasources = nil }()
+
+	assert.True(t, SkipsHealthCheck(DataSource{UID: "skipped-uid", Name: "Skipped"}))
+	assert.False(t, SkipsHealthCheck(DataSource{UID: "other-uid", Name: "Other"}))
+
+	config.Config.DiscoverySkipHealthCheckDatasources = []string{"*"}
+	assert.True(t, SkipsHealthCheck(DataSource{UID: "other-uid", Name: "Other"}))
+}
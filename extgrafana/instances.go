@@ -0,0 +1,99 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extgrafana
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/steadybit/extension-grafana/config"
+)
+
+// Instance is a Grafana instance together with the client used to talk to its API.
+type Instance struct {
+	Name    string
+	BaseUrl string
+	Client  *resty.Client
+	// serviceToken authenticates the clients created with NewClient.
+	serviceToken string
+}
+
+// NewInstances creates an Instance for every configured Grafana instance. configure is applied to
+// every client, so each package can tune e.g. retries to its needs.
+func NewInstances(specs []config.Instance, configure func(client *resty.Client)) []Instance {
+	instances := make([]Instance, 0, len(specs))
+	for _, spec := range specs {
+		client := newClient(spec.ApiBaseUrl, spec.ServiceToken, config.Config.GetApiTimeout())
+		if configure != nil {
+			configure(client)
+		}
+		instances = append(instances, Instance{
+			Name:         spec.Name,
+			BaseUrl:      spec.ApiBaseUrl,
+			Client:       client,
+			serviceToken: spec.ServiceToken,
+		})
+	}
+	return instances
+}
+
+// NewClient creates a client for the instance which doesn't retry and uses the given timeout. It is meant
+// for requests that must not be sent twice or take longer than the usual API calls.
+func (i Instance) NewClient(timeout time.Duration) *resty.Client {
+	return newClient(i.BaseUrl, i.serviceToken, timeout)
+}
+
+func newClient(baseUrl string, serviceToken string, timeout time.Duration) *resty.Client {
+	client := resty.New()
+	client.SetTimeout(timeout)
+	client.SetBaseURL(baseUrl)
+	client.SetHeader("Authorization", "Bearer "+serviceToken)
+	client.SetHeader("Content-Type", "application/json")
+	return client
+}
+
+// Host returns the host name of the instance, as reported in the grafana.host target attribute.
+func (i Instance) Host() string {
+	urlParsed, err := url.Parse(i.BaseUrl)
+	if err != nil {
+		return ""
+	}
+	return urlParsed.Hostname()
+}
+
+// FindInstance returns the instance with the given name. Targets discovered before multiple
+// instances were supported carry no instance name, they are resolved by host and finally fall
+// back to the first instance. The host is ignored whenever a name is given.
+func FindInstance(instances []Instance, name string, host string) (*Instance, error) {
+	if name != "" {
+		for i := range instances {
+			if instances[i].Name == name {
+				return &instances[i], nil
+			}
+		}
+		return nil, fmt.Errorf("grafana instance '%s' is not configured", name)
+	}
+	var found *Instance
+	for i := range instances {
+		if host != "" && instances[i].Host() == host {
+			if found != nil {
+				return nil, fmt.Errorf("grafana instances '%s' and '%s' share the host '%s', rediscover the target to resolve its instance", found.Name, instances[i].Name, host)
+			}
+			found = &instances[i]
+		}
+	}
+	if found != nil {
+		return found, nil
+	}
+	if len(instances) > 0 {
+		return &instances[0], nil
+	}
+	return nil, fmt.Errorf("no grafana instance configured")
+}
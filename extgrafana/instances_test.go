@@ -0,0 +1,43 @@
+package extgrafana
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetIdPrefix_DistinguishesInstancesOnTheSameHost(t *testing.T) {
+	prod := Instance{Name: "prod", BaseUrl: "https://grafana.example.com/prod"}
+	staging := Instance{Name: "staging", BaseUrl: "https://grafana.example.com/staging"}
+
+	assert.Equal(t, "prod", TargetIdPrefix(prod, Organization{ID: 1, Home: true}))
+	assert.Equal(t, "staging", TargetIdPrefix(staging, Organization{ID: 1, Home: true}))
+	assert.Equal(t, "prod-2", TargetIdPrefix(prod, Organization{ID: 2}))
+}
+
+func TestFindInstance(t *testing.T) {
+	instances := []Instance{
+		{Name: "prod", BaseUrl: "https://grafana.example.com/prod"},
+		{Name: "staging", BaseUrl: "https://grafana.example.com/staging"},
+		{Name: "cloud", BaseUrl: "https://yourcompany.grafana.net"},
+	}
+
+	instance, err := FindInstance(instances, "staging", "yourcompany.grafana.net")
+	require.NoError(t, err)
+	assert.Equal(t, "staging", instance.Name, "the host is ignored when a name is given")
+
+	_, err = FindInstance(instances, "unknown", "yourcompany.grafana.net")
+	assert.EqualError(t, err, "grafana instance 'unknown' is not configured")
+
+	instance, err = FindInstance(instances, "", "yourcompany.grafana.net")
+	require.NoError(t, err)
+	assert.Equal(t, "cloud", instance.Name)
+
+	_, err = FindInstance(instances, "", "grafana.example.com")
+	assert.ErrorContains(t, err, "share the host 'grafana.example.com'")
+
+	instance, err = FindInstance(instances, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "prod", instance.Name)
+}
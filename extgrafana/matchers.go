@@ -0,0 +1,147 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extgrafana
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type MatchType string
+
+const (
+	MatchEqual     MatchType = "="
+	MatchNotEqual  MatchType = "!="
+	MatchRegexp    MatchType = "=~"
+	MatchNotRegexp MatchType = "!~"
+)
+
+// LabelMatcher matches a single label, in the syntax of Prometheus label matchers, e.g. pod=~"checkout-.*".
+// Like in Prometheus, regular expressions are anchored and a missing label matches the empty string.
+type LabelMatcher struct {
+	Name  string
+	Type  MatchType
+	Value string
+	re    *regexp.Regexp
+}
+
+func NewLabelMatcher(name string, matchType MatchType, value string) (LabelMatcher, error) {
+	matcher := LabelMatcher{Name: name, Type: matchType, Value: value}
+	if matchType == MatchRegexp || matchType == MatchNotRegexp {
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return LabelMatcher{}, fmt.Errorf("invalid regular expression of matcher for '%s': %w", name, err)
+		}
+		matcher.re = re
+	}
+	return matcher, nil
+}
+
+func (m LabelMatcher) Matches(value string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	case MatchNotRegexp:
+		return !m.re.MatchString(value)
+	}
+	return false
+}
+
+func (m LabelMatcher) String() string {
+	return fmt.Sprintf("%s%s%q", m.Name, m.Type, m.Value)
+}
+
+// MatchesLabels tells whether all matchers match the labels.
+func MatchesLabels(matchers []LabelMatcher, labels map[string]string) bool {
+	for _, matcher := range matchers {
+		if !matcher.Matches(labels[matcher.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLabelMatchers parses comma-separated matchers, e.g. namespace="shop",pod=~"checkout-.*". The
+// surrounding braces of a Prometheus selector are optional, values may be quoted or bare.
+func ParseLabelMatchers(input string) ([]LabelMatcher, error) {
+	input = strings.TrimSpace(input)
+	input = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(input, "{"), "}"))
+	matchers := make([]LabelMatcher, 0)
+	for input != "" {
+		nameEnd := strings.IndexAny(input, "=!")
+		if nameEnd <= 0 {
+			return nil, fmt.Errorf("invalid label matcher '%s', expected <label><operator><value>", input)
+		}
+		name := strings.TrimSpace(input[:nameEnd])
+		input = input[nameEnd:]
+
+		var matchType MatchType
+		for _, candidate := range []MatchType{MatchRegexp, MatchNotRegexp, MatchNotEqual, MatchEqual} {
+			if strings.HasPrefix(input, string(candidate)) {
+				matchType = candidate
+				break
+			}
+		}
+		if matchType == "" {
+			return nil, fmt.Errorf("invalid operator of label matcher for '%s', expected one of =, !=, =~ or !~", name)
+		}
+		input = strings.TrimSpace(input[len(matchType):])
+
+		value, rest, err := parseMatcherValue(input)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of label matcher for '%s': %w", name, err)
+		}
+		matcher, err := NewLabelMatcher(name, matchType, value)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+
+		input = strings.TrimSpace(rest)
+		if input != "" {
+			if input[0] != ',' {
+				return nil, fmt.Errorf("expected ',' after label matcher for '%s'", name)
+			}
+			input = strings.TrimSpace(input[1:])
+		}
+	}
+	return matchers, nil
+}
+
+// parseMatcherValue reads a quoted value up to its closing quote, or a bare value up to the next comma.
+func parseMatcherValue(input string) (string, string, error) {
+	if input == "" || (input[0] != '"' && input[0] != '\'' && input[0] != '`') {
+		end := strings.IndexByte(input, ',')
+		if end == -1 {
+			end = len(input)
+		}
+		return strings.TrimSpace(input[:end]), input[end:], nil
+	}
+
+	quote := input[0]
+	for i := 1; i < len(input); i++ {
+		if input[i] == '\\' && quote != '`' {
+			i++
+			continue
+		}
+		if input[i] == quote {
+			if quote == '\'' {
+				return strings.ReplaceAll(input[1:i], `\'`, `'`), input[i+1:], nil
+			}
+			value, err := strconv.Unquote(input[:i+1])
+			return value, input[i+1:], err
+		}
+	}
+	return "", "", fmt.Errorf("missing closing quote")
+}
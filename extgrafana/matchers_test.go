@@ -0,0 +1,50 @@
+package extgrafana
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLabelMatchers(t *testing.T) {
+	matchers, err := ParseLabelMatchers(`{namespace="shop", pod=~"checkout-.*",team!=payments , label.severity!~"info|debug"}`)
+	require.NoError(t, err)
+
+	require.Len(t, matchers, 4)
+	assert.Equal(t, "namespace", matchers[0].Name)
+	assert.Equal(t, MatchEqual, matchers[0].Type)
+	assert.Equal(t, "shop", matchers[0].Value)
+	assert.Equal(t, MatchRegexp, matchers[1].Type)
+	assert.Equal(t, "payments", matchers[2].Value)
+	assert.Equal(t, MatchNotEqual, matchers[2].Type)
+	assert.Equal(t, "label.severity", matchers[3].Name)
+	assert.Equal(t, MatchNotRegexp, matchers[3].Type)
+
+	assert.True(t, MatchesLabels(matchers, map[string]string{"namespace": "shop", "pod": "checkout-1", "team": "checkout"}))
+	assert.False(t, MatchesLabels(matchers, map[string]string{"namespace": "shop", "pod": "my-checkout-1"}), "regular expressions are anchored")
+	assert.False(t, MatchesLabels(matchers, map[string]string{"namespace": "shop", "pod": "checkout-1", "team": "payments"}))
+	assert.False(t, MatchesLabels(matchers, map[string]string{"pod": "checkout-1"}), "missing label matches the empty string")
+}
+
+func TestParseLabelMatchers_QuotedValues(t *testing.T) {
+	matchers, err := ParseLabelMatchers(`folder="Shop, Checkout",summary="say \"hi\""`)
+	require.NoError(t, err)
+
+	require.Len(t, matchers, 2)
+	assert.Equal(t, "Shop, Checkout", matchers[0].Value)
+	assert.Equal(t, `say "hi"`, matchers[1].Value)
+}
+
+func TestParseLabelMatchers_Empty(t *testing.T) {
+	matchers, err := ParseLabelMatchers("  ")
+	require.NoError(t, err)
+	assert.Empty(t, matchers)
+}
+
+func TestParseLabelMatchers_Invalid(t *testing.T) {
+	for _, input := range []string{`namespace`, `="shop"`, `namespace=~"("`, `namespace="shop`, `namespace="shop" pod="x"`, `namespace<"shop"`} {
+		_, err := ParseLabelMatchers(input)
+		assert.Error(t, err, input)
+	}
+}
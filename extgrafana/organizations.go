@@ -0,0 +1,99 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extgrafana
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// OrgIdHeader selects the organization a Grafana API request is executed in.
+const OrgIdHeader = "X-Grafana-Org-Id"
+
+// Organization is a Grafana organization. An ID of 0 stands for the organization of the service token
+// when it could not be determined.
+type Organization struct {
+	ID   int    `json:"orgId"`
+	Name string `json:"name"`
+	// Home is set for the organization the service token belongs to, which is used for requests
+	// without OrgIdHeader.
+	Home bool `json:"-"`
+}
+
+type currentOrganization struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// homeOnlyWarned remembers the base URLs of the instances that were warned to reach their home
+// organization only, so the warning isn't repeated on every discovery.
+var homeOnlyWarned sync.Map
+
+// GetOrganizations lists the organizations reachable with the client's credentials. Service account
+// tokens, the only bearer tokens Grafana issues, only reach their own organization. The result is never
+// empty: if the organizations cannot be listed, the organization of the token is returned, with an ID
+// of 0 if even that is unknown.
+func GetOrganizations(ctx context.Context, client *resty.Client) []Organization {
+	var home currentOrganization
+	res, err := client.R().
+		SetContext(ctx).
+		SetResult(&home).
+		Get("/api/org")
+	if err != nil || !res.IsSuccess() {
+		log.Warn().Err(err).Msgf("Failed to retrieve the current organization from Grafana, status code %d.", statusCode(res))
+		return []Organization{{Home: true}}
+	}
+
+	var organizations []Organization
+	res, err = client.R().
+		SetContext(ctx).
+		SetResult(&organizations).
+		Get("/api/user/orgs")
+	if err != nil || !res.IsSuccess() || len(organizations) == 0 {
+		log.Debug().Err(err).Msgf("Failed to list the organizations from Grafana, status code %d. Using organization %d only.", statusCode(res), home.ID)
+		organizations = []Organization{{ID: home.ID, Name: home.Name}}
+	}
+
+	for i := range organizations {
+		organizations[i].Home = organizations[i].ID == home.ID
+	}
+	if len(organizations) == 1 && organizations[0].Home {
+		warnHomeOnly(client, home)
+	}
+	return organizations
+}
+
+// warnHomeOnly warns once per instance that only the organization of the token is discovered, which
+// is all a service account token reaches.
+func warnHomeOnly(client *resty.Client, home currentOrganization) {
+	if _, warned := homeOnlyWarned.LoadOrStore(client.BaseURL, true); warned {
+		return
+	}
+	log.Warn().Msgf("Only organization %d (%s) of Grafana %s is reachable with the configured token. Service account tokens are bound to their organization, configure an instance per organization to discover further ones.",
+		home.ID, home.Name, client.BaseURL)
+}
+
+// SetOrganization scopes the request to the organization. Requests for an organization with an ID of 0
+// are executed in the organization of the service token.
+func SetOrganization(request *resty.Request, orgId int) *resty.Request {
+	if orgId > 0 {
+		request.SetHeader(OrgIdHeader, strconv.Itoa(orgId))
+	}
+	return request
+}
+
+func statusCode(res *resty.Response) int {
+	if res == nil {
+		return 0
+	}
+	return res.StatusCode()
+}
@@ -0,0 +1,51 @@
+package extgrafana
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// organizationsClient responds with the given organizations of the user, or 404 if empty like for a
+// service account.
+func organizationsClient(orgs string) *resty.Client {
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		body, status := `{"id":1,"name":"Main Org."}`, 200
+		if req.URL.Path == "/api/user/orgs" {
+			body = orgs
+			if orgs == "" {
+				body, status = `{"message":"user not found"}`, 404
+			}
+		}
+		return &http.Response{
+			StatusCode: status,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		}, nil
+	})
+	client.SetBaseURL("http://grafana.local")
+	return client
+}
+
+func TestGetOrganizations(t *testing.T) {
+	t.Cleanup(func() { homeOnlyWarned.Clear() })
+
+	organizations := GetOrganizations(context.Background(), organizationsClient(`[{"orgId":1,"name":"Main Org."},{"orgId":2,"name":"Shop"}]`))
+	assert.Equal(t, []Organization{{ID: 1, Name: "Main Org.", Home: true}, {ID: 2, Name: "Shop"}}, organizations)
+	_, warned := homeOnlyWarned.Load("http://grafana.local")
+	assert.False(t, warned)
+}
+
+func TestGetOrganizations_WarnsWhenOnlyTheHomeOrganizationIsReachable(t *testing.T) {
+	t.Cleanup(func() { homeOnlyWarned.Clear() })
+
+	organizations := GetOrganizations(context.Background(), organizationsClient(""))
+	assert.Equal(t, []Organization{{ID: 1, Name: "Main Org.", Home: true}}, organizations)
+	_, warned := homeOnlyWarned.Load("http://grafana.local")
+	assert.True(t, warned, "the token only reaches its home organization")
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extgrafana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Sample is the latest value of a series returned by an instant query.
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+type queryRequest struct {
+	Queries []query `json:"queries"`
+	From    string  `json:"from"`
+	To      string  `json:"to"`
+}
+
+type query struct {
+	RefId      string          `json:"refId"`
+	Datasource queryDatasource `json:"datasource"`
+	Expr       string          `json:"expr"`
+	Instant    bool            `json:"instant"`
+	Range      bool            `json:"range"`
+	Format     string          `json:"format"`
+}
+
+type queryDatasource struct {
+	UID string `json:"uid"`
+}
+
+type queryResponse struct {
+	Results map[string]struct {
+		Error  string `json:"error"`
+		Frames []struct {
+			Schema struct {
+				Fields []struct {
+					Name   string            `json:"name"`
+					Type   string            `json:"type"`
+					Labels map[string]string `json:"labels"`
+				} `json:"fields"`
+			} `json:"schema"`
+			Data struct {
+				Values []json.RawMessage `json:"values"`
+			} `json:"data"`
+		} `json:"frames"`
+	} `json:"results"`
+}
+
+// QueryInstant evaluates the PromQL expression at the given time against the Prometheus compatible
+// datasource through /api/ds/query. Series without a value, e.g. NaN values, are left out. Failed requests and responses
+// with 429 or 5xx are reported as UnavailableError.
+func QueryInstant(ctx context.Context, client *resty.Client, orgId int, datasourceUid string, expr string, at time.Time) ([]Sample, error) {
+	var response queryResponse
+	res, err := SetOrganization(client.R(), orgId).
+		SetContext(ctx).
+		SetBody(queryRequest{
+			Queries: []query{{
+				RefId:      "A",
+				Datasource: queryDatasource{UID: datasourceUid},
+				Expr:       expr,
+				Instant:    true,
+				Format:     "time_series",
+			}},
+			From: strconv.FormatInt(at.Add(-5*time.Minute).UnixMilli(), 10),
+			To:   strconv.FormatInt(at.UnixMilli(), 10),
+		}).
+		SetResult(&response).
+		Post("/api/ds/query")
+	if err != nil {
+		return nil, &UnavailableError{Err: fmt.Errorf("failed to query datasource %s: %w", datasourceUid, err)}
+	}
+	if !res.IsSuccess() {
+		err := fmt.Errorf("failed to query datasource %s, status code %d: %s", datasourceUid, res.StatusCode(), res.String())
+		if IsUnavailableStatus(res.StatusCode()) {
+			return nil, &UnavailableError{Err: err}
+		}
+		return nil, err
+	}
+
+	result, ok := response.Results["A"]
+	if !ok {
+		return nil, nil
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("failed to query datasource %s: %s", datasourceUid, result.Error)
+	}
+	samples := make([]Sample, 0, len(result.Frames))
+	for _, frame := range result.Frames {
+		for i, field := range frame.Schema.Fields {
+			if field.Type != "number" || i >= len(frame.Data.Values) {
+				continue
+			}
+			var values []*float64
+			if err := json.Unmarshal(frame.Data.Values[i], &values); err != nil || len(values) == 0 || values[len(values)-1] == nil {
+				continue
+			}
+			samples = append(samples, Sample{Labels: field.Labels, Value: *values[len(values)-1]})
+		}
+	}
+	return samples, nil
+}
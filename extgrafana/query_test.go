@@ -0,0 +1,65 @@
+package extgrafana
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RoundTripperFunc lets us stub HTTP responses.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newTestClient(fn RoundTripperFunc) *resty.Client {
+	return resty.NewWithClient(&http.Client{Transport: fn})
+}
+
+func TestQueryInstant(t *testing.T) {
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		assert.Equal(t, "/api/ds/query", req.URL.Path)
+		assert.Equal(t, "2", req.Header.Get(OrgIdHeader))
+		var body queryRequest
+		raw, _ := io.ReadAll(req.Body)
+		require.NoError(t, json.Unmarshal(raw, &body))
+		assert.Equal(t, "prom", body.Queries[0].Datasource.UID)
+		assert.Equal(t, "up", body.Queries[0].Expr)
+		assert.True(t, body.Queries[0].Instant)
+		assert.Equal(t, "1700000000000", body.To)
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body: io.NopCloser(strings.NewReader(`{"results":{"A":{"frames":[
+				{"schema":{"fields":[{"name":"Time","type":"time"},{"name":"Value","type":"number","labels":{"job":"api"}}]},"data":{"values":[[1700000000000],[1]]}},
+				{"schema":{"fields":[{"name":"Time","type":"time"},{"name":"Value","type":"number","labels":{"job":"db"}}]},"data":{"values":[[1700000000000],[null]]}}
+			]}}}`)),
+		}, nil
+	})
+
+	samples, err := QueryInstant(context.Background(), client, 2, "prom", "up", time.UnixMilli(1700000000000))
+	require.NoError(t, err)
+	assert.Equal(t, []Sample{{Labels: map[string]string{"job": "api"}, Value: 1}}, samples, "series without value are left out")
+}
+
+func TestQueryInstant_QueryError(t *testing.T) {
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 400,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"results":{"A":{"error":"parse error"}}}`)),
+		}, nil
+	})
+
+	_, err := QueryInstant(context.Background(), client, 0, "prom", "up{", time.Now())
+	assert.Error(t, err)
+}
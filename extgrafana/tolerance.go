@@ -0,0 +1,125 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extgrafana
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/extension-kit/extutil"
+)
+
+// minPollsForErrorRatio is the number of polls before the error ratio is applied, so that a failure of
+// one of the first polls does not exceed any ratio.
+const minPollsForErrorRatio = 10
+
+// UnavailableError is a failure to request Grafana which may be transient: the request failed, or
+// Grafana responded with 429 or 5xx.
+type UnavailableError struct {
+	Err error
+	// StatusCode is the status code Grafana responded with, 0 if the request failed.
+	StatusCode int
+}
+
+func (e *UnavailableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// IsTimeout tells whether the request timed out, either on its way to Grafana or because Grafana (or a
+// gateway in front of it) gave up with 504.
+func IsTimeout(err error) bool {
+	var unavailable *UnavailableError
+	if errors.As(err, &unavailable) && unavailable.StatusCode == http.StatusGatewayTimeout {
+		return true
+	}
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func IsUnavailableStatus(statusCode int) bool {
+	return statusCode == 429 || statusCode >= 500
+}
+
+// ApiErrorTolerance are the transient API errors a check tolerates. The step errors once more than
+// MaxConsecutive polls in a row failed, or, if set, more than MaxRatio percent of all polls.
+type ApiErrorTolerance struct {
+	MaxConsecutive int
+	MaxRatio       float64
+	Polls          int
+	Failures       int
+	Consecutive    int
+}
+
+// ApiErrorToleranceParameters configure the ApiErrorTolerance of a check polling what, e.g. "the alert
+// rule", see ParseApiErrorTolerance.
+func ApiErrorToleranceParameters(what string, order int) []action_kit_api.ActionParameter {
+	return []action_kit_api.ActionParameter{
+		{
+			Name:         "toleratedConsecutiveApiErrors",
+			Label:        "Tolerated Consecutive API Errors",
+			Description:  new(fmt.Sprintf("How many polls in a row may fail to retrieve %s from Grafana, e.g. because of a timeout or a 502, before the step errors. Failed polls are shown as unknown state.", what)),
+			Type:         action_kit_api.ActionParameterTypeInteger,
+			DefaultValue: new("3"),
+			Advanced:     new(true),
+			Required:     new(false),
+			Order:        new(order),
+		},
+		{
+			Name:        "toleratedApiErrorRatio",
+			Label:       "Tolerated API Error Ratio",
+			Description: new(fmt.Sprintf("The share of all polls which may fail to retrieve %s from Grafana before the step errors, applied after %d polls. Not limited if empty.", what, minPollsForErrorRatio)),
+			Type:        action_kit_api.ActionParameterTypePercentage,
+			Advanced:    new(true),
+			Required:    new(false),
+			Order:       new(order + 1),
+		},
+	}
+}
+
+func ParseApiErrorTolerance(config map[string]any) ApiErrorTolerance {
+	var tolerance ApiErrorTolerance
+	if config["toleratedConsecutiveApiErrors"] != nil {
+		tolerance.MaxConsecutive = extutil.ToInt(config["toleratedConsecutiveApiErrors"])
+	}
+	if ratio, ok := config["toleratedApiErrorRatio"].(float64); ok {
+		tolerance.MaxRatio = ratio
+	}
+	return tolerance
+}
+
+func (t *ApiErrorTolerance) Succeeded() {
+	t.Polls++
+	t.Consecutive = 0
+}
+
+// Tolerate counts the failed poll and returns nil if it is tolerated, or else the error the step
+// errors with. Only UnavailableErrors are tolerated.
+func (t *ApiErrorTolerance) Tolerate(err error) error {
+	var unavailable *UnavailableError
+	if !errors.As(err, &unavailable) {
+		return err
+	}
+	t.Polls++
+	t.Failures++
+	t.Consecutive++
+	if t.Consecutive > t.MaxConsecutive {
+		return unavailable.Err
+	}
+	if t.MaxRatio > 0 && t.Polls >= minPollsForErrorRatio && float64(t.Failures)*100/float64(t.Polls) > t.MaxRatio {
+		return unavailable.Err
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package extgrafana
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApiErrorTolerance_Consecutive(t *testing.T) {
+	tolerance := ApiErrorTolerance{MaxConsecutive: 2}
+	unavailable := &UnavailableError{Err: errors.New("status code 502")}
+	assert.NoError(t, tolerance.Tolerate(unavailable))
+	tolerance.Succeeded()
+	assert.NoError(t, tolerance.Tolerate(unavailable))
+	assert.NoError(t, tolerance.Tolerate(unavailable))
+	err := tolerance.Tolerate(unavailable)
+	require.Error(t, err, "the third failure in a row exceeds the tolerance")
+	assert.NotErrorAs(t, err, new(*UnavailableError))
+
+	other := errors.New("status code 404")
+	assert.Equal(t, other, (&ApiErrorTolerance{MaxConsecutive: 5}).Tolerate(other), "only transient errors are tolerated")
+}
+
+func TestApiErrorTolerance_Ratio(t *testing.T) {
+	tolerance := ApiErrorTolerance{MaxConsecutive: 5, MaxRatio: 20}
+	unavailable := &UnavailableError{Err: errors.New("timeout")}
+	for range 8 {
+		tolerance.Succeeded()
+	}
+	assert.NoError(t, tolerance.Tolerate(unavailable), "the ratio is only applied after 10 polls")
+	assert.NoError(t, tolerance.Tolerate(unavailable), "2 of 10 polls failed")
+	tolerance.Succeeded()
+	assert.Error(t, tolerance.Tolerate(unavailable), "3 of 12 polls failed")
+}
@@ -0,0 +1,383 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extslos
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/action-kit/go/action_kit_sdk"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	extension_kit "github.com/steadybit/extension-kit"
+	"github.com/steadybit/extension-kit/extbuild"
+	"github.com/steadybit/extension-kit/extutil"
+)
+
+type SloCheckAction struct{}
+
+// Make sure action implements all required interfaces
+var (
+	_ action_kit_sdk.Action[SloCheckState]           = (*SloCheckAction)(nil)
+	_ action_kit_sdk.ActionWithStatus[SloCheckState] = (*SloCheckAction)(nil)
+)
+
+type SloCheckState struct {
+	// Instance is the name of the Grafana instance the target was discovered from.
+	Instance string
+	// OrgId is the organization the SLO belongs to, 0 for the organization of the service token.
+	OrgId   int
+	SloUuid string
+	SloName string
+	// DatasourceUid is the datasource the SLO app writes the recording rules of the SLO to.
+	DatasourceUid string
+	// Objective is the ratio of good events, e.g. 0.995.
+	Objective float64
+	SloUrl    string
+	End       time.Time
+	// MaxBudgetDrop is the drop of the remaining error budget, in percentage points of the total budget,
+	// tolerated during the step. Not checked if 0.
+	MaxBudgetDrop float64
+	// MaxBurnRate is the burn rate tolerated during the step. Not checked if 0.
+	MaxBurnRate float64
+	// InitialBudget is the remaining error budget, in percent, when the step started.
+	InitialBudget *float64
+	// ApiErrors counts the polls failing to query the SLO, see extgrafana.ApiErrorTolerance.
+	ApiErrors extgrafana.ApiErrorTolerance
+}
+
+// SloStatus is the state of the SLO as of a single poll. Values are missing if the SLO has no data. SLOs
+// grouped by labels report the worst group, BudgetGroup and BurnRateGroup tell which one.
+type SloStatus struct {
+	RemainingBudget *float64
+	BurnRate        *float64
+	BudgetGroup     string
+	BurnRateGroup   string
+}
+
+func NewSloCheckAction() action_kit_sdk.Action[SloCheckState] {
+	return &SloCheckAction{}
+}
+
+func (m *SloCheckAction) NewEmptyState() SloCheckState {
+	return SloCheckState{}
+}
+
+func (m *SloCheckAction) Describe() action_kit_api.ActionDescription {
+	return action_kit_api.ActionDescription{
+		Id:          fmt.Sprintf("%s.check", TargetType),
+		Label:       "SLO Check",
+		Description: "collects the burn rate and remaining error budget of the SLO and fails when the budget drops or burns faster than tolerated.",
+		Version:     extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:        new(targetIcon),
+		TargetSelection: new(action_kit_api.TargetSelection{
+			TargetType:          TargetType,
+			QuantityRestriction: extutil.Ptr(action_kit_api.QuantityRestrictionAll),
+			SelectionTemplates: new([]action_kit_api.TargetSelectionTemplate{
+				{
+					Label:       "SLO name",
+					Description: new("Find SLO by name"),
+					Query:       "grafana.slo.name=\"\"",
+				},
+				{
+					Label:       "SLOs of a service",
+					Description: new("Find SLOs by service"),
+					Query:       "grafana.slo.service=\"\"",
+				},
+			}),
+		}),
+		Technology: new("Grafana"),
+
+		Kind:        action_kit_api.Check,
+		TimeControl: action_kit_api.TimeControlInternal,
+		Parameters: append([]action_kit_api.ActionParameter{
+			{
+				Name:         "duration",
+				Label:        "Duration",
+				Description:  new(""),
+				Type:         action_kit_api.ActionParameterTypeDuration,
+				DefaultValue: new("60s"),
+				Order:        new(1),
+				Required:     new(true),
+			},
+			{
+				Name:         "maxErrorBudgetDrop",
+				Label:        "Max. Error Budget Drop",
+				Description:  new("How much of the total error budget may be consumed during the step. Not checked if empty or 0."),
+				Type:         action_kit_api.ActionParameterTypePercentage,
+				DefaultValue: new("5"),
+				Order:        new(2),
+				Required:     new(false),
+			},
+			{
+				Name:        "maxBurnRate",
+				Label:       "Max. Burn Rate",
+				Description: new("The burn rate over the last 5 minutes tolerated during the step, e.g. 14.4 to fail when the budget of 30 days would be consumed within about 2 days. Not checked if empty or 0."),
+				Type:        action_kit_api.ActionParameterTypeString,
+				Order:       new(3),
+				Required:    new(false),
+			},
+		}, extgrafana.ApiErrorToleranceParameters("the state of the SLO", 4)...),
+		Widgets: new([]action_kit_api.Widget{
+			action_kit_api.StateOverTimeWidget{
+				Type:  action_kit_api.ComSteadybitWidgetStateOverTime,
+				Title: "Grafana SLO",
+				Identity: action_kit_api.StateOverTimeWidgetIdentityConfig{
+					From: "grafana.slo.uuid",
+				},
+				Label: action_kit_api.StateOverTimeWidgetLabelConfig{
+					From: "grafana.slo.name",
+				},
+				State: action_kit_api.StateOverTimeWidgetStateConfig{
+					From: "state",
+				},
+				Tooltip: action_kit_api.StateOverTimeWidgetTooltipConfig{
+					From: "tooltip",
+				},
+				Url: new(action_kit_api.StateOverTimeWidgetUrlConfig{
+					From: new("url"),
+				}),
+				Value: new(action_kit_api.StateOverTimeWidgetValueConfig{
+					Hide: new(true),
+				}),
+			},
+		}),
+		// the recording rules of the SLO app are evaluated every minute
+		Status: new(action_kit_api.MutatingEndpointReferenceWithCallInterval{
+			CallInterval: new("10s"),
+		}),
+	}
+}
+
+func (m *SloCheckAction) Prepare(_ context.Context, state *SloCheckState, request action_kit_api.PrepareActionRequestBody) (*action_kit_api.PrepareResult, error) {
+	uuid := extgrafana.FirstAttribute(request.Target.Attributes, "grafana.slo.uuid")
+	if uuid == "" {
+		return nil, new(extension_kit.ToError("Target is missing the 'grafana.slo.uuid' attribute.", nil))
+	}
+	datasourceUid := extgrafana.FirstAttribute(request.Target.Attributes, "grafana.slo.datasource-uid")
+	if datasourceUid == "" {
+		return nil, new(extension_kit.ToError("Target is missing the 'grafana.slo.datasource-uid' attribute.", nil))
+	}
+	objective, err := strconv.ParseFloat(extgrafana.FirstAttribute(request.Target.Attributes, "grafana.slo.objective"), 64)
+	if err != nil || objective <= 0 || objective >= 100 {
+		return nil, new(extension_kit.ToError("Target has no valid 'grafana.slo.objective' attribute.", err))
+	}
+
+	duration := request.Config["duration"].(float64)
+	state.End = time.Now().Add(time.Millisecond * time.Duration(duration))
+
+	if maxBudgetDrop, ok := request.Config["maxErrorBudgetDrop"].(float64); ok {
+		state.MaxBudgetDrop = maxBudgetDrop
+	}
+	if maxBurnRate := fmt.Sprintf("%v", request.Config["maxBurnRate"]); request.Config["maxBurnRate"] != nil && maxBurnRate != "" {
+		state.MaxBurnRate, err = strconv.ParseFloat(maxBurnRate, 64)
+		if err != nil || state.MaxBurnRate < 0 {
+			return nil, new(extension_kit.ToError(fmt.Sprintf("Invalid max. burn rate '%s', expected a number like 14.4.", maxBurnRate), err))
+		}
+	}
+	state.ApiErrors = extgrafana.ParseApiErrorTolerance(request.Config)
+
+	instance, err := extgrafana.FindInstance(Instances, extgrafana.FirstAttribute(request.Target.Attributes, "grafana.instance"), extgrafana.FirstAttribute(request.Target.Attributes, "grafana.host"))
+	if err != nil {
+		return nil, new(extension_kit.ToError("Failed to resolve the Grafana instance of the target.", err))
+	}
+
+	if orgId := extgrafana.FirstAttribute(request.Target.Attributes, "grafana.org.id"); orgId != "" {
+		state.OrgId, err = strconv.Atoi(orgId)
+		if err != nil {
+			return nil, new(extension_kit.ToError(fmt.Sprintf("Target has an invalid 'grafana.org.id' attribute '%s'.", orgId), err))
+		}
+	}
+
+	state.Instance = instance.Name
+	state.SloUuid = uuid
+	state.SloName = extgrafana.FirstAttribute(request.Target.Attributes, "grafana.slo.name")
+	state.DatasourceUid = datasourceUid
+	state.Objective = objective / 100
+	state.SloUrl = extgrafana.FirstAttribute(request.Target.Attributes, "grafana.slo.url")
+	return nil, nil
+}
+
+func (m *SloCheckAction) Start(ctx context.Context, state *SloCheckState) (*action_kit_api.StartResult, error) {
+	statusResult, err := m.Status(ctx, state)
+	if statusResult == nil {
+		return nil, err
+	}
+	return &action_kit_api.StartResult{
+		Error:    statusResult.Error,
+		Messages: statusResult.Messages,
+		Metrics:  statusResult.Metrics,
+	}, err
+}
+
+func (m *SloCheckAction) Status(ctx context.Context, state *SloCheckState) (*action_kit_api.StatusResult, error) {
+	instance, err := extgrafana.FindInstance(Instances, state.Instance, "")
+	if err != nil {
+		return nil, extension_kit.ToError("Failed to resolve the Grafana instance of the target.", err)
+	}
+	return SloCheckStatus(ctx, state, instance.Client)
+}
+
+func SloCheckStatus(ctx context.Context, state *SloCheckState, client *resty.Client) (*action_kit_api.StatusResult, error) {
+	now := time.Now()
+
+	status, err := getSloStatus(ctx, client, state, now)
+	if err != nil {
+		return tolerateUnavailable(state, err, now)
+	}
+	state.ApiErrors.Succeeded()
+	if state.InitialBudget == nil && status.RemainingBudget != nil {
+		state.InitialBudget = status.RemainingBudget
+	}
+
+	var checkError *action_kit_api.ActionKitError
+	if violation := checkViolation(state, status); violation != "" {
+		checkError = new(action_kit_api.ActionKitError{
+			Title:  violation,
+			Status: extutil.Ptr(action_kit_api.Failed),
+		})
+	}
+
+	return &action_kit_api.StatusResult{
+		Completed: now.After(state.End),
+		Error:     checkError,
+		Metrics:   &[]action_kit_api.Metric{toMetric(state, status, checkError != nil, now)},
+	}, nil
+}
+
+// tolerateUnavailable reports a failed poll as unknown state of the SLO, unless the tolerance is
+// exceeded. The step is not completed by a failed poll, as its outcome can't be evaluated.
+func tolerateUnavailable(state *SloCheckState, err error, now time.Time) (*action_kit_api.StatusResult, error) {
+	if exceeded := state.ApiErrors.Tolerate(err); exceeded != nil {
+		return nil, extension_kit.ToError(fmt.Sprintf("Failed to retrieve the state of SLO %s.", state.SloName), exceeded)
+	}
+	log.Warn().Err(err).Msgf("Tolerating failure %d in a row to retrieve the state of SLO %s.", state.ApiErrors.Consecutive, state.SloName)
+
+	metric := toMetric(state, SloStatus{}, false, now)
+	metric.Metric["tooltip"] = fmt.Sprintf("SLO state is unknown, failed to retrieve it from Grafana (%d of %d polls failed): %s",
+		state.ApiErrors.Failures, state.ApiErrors.Polls, err.Error())
+	return &action_kit_api.StatusResult{
+		Metrics: &[]action_kit_api.Metric{metric},
+	}, nil
+}
+
+// getSloStatus queries the recording rules of the SLO app: the SLI over the window of the SLO for the
+// remaining error budget, and the rate of good and all events over 5 minutes for the burn rate. The
+// SLO app records a series per group of SLOs grouped by labels. The remaining budget of a group can't
+// be aggregated without its number of events, so the worst group is reported.
+func getSloStatus(ctx context.Context, client *resty.Client, state *SloCheckState, now time.Time) (SloStatus, error) {
+	selector := fmt.Sprintf("{grafana_slo_uuid=%q}", state.SloUuid)
+	errorBudget := 1 - state.Objective
+
+	var status SloStatus
+	sli, err := extgrafana.QueryInstant(ctx, client, state.OrgId, state.DatasourceUid, "grafana_slo_sli_window"+selector, now)
+	if err != nil {
+		return status, err
+	}
+	if len(sli) > 0 {
+		worst := slices.MinFunc(sli, func(a, b extgrafana.Sample) int { return cmp.Compare(a.Value, b.Value) })
+		status.RemainingBudget = new((1 - (1-worst.Value)/errorBudget) * 100)
+		status.BudgetGroup = groupOf(sli, worst)
+	}
+
+	burnRate, err := extgrafana.QueryInstant(ctx, client, state.OrgId, state.DatasourceUid,
+		fmt.Sprintf("(1 - grafana_slo_success_rate_5m%s / grafana_slo_total_rate_5m%s) / %g", selector, selector, errorBudget), now)
+	if err != nil {
+		return status, err
+	}
+	if len(burnRate) > 0 {
+		worst := slices.MaxFunc(burnRate, func(a, b extgrafana.Sample) int { return cmp.Compare(a.Value, b.Value) })
+		status.BurnRate = new(worst.Value)
+		status.BurnRateGroup = groupOf(burnRate, worst)
+	}
+	return status, nil
+}
+
+// groupOf names the group of the sample by the labels the SLO is grouped by, e.g. cluster="eu", or ""
+// if the SLO isn't grouped.
+func groupOf(samples []extgrafana.Sample, sample extgrafana.Sample) string {
+	if len(samples) < 2 {
+		return ""
+	}
+	labels := make([]string, 0, len(sample.Labels))
+	for _, key := range slices.Sorted(maps.Keys(sample.Labels)) {
+		if key == "__name__" || strings.HasPrefix(key, "grafana_slo") {
+			continue
+		}
+		labels = append(labels, fmt.Sprintf("%s=%q", key, sample.Labels[key]))
+	}
+	return strings.Join(labels, ", ")
+}
+
+func checkViolation(state *SloCheckState, status SloStatus) string {
+	if state.MaxBudgetDrop > 0 && state.InitialBudget != nil && status.RemainingBudget != nil {
+		if drop := *state.InitialBudget - *status.RemainingBudget; drop > state.MaxBudgetDrop {
+			return fmt.Sprintf("Error budget of SLO '%s' dropped by %.1f%% (from %.1f%% to %.1f%%), more than the tolerated %g%%.",
+				state.SloName, drop, *state.InitialBudget, *status.RemainingBudget, state.MaxBudgetDrop)
+		}
+	}
+	if state.MaxBurnRate > 0 && status.BurnRate != nil && *status.BurnRate > state.MaxBurnRate {
+		return fmt.Sprintf("SLO '%s' burns its error budget at %.1fx, faster than the tolerated %gx.", state.SloName, *status.BurnRate, state.MaxBurnRate)
+	}
+	return ""
+}
+
+func toMetric(state *SloCheckState, status SloStatus, violated bool, now time.Time) action_kit_api.Metric {
+	widgetState := "success"
+	var tooltip string
+	value := 0.0
+	if status.BurnRate != nil {
+		tooltip = fmt.Sprintf("Burn rate %.2fx", *status.BurnRate)
+		if status.BurnRateGroup != "" {
+			tooltip += fmt.Sprintf(" (worst group %s)", status.BurnRateGroup)
+		}
+		if *status.BurnRate > 1 {
+			widgetState = "warn"
+		}
+	} else {
+		tooltip = "Burn rate unknown, no events in the last 5 minutes"
+	}
+	if status.RemainingBudget != nil {
+		value = *status.RemainingBudget
+		tooltip += fmt.Sprintf("\nError budget remaining %.1f%%", *status.RemainingBudget)
+		if state.InitialBudget != nil {
+			tooltip += fmt.Sprintf(" (%.1f%% at start)", *state.InitialBudget)
+		}
+		if status.BudgetGroup != "" {
+			tooltip += fmt.Sprintf(" (worst group %s)", status.BudgetGroup)
+		}
+	} else {
+		tooltip += "\nError budget unknown, the SLO has no data"
+	}
+	if status.BurnRate == nil && status.RemainingBudget == nil {
+		widgetState = "info"
+	}
+	if violated {
+		widgetState = "danger"
+	}
+	return action_kit_api.Metric{
+		Name: new("grafana_slo"),
+		Metric: map[string]string{
+			"grafana.slo.uuid": state.SloUuid,
+			"grafana.slo.name": state.SloName,
+			"state":            widgetState,
+			"tooltip":          tooltip,
+			"url":              state.SloUrl,
+		},
+		Timestamp: now,
+		Value:     value,
+	}
+}
@@ -0,0 +1,201 @@
+package extslos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareExtractsState(t *testing.T) {
+	Instances = []extgrafana.Instance{{Name: "default", BaseUrl: "http://grafana.local"}}
+	defer func() { Instances = nil }()
+
+	action := SloCheckAction{}
+	state := action.NewEmptyState()
+	_, err := action.Prepare(context.Background(), &state, action_kit_api.PrepareActionRequestBody{
+		Config: map[string]any{
+			"duration":           float64(60000),
+			"maxErrorBudgetDrop": float64(2),
+			"maxBurnRate":        "14.4",
+		},
+		Target: new(action_kit_api.Target{
+			Attributes: map[string][]string{
+				"grafana.slo.uuid":           {"checkout-availability"},
+				"grafana.slo.name":           {"Checkout availability"},
+				"grafana.slo.objective":      {"99.5"},
+				"grafana.slo.datasource-uid": {"mimir"},
+				"grafana.instance":           {"default"},
+			},
+		}),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "checkout-availability", state.SloUuid)
+	assert.Equal(t, "mimir", state.DatasourceUid)
+	assert.InDelta(t, 0.995, state.Objective, 1e-9)
+	assert.Equal(t, 2.0, state.MaxBudgetDrop)
+	assert.Equal(t, 14.4, state.MaxBurnRate)
+}
+
+func TestPrepareRejectsInvalidMaxBurnRate(t *testing.T) {
+	Instances = []extgrafana.Instance{{Name: "default", BaseUrl: "http://grafana.local"}}
+	defer func() { Instances = nil }()
+
+	action := SloCheckAction{}
+	state := action.NewEmptyState()
+	_, err := action.Prepare(context.Background(), &state, action_kit_api.PrepareActionRequestBody{
+		Config: map[string]any{
+			"duration":    float64(60000),
+			"maxBurnRate": "fast",
+		},
+		Target: new(action_kit_api.Target{
+			Attributes: map[string][]string{
+				"grafana.slo.uuid":           {"checkout-availability"},
+				"grafana.slo.objective":      {"99.5"},
+				"grafana.slo.datasource-uid": {"mimir"},
+				"grafana.instance":           {"default"},
+			},
+		}),
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid max. burn rate 'fast'")
+}
+
+// sloClient responds with the given SLI over the window and burn rate, or no data if nil.
+func sloClient(t *testing.T, sli *float64, burnRate *float64) RoundTripperFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		require.Equal(t, "/api/ds/query", req.URL.Path)
+		var body struct {
+			Queries []struct {
+				Expr string `json:"expr"`
+			} `json:"queries"`
+		}
+		raw, _ := io.ReadAll(req.Body)
+		require.NoError(t, json.Unmarshal(raw, &body))
+		value := burnRate
+		if strings.HasPrefix(body.Queries[0].Expr, "grafana_slo_sli_window") {
+			value = sli
+		}
+		if value == nil {
+			return response(200, `{"results":{"A":{"frames":[]}}}`), nil
+		}
+		return response(200, fmt.Sprintf(`{"results":{"A":{"frames":[{"schema":{"fields":[{"name":"Time","type":"time"},{"name":"Value","type":"number"}]},"data":{"values":[[1700000000000],[%g]]}}]}}}`, *value)), nil
+	}
+}
+
+// groupedSloClient responds with a series per group of an SLO grouped by cluster.
+func groupedSloClient(t *testing.T, sli map[string]float64, burnRate map[string]float64) RoundTripperFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		var body struct {
+			Queries []struct {
+				Expr string `json:"expr"`
+			} `json:"queries"`
+		}
+		raw, _ := io.ReadAll(req.Body)
+		require.NoError(t, json.Unmarshal(raw, &body))
+		values := burnRate
+		if strings.HasPrefix(body.Queries[0].Expr, "grafana_slo_sli_window") {
+			values = sli
+		}
+		var frames []string
+		for cluster, value := range values {
+			frames = append(frames, fmt.Sprintf(`{"schema":{"fields":[{"name":"Time","type":"time"},{"name":"Value","type":"number","labels":{"cluster":%q,"grafana_slo_uuid":"checkout-availability"}}]},"data":{"values":[[1700000000000],[%g]]}}`, cluster, value))
+		}
+		return response(200, fmt.Sprintf(`{"results":{"A":{"frames":[%s]}}}`, strings.Join(frames, ","))), nil
+	}
+}
+
+func newState() *SloCheckState {
+	return &SloCheckState{
+		SloUuid:       "checkout-availability",
+		SloName:       "Checkout availability",
+		DatasourceUid: "mimir",
+		Objective:     0.99,
+		End:           time.Now().Add(time.Minute),
+		MaxBudgetDrop: 5,
+		MaxBurnRate:   10,
+	}
+}
+
+func TestSloCheckStatus_WithinBudget(t *testing.T) {
+	state := newState()
+
+	result, err := SloCheckStatus(context.Background(), state, newTestClient(sloClient(t, new(0.995), new(2.0))))
+	require.NoError(t, err)
+	assert.Nil(t, result.Error)
+	assert.InDelta(t, 50, *state.InitialBudget, 1e-6)
+	metric := (*result.Metrics)[0]
+	assert.Equal(t, "warn", metric.Metric["state"], "the budget burns faster than sustainable")
+	assert.Equal(t, "Burn rate 2.00x\nError budget remaining 50.0% (50.0% at start)", metric.Metric["tooltip"])
+}
+
+func TestSloCheckStatus_BudgetDropExceeded(t *testing.T) {
+	state := newState()
+	_, err := SloCheckStatus(context.Background(), state, newTestClient(sloClient(t, new(0.995), new(2.0))))
+	require.NoError(t, err)
+
+	result, err := SloCheckStatus(context.Background(), state, newTestClient(sloClient(t, new(0.994), new(2.0))))
+	require.NoError(t, err)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Error budget of SLO 'Checkout availability' dropped by 10.0% (from 50.0% to 40.0%), more than the tolerated 5%.", result.Error.Title)
+	assert.Equal(t, "danger", (*result.Metrics)[0].Metric["state"])
+}
+
+func TestSloCheckStatus_BurnRateExceeded(t *testing.T) {
+	state := newState()
+
+	result, err := SloCheckStatus(context.Background(), state, newTestClient(sloClient(t, new(0.995), new(14.4))))
+	require.NoError(t, err)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "SLO 'Checkout availability' burns its error budget at 14.4x, faster than the tolerated 10x.", result.Error.Title)
+}
+
+func TestSloCheckStatus_ReportsWorstGroup(t *testing.T) {
+	state := newState()
+	client := newTestClient(groupedSloClient(t,
+		map[string]float64{"eu": 0.998, "us": 0.995},
+		map[string]float64{"eu": 12.5, "us": 2.0}))
+
+	result, err := SloCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "SLO 'Checkout availability' burns its error budget at 12.5x, faster than the tolerated 10x.", result.Error.Title)
+	assert.InDelta(t, 50, *state.InitialBudget, 1e-6)
+	assert.Equal(t, "Burn rate 12.50x (worst group cluster=\"eu\")\nError budget remaining 50.0% (50.0% at start) (worst group cluster=\"us\")", (*result.Metrics)[0].Metric["tooltip"])
+}
+
+func TestSloCheckStatus_NoData(t *testing.T) {
+	state := newState()
+
+	result, err := SloCheckStatus(context.Background(), state, newTestClient(sloClient(t, nil, nil)))
+	require.NoError(t, err)
+	assert.Nil(t, result.Error)
+	assert.Nil(t, state.InitialBudget)
+	assert.Equal(t, "info", (*result.Metrics)[0].Metric["state"])
+}
+
+func TestSloCheckStatus_ToleratesTransientApiErrors(t *testing.T) {
+	state := newState()
+	state.ApiErrors = extgrafana.ApiErrorTolerance{MaxConsecutive: 1}
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		return response(503, `{"message":"unavailable"}`), nil
+	})
+
+	result, err := SloCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.False(t, result.Completed)
+	assert.Equal(t, "info", (*result.Metrics)[0].Metric["state"])
+	assert.Contains(t, (*result.Metrics)[0].Metric["tooltip"], "1 of 1 polls failed")
+
+	_, err = SloCheckStatus(context.Background(), state, client)
+	require.Error(t, err, "the second failure in a row exceeds the tolerance")
+}
@@ -0,0 +1,21 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extslos
+
+import "github.com/steadybit/extension-grafana/extgrafana"
+
+// Instances are the Grafana instances SLOs are discovered from and checked against.
+var Instances []extgrafana.Instance
+
+const (
+	TargetType = "com.steadybit.extension_grafana.slo"
+	targetIcon = "data:image/svg+xml,%3Csvg%20width%3D%2224%22%20height%3D%2224%22%20viewBox%3D%220%200%2024%2024%22%20fill%3D%22none%22%20xmlns%3D%22http%3A%2F%2Fwww.w3.org%2F2000%2Fsvg%22%3E%0A%3Cpath%20fill-rule%3D%22evenodd%22%20clip-rule%3D%22evenodd%22%20d%3D%22M12%204C7.58172%204%204%207.58172%204%2012C4%2016.4183%207.58172%2020%2012%2020C16.4183%2020%2020%2016.4183%2020%2012H22C22%2017.5228%2017.5228%2022%2012%2022C6.47715%2022%202%2017.5228%202%2012C2%206.47715%206.47715%202%2012%202V4ZM14%202.25V10H21.75C21.3%206.04%2017.96%202.7%2014%202.25ZM16%204.83C17.67%205.62%2018.38%206.33%2019.17%208H16V4.83Z%22%20fill%3D%22%231D2632%22%2F%3E%0A%3C%2Fsvg%3E%0A"
+
+	// sloApiPath is the resource API of the Grafana SLO app.
+	sloApiPath = "/api/plugins/grafana-slo-app/resources/v1/slo"
+)
@@ -0,0 +1,182 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extslos
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_api"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_commons"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_sdk"
+	"github.com/steadybit/extension-grafana/config"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	"github.com/steadybit/extension-kit/extbuild"
+)
+
+// serviceLabel is the label of an SLO naming the service it is defined for.
+const serviceLabel = "service"
+
+type sloDiscovery struct {
+	lastTargets *extgrafana.LastTargetsByInstance
+}
+
+var (
+	_ discovery_kit_sdk.TargetDescriber    = (*sloDiscovery)(nil)
+	_ discovery_kit_sdk.AttributeDescriber = (*sloDiscovery)(nil)
+)
+
+func NewSloDiscovery() discovery_kit_sdk.TargetDiscovery {
+	discovery := &sloDiscovery{lastTargets: extgrafana.NewLastTargetsByInstance()}
+	return discovery_kit_sdk.NewCachedTargetDiscovery(discovery,
+		discovery_kit_sdk.WithRefreshTargetsNow(),
+		discovery_kit_sdk.WithRefreshTargetsInterval(context.Background(), 1*time.Minute),
+	)
+}
+
+func (d *sloDiscovery) Describe() discovery_kit_api.DiscoveryDescription {
+	return discovery_kit_api.DiscoveryDescription{
+		Id: TargetType,
+		Discover: discovery_kit_api.DescribingEndpointReferenceWithCallInterval{
+			CallInterval: new("1m"),
+		},
+	}
+}
+
+func (d *sloDiscovery) DescribeTarget() discovery_kit_api.TargetDescription {
+	return discovery_kit_api.TargetDescription{
+		Id:       TargetType,
+		Label:    discovery_kit_api.PluralLabel{One: "Grafana SLO", Other: "Grafana SLOs"},
+		Category: new("monitoring"),
+		Version:  extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:     new(targetIcon),
+		Table: discovery_kit_api.Table{
+			Columns: []discovery_kit_api.Column{
+				{Attribute: "grafana.slo.name"},
+				{Attribute: "grafana.slo.service"},
+				{Attribute: "grafana.slo.objective"},
+				{Attribute: "grafana.instance"},
+			},
+			OrderBy: []discovery_kit_api.OrderBy{
+				{
+					Attribute: "grafana.slo.name",
+					Direction: "ASC",
+				},
+			},
+		},
+	}
+}
+
+func (d *sloDiscovery) DescribeAttributes() []discovery_kit_api.AttributeDescription {
+	return []discovery_kit_api.AttributeDescription{
+		{
+			Attribute: "grafana.slo.uuid",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "SLO UUID",
+				Other: "SLO UUIDs",
+			},
+		}, {
+			Attribute: "grafana.slo.name",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "SLO",
+				Other: "SLOs",
+			},
+		}, {
+			Attribute: "grafana.slo.service",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Service",
+				Other: "Services",
+			},
+		}, {
+			Attribute: "grafana.slo.objective",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Objective (%)",
+				Other: "Objectives (%)",
+			},
+		}, {
+			Attribute: "grafana.slo.window",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "SLO window",
+				Other: "SLO windows",
+			},
+		},
+	}
+}
+
+func (d *sloDiscovery) DiscoverTargets(ctx context.Context) ([]discovery_kit_api.Target, error) {
+	return d.lastTargets.Discover(ctx, Instances, "SLOs", getAllSlos)
+}
+
+// getAllSlos lists the SLOs of all organizations of the instance. Organizations without the SLO app have
+// no SLOs, failing to list the SLOs of another organization fails the instance.
+func getAllSlos(ctx context.Context, instance extgrafana.Instance) ([]discovery_kit_api.Target, error) {
+	result := make([]discovery_kit_api.Target, 0, 100)
+	for _, org := range extgrafana.GetOrganizations(ctx, instance.Client) {
+		var slos SloList
+		res, err := extgrafana.SetOrganization(instance.Client.R(), org.ID).
+			SetContext(ctx).
+			SetResult(&slos).
+			Get(sloApiPath)
+		if err != nil {
+			return nil, fmt.Errorf("organization %d: failed to retrieve SLOs: %w", org.ID, err)
+		}
+		if res.StatusCode() == http.StatusNotFound {
+			log.Debug().Msgf("The SLO app is not enabled in organization %d of %s.", org.ID, instance.Name)
+			continue
+		}
+		if !res.IsSuccess() {
+			return nil, fmt.Errorf("organization %d: failed to retrieve SLOs, status code %d: %s", org.ID, res.StatusCode(), res.String())
+		}
+		for _, slo := range slos.Slos {
+			result = append(result, toTarget(instance, org, slo))
+		}
+	}
+	return discovery_kit_commons.ApplyAttributeExcludes(result, config.Config.DiscoveryAttributesExcludesSlo), nil
+}
+
+func toTarget(instance extgrafana.Instance, org extgrafana.Organization, slo Slo) discovery_kit_api.Target {
+	attributes := map[string][]string{
+		"grafana.slo.uuid": {slo.UUID},
+		"grafana.slo.name": {slo.Name},
+		"grafana.host":     {instance.Host()},
+		"grafana.instance": {instance.Name},
+	}
+	if len(slo.Objectives) > 0 {
+		attributes["grafana.slo.objective"] = []string{formatObjective(slo.Objectives[0].Value)}
+		attributes["grafana.slo.window"] = []string{slo.Objectives[0].Window}
+	}
+	if slo.DestinationDatasource.UID != "" {
+		attributes["grafana.slo.datasource-uid"] = []string{slo.DestinationDatasource.UID}
+	}
+	if slo.ReadOnly.DrillDownDashboardRef != nil {
+		attributes["grafana.slo.url"] = []string{fmt.Sprintf("%s/d/%s", instance.BaseUrl, slo.ReadOnly.DrillDownDashboardRef.UID)}
+	}
+	for _, label := range slo.Labels {
+		attributes["grafana.slo.label."+label.Key] = append(attributes["grafana.slo.label."+label.Key], label.Value)
+		if label.Key == serviceLabel {
+			attributes["grafana.slo.service"] = append(attributes["grafana.slo.service"], label.Value)
+		}
+	}
+	extgrafana.AddOrganizationAttributes(attributes, org)
+	return discovery_kit_api.Target{
+		Id:         fmt.Sprintf("%s-%s", extgrafana.TargetIdPrefix(instance, org), slo.UUID),
+		TargetType: TargetType,
+		Label:      slo.Name,
+		Attributes: attributes,
+	}
+}
+
+// formatObjective formats the objective as percentage, e.g. 0.995 as 99.5.
+func formatObjective(value float64) string {
+	return strconv.FormatFloat(math.Round(value*1e6)/1e4, 'f', -1, 64)
+}
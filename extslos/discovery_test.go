@@ -0,0 +1,71 @@
+package extslos
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RoundTripperFunc lets us stub HTTP responses.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newTestClient(fn RoundTripperFunc) *resty.Client {
+	return resty.NewWithClient(&http.Client{Transport: fn})
+}
+
+func response(statusCode int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+	}
+}
+
+func TestGetAllSlos(t *testing.T) {
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/api/org":
+			return response(200, `{"id":1,"name":"Main Org."}`), nil
+		case "/api/user/orgs":
+			return response(200, `[{"orgId":1,"name":"Main Org."},{"orgId":2,"name":"Other"}]`), nil
+		case sloApiPath:
+			if req.Header.Get(extgrafana.OrgIdHeader) == "2" {
+				return response(404, `{"message":"Plugin not found"}`), nil
+			}
+			return response(200, `{"slos":[{
+				"uuid":"checkout-availability",
+				"name":"Checkout availability",
+				"labels":[{"key":"service","value":"checkout"},{"key":"team","value":"shop"}],
+				"objectives":[{"value":0.995,"window":"28d"}],
+				"destinationDatasource":{"uid":"mimir"},
+				"readOnly":{"drillDownDashboardRef":{"uid":"slo-checkout"}}
+			}]}`), nil
+		}
+		return response(404, "not found"), nil
+	})
+
+	targets, err := getAllSlos(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: client})
+	require.NoError(t, err, "organizations without the SLO app have no SLOs")
+	require.Len(t, targets, 1)
+
+	slo := targets[0]
+	assert.Equal(t, "default-checkout-availability", slo.Id)
+	assert.Equal(t, "Checkout availability", slo.Label)
+	assert.Equal(t, []string{"checkout"}, slo.Attributes["grafana.slo.service"])
+	assert.Equal(t, []string{"99.5"}, slo.Attributes["grafana.slo.objective"])
+	assert.Equal(t, []string{"28d"}, slo.Attributes["grafana.slo.window"])
+	assert.Equal(t, []string{"shop"}, slo.Attributes["grafana.slo.label.team"])
+	assert.Equal(t, []string{"mimir"}, slo.Attributes["grafana.slo.datasource-uid"])
+	assert.Equal(t, []string{"http://grafana.local/d/slo-checkout"}, slo.Attributes["grafana.slo.url"])
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extslos
+
+// SloList is the response of the SLO API listing all SLOs.
+type SloList struct {
+	Slos []Slo `json:"slos"`
+}
+
+type Slo struct {
+	UUID                  string         `json:"uuid"`
+	Name                  string         `json:"name"`
+	Description           string         `json:"description"`
+	Labels                []SloLabel     `json:"labels"`
+	Objectives            []SloObjective `json:"objectives"`
+	DestinationDatasource struct {
+		UID string `json:"uid"`
+	} `json:"destinationDatasource"`
+	ReadOnly struct {
+		DrillDownDashboardRef *struct {
+			UID string `json:"uid"`
+		} `json:"drillDownDashboardRef,omitempty"`
+	} `json:"readOnly"`
+}
+
+type SloLabel struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// SloObjective is the ratio of good events to meet over the window, e.g. 0.995 over 28d.
+type SloObjective struct {
+	Value  float64 `json:"value"`
+	Window string  `json:"window"`
+}
@@ -0,0 +1,347 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extsynthetics
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/action-kit/go/action_kit_sdk"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	extension_kit "github.com/steadybit/extension-kit"
+	"github.com/steadybit/extension-kit/extbuild"
+	"github.com/steadybit/extension-kit/extutil"
+)
+
+// unknownFrequencyWindow is the minimum window the probe results are evaluated over if the frequency of
+// the check is unknown, two runs of checks running every minute.
+const unknownFrequencyWindow = 2 * time.Minute
+
+type SyntheticCheckAction struct{}
+
+// Make sure action implements all required interfaces
+var (
+	_ action_kit_sdk.Action[SyntheticCheckState]           = (*SyntheticCheckAction)(nil)
+	_ action_kit_sdk.ActionWithStatus[SyntheticCheckState] = (*SyntheticCheckAction)(nil)
+)
+
+type SyntheticCheckState struct {
+	// Instance is the name of the Grafana instance the target was discovered from.
+	Instance string
+	// OrgId is the organization the check belongs to, 0 for the organization of the service token.
+	OrgId int
+	// CheckId identifies the check, job and target may be shared by several checks.
+	CheckId string
+	Job     string
+	Target  string
+	// MetricsDatasourceUid is the datasource the probe results of the check are written to.
+	MetricsDatasourceUid string
+	// Frequency is how often the probes run the check.
+	Frequency time.Duration
+	Start     time.Time
+	End       time.Time
+	// MinSuccessRatio is the percentage of successful probe results required over the step. Not checked if 0.
+	MinSuccessRatio float64
+	// MaxLatency is the maximum average duration of the probe results over the step. Not checked if 0.
+	MaxLatency time.Duration
+	// ApiErrors counts the polls failing to query the probe results, see extgrafana.ApiErrorTolerance.
+	ApiErrors extgrafana.ApiErrorTolerance
+}
+
+// ProbeResults are the probe results of the check over the window. Values are missing if the check has
+// no results within the window.
+type ProbeResults struct {
+	SuccessRatio *float64
+	Latency      *time.Duration
+}
+
+func NewSyntheticCheckAction() action_kit_sdk.Action[SyntheticCheckState] {
+	return &SyntheticCheckAction{}
+}
+
+func (m *SyntheticCheckAction) NewEmptyState() SyntheticCheckState {
+	return SyntheticCheckState{}
+}
+
+func (m *SyntheticCheckAction) Describe() action_kit_api.ActionDescription {
+	return action_kit_api.ActionDescription{
+		Id:          fmt.Sprintf("%s.check", TargetType),
+		Label:       "Synthetic Monitoring Check",
+		Description: "collects the success ratio and latency of the probe results of the Synthetic Monitoring check and fails when they are worse than tolerated over the step.",
+		Version:     extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:        new(targetIcon),
+		TargetSelection: new(action_kit_api.TargetSelection{
+			TargetType:          TargetType,
+			QuantityRestriction: extutil.Ptr(action_kit_api.QuantityRestrictionAll),
+			SelectionTemplates: new([]action_kit_api.TargetSelectionTemplate{
+				{
+					Label:       "synthetic check job",
+					Description: new("Find synthetic check by job"),
+					Query:       "grafana.synthetic-check.job=\"\"",
+				},
+			}),
+		}),
+		Technology: new("Grafana"),
+
+		Kind:        action_kit_api.Check,
+		TimeControl: action_kit_api.TimeControlInternal,
+		Parameters: append([]action_kit_api.ActionParameter{
+			{
+				Name:         "duration",
+				Label:        "Duration",
+				Description:  new(""),
+				Type:         action_kit_api.ActionParameterTypeDuration,
+				DefaultValue: new("60s"),
+				Order:        new(1),
+				Required:     new(true),
+			},
+			{
+				Name:         "minSuccessRatio",
+				Label:        "Min. Success Ratio",
+				Description:  new("The percentage of probe results within the step which have to succeed. Not checked if empty or 0."),
+				Type:         action_kit_api.ActionParameterTypePercentage,
+				DefaultValue: new("100"),
+				Order:        new(2),
+				Required:     new(false),
+			},
+			{
+				Name:        "maxLatency",
+				Label:       "Max. Latency",
+				Description: new("The maximum average duration of the probe results within the step. Not checked if empty."),
+				Type:        action_kit_api.ActionParameterTypeDuration,
+				Order:       new(3),
+				Required:    new(false),
+			},
+		}, extgrafana.ApiErrorToleranceParameters("the probe results of the check", 4)...),
+		Widgets: new([]action_kit_api.Widget{
+			action_kit_api.StateOverTimeWidget{
+				Type:  action_kit_api.ComSteadybitWidgetStateOverTime,
+				Title: "Grafana Synthetic Monitoring",
+				Identity: action_kit_api.StateOverTimeWidgetIdentityConfig{
+					From: "grafana.synthetic-check.id",
+				},
+				Label: action_kit_api.StateOverTimeWidgetLabelConfig{
+					From: "grafana.synthetic-check.job",
+				},
+				State: action_kit_api.StateOverTimeWidgetStateConfig{
+					From: "state",
+				},
+				Tooltip: action_kit_api.StateOverTimeWidgetTooltipConfig{
+					From: "tooltip",
+				},
+				Value: new(action_kit_api.StateOverTimeWidgetValueConfig{
+					Hide: new(true),
+				}),
+			},
+		}),
+		Status: new(action_kit_api.MutatingEndpointReferenceWithCallInterval{
+			CallInterval: new("10s"),
+		}),
+	}
+}
+
+func (m *SyntheticCheckAction) Prepare(_ context.Context, state *SyntheticCheckState, request action_kit_api.PrepareActionRequestBody) (*action_kit_api.PrepareResult, error) {
+	job := extgrafana.FirstAttribute(request.Target.Attributes, "grafana.synthetic-check.job")
+	if job == "" {
+		return nil, new(extension_kit.ToError("Target is missing the 'grafana.synthetic-check.job' attribute.", nil))
+	}
+	datasourceUid := extgrafana.FirstAttribute(request.Target.Attributes, "grafana.synthetic-check.metrics-datasource-uid")
+	if datasourceUid == "" {
+		return nil, new(extension_kit.ToError("Target is missing the 'grafana.synthetic-check.metrics-datasource-uid' attribute.", nil))
+	}
+
+	duration := request.Config["duration"].(float64)
+	state.Start = time.Now()
+	state.End = state.Start.Add(time.Millisecond * time.Duration(duration))
+
+	if minSuccessRatio, ok := request.Config["minSuccessRatio"].(float64); ok {
+		state.MinSuccessRatio = minSuccessRatio
+	}
+	if maxLatency, ok := request.Config["maxLatency"].(float64); ok {
+		state.MaxLatency = time.Millisecond * time.Duration(maxLatency)
+	}
+	state.ApiErrors = extgrafana.ParseApiErrorTolerance(request.Config)
+	if frequency := extgrafana.FirstAttribute(request.Target.Attributes, "grafana.synthetic-check.frequency"); frequency != "" {
+		state.Frequency, _ = time.ParseDuration(frequency)
+	}
+
+	instance, err := extgrafana.FindInstance(Instances, extgrafana.FirstAttribute(request.Target.Attributes, "grafana.instance"), extgrafana.FirstAttribute(request.Target.Attributes, "grafana.host"))
+	if err != nil {
+		return nil, new(extension_kit.ToError("Failed to resolve the Grafana instance of the target.", err))
+	}
+
+	if orgId := extgrafana.FirstAttribute(request.Target.Attributes, "grafana.org.id"); orgId != "" {
+		state.OrgId, err = strconv.Atoi(orgId)
+		if err != nil {
+			return nil, new(extension_kit.ToError(fmt.Sprintf("Target has an invalid 'grafana.org.id' attribute '%s'.", orgId), err))
+		}
+	}
+
+	state.Instance = instance.Name
+	state.CheckId = extgrafana.FirstAttribute(request.Target.Attributes, "grafana.synthetic-check.id")
+	state.Job = job
+	state.Target = extgrafana.FirstAttribute(request.Target.Attributes, "grafana.synthetic-check.target")
+	state.MetricsDatasourceUid = datasourceUid
+	return nil, nil
+}
+
+func (m *SyntheticCheckAction) Start(ctx context.Context, state *SyntheticCheckState) (*action_kit_api.StartResult, error) {
+	statusResult, err := m.Status(ctx, state)
+	if statusResult == nil {
+		return nil, err
+	}
+	return &action_kit_api.StartResult{
+		Error:    statusResult.Error,
+		Messages: statusResult.Messages,
+		Metrics:  statusResult.Metrics,
+	}, err
+}
+
+func (m *SyntheticCheckAction) Status(ctx context.Context, state *SyntheticCheckState) (*action_kit_api.StatusResult, error) {
+	instance, err := extgrafana.FindInstance(Instances, state.Instance, "")
+	if err != nil {
+		return nil, extension_kit.ToError("Failed to resolve the Grafana instance of the target.", err)
+	}
+	return SyntheticCheckStatus(ctx, state, instance.Client)
+}
+
+// SyntheticCheckStatus reports the probe results since the start of the step. The thresholds are
+// evaluated once the step ends, as the results of a single poll cover a few probe runs only.
+func SyntheticCheckStatus(ctx context.Context, state *SyntheticCheckState, client *resty.Client) (*action_kit_api.StatusResult, error) {
+	now := time.Now()
+
+	results, err := getProbeResults(ctx, client, state, now)
+	if err != nil {
+		return tolerateUnavailable(state, err, now)
+	}
+	state.ApiErrors.Succeeded()
+
+	violations := checkViolations(state, results)
+	completed := now.After(state.End)
+	var checkError *action_kit_api.ActionKitError
+	if completed && results.SuccessRatio == nil {
+		checkError = new(action_kit_api.ActionKitError{
+			Title:  fmt.Sprintf("Synthetic check '%s' has no probe results within the step.", state.Job),
+			Status: extutil.Ptr(action_kit_api.Failed),
+		})
+	} else if completed && len(violations) > 0 {
+		checkError = new(action_kit_api.ActionKitError{
+			Title:  fmt.Sprintf("Synthetic check '%s' %s.", state.Job, strings.Join(violations, " and ")),
+			Status: extutil.Ptr(action_kit_api.Failed),
+		})
+	}
+
+	return &action_kit_api.StatusResult{
+		Completed: completed,
+		Error:     checkError,
+		Metrics:   &[]action_kit_api.Metric{toMetric(state, results, len(violations) > 0, now)},
+	}, nil
+}
+
+// tolerateUnavailable reports a failed poll as unknown probe results, unless the tolerance is exceeded.
+// The step is not completed by a failed poll, as its outcome can't be evaluated.
+func tolerateUnavailable(state *SyntheticCheckState, err error, now time.Time) (*action_kit_api.StatusResult, error) {
+	if exceeded := state.ApiErrors.Tolerate(err); exceeded != nil {
+		return nil, extension_kit.ToError(fmt.Sprintf("Failed to retrieve the probe results of synthetic check %s.", state.Job), exceeded)
+	}
+	log.Warn().Err(err).Msgf("Tolerating failure %d in a row to retrieve the probe results of synthetic check %s.", state.ApiErrors.Consecutive, state.Job)
+
+	metric := toMetric(state, ProbeResults{}, false, now)
+	metric.Metric["tooltip"] = fmt.Sprintf("Probe results are unknown, failed to retrieve them from Grafana (%d of %d polls failed): %s",
+		state.ApiErrors.Failures, state.ApiErrors.Polls, err.Error())
+	return &action_kit_api.StatusResult{
+		Metrics: &[]action_kit_api.Metric{metric},
+	}, nil
+}
+
+// window is the range the probe results are evaluated over and the time it ends at: the step so far, or
+// exactly the step once it ended. It is extended to two runs of the check, as the increase of the
+// results needs the results before and after a run to see it.
+func window(state *SyntheticCheckState, now time.Time) (time.Duration, time.Time) {
+	end := now
+	if now.After(state.End) {
+		end = state.End
+	}
+	runs := 2 * state.Frequency
+	if state.Frequency <= 0 {
+		runs = unknownFrequencyWindow
+	}
+	return max(end.Sub(state.Start), runs).Round(time.Second), end
+}
+
+// getProbeResults queries the results of all probes running the check, as written by Synthetic Monitoring.
+func getProbeResults(ctx context.Context, client *resty.Client, state *SyntheticCheckState, now time.Time) (ProbeResults, error) {
+	span, at := window(state, now)
+	selector := fmt.Sprintf("{job=%q,instance=%q}", state.Job, state.Target)
+	rangeSelector := fmt.Sprintf("%s[%ds]", selector, int(span.Seconds()))
+
+	var results ProbeResults
+	successRatio, err := extgrafana.QueryInstant(ctx, client, state.OrgId, state.MetricsDatasourceUid,
+		fmt.Sprintf("sum(increase(probe_all_success_sum%s)) / sum(increase(probe_all_success_count%s)) * 100", rangeSelector, rangeSelector), at)
+	if err != nil {
+		return results, err
+	}
+	if len(successRatio) > 0 {
+		results.SuccessRatio = new(successRatio[0].Value)
+	}
+
+	latency, err := extgrafana.QueryInstant(ctx, client, state.OrgId, state.MetricsDatasourceUid,
+		fmt.Sprintf("sum(increase(probe_all_duration_seconds_sum%s)) / sum(increase(probe_all_duration_seconds_count%s))", rangeSelector, rangeSelector), at)
+	if err != nil {
+		return results, err
+	}
+	if len(latency) > 0 {
+		results.Latency = new(time.Duration(latency[0].Value * float64(time.Second)))
+	}
+	return results, nil
+}
+
+func checkViolations(state *SyntheticCheckState, results ProbeResults) []string {
+	violations := make([]string, 0)
+	if state.MinSuccessRatio > 0 && results.SuccessRatio != nil && *results.SuccessRatio < state.MinSuccessRatio {
+		violations = append(violations, fmt.Sprintf("succeeded %.1f%% of the time, less than the required %g%%", *results.SuccessRatio, state.MinSuccessRatio))
+	}
+	if state.MaxLatency > 0 && results.Latency != nil && *results.Latency > state.MaxLatency {
+		violations = append(violations, fmt.Sprintf("took %s on average, longer than the tolerated %s", results.Latency.Round(time.Millisecond), state.MaxLatency))
+	}
+	return violations
+}
+
+func toMetric(state *SyntheticCheckState, results ProbeResults, violated bool, now time.Time) action_kit_api.Metric {
+	widgetState := "success"
+	tooltip := "No probe results yet"
+	if results.SuccessRatio != nil {
+		tooltip = fmt.Sprintf("Success ratio %.1f%%", *results.SuccessRatio)
+		if results.Latency != nil {
+			tooltip += fmt.Sprintf("\nAverage latency %s", results.Latency.Round(time.Millisecond))
+		}
+	} else {
+		widgetState = "info"
+	}
+	if violated {
+		widgetState = "danger"
+	}
+	return action_kit_api.Metric{
+		Name: new("grafana_synthetic_check"),
+		Metric: map[string]string{
+			"grafana.synthetic-check.id":     state.CheckId,
+			"grafana.synthetic-check.job":    state.Job,
+			"grafana.synthetic-check.target": state.Target,
+			"state":                          widgetState,
+			"tooltip":                        tooltip,
+		},
+		Timestamp: now,
+		Value:     0,
+	}
+}
@@ -0,0 +1,172 @@
+package extsynthetics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareExtractsState(t *testing.T) {
+	Instances = []extgrafana.Instance{{Name: "default", BaseUrl: "http://grafana.local"}}
+	defer func() { Instances = nil }()
+
+	action := SyntheticCheckAction{}
+	state := action.NewEmptyState()
+	_, err := action.Prepare(context.Background(), &state, action_kit_api.PrepareActionRequestBody{
+		Config: map[string]any{
+			"duration":        float64(60000),
+			"minSuccessRatio": float64(99),
+			"maxLatency":      float64(500),
+		},
+		Target: new(action_kit_api.Target{
+			Attributes: map[string][]string{
+				"grafana.synthetic-check.id":                     {"42"},
+				"grafana.synthetic-check.job":                    {"shop-frontend"},
+				"grafana.synthetic-check.target":                 {"https://shop.example.com"},
+				"grafana.synthetic-check.frequency":              {"1m0s"},
+				"grafana.synthetic-check.metrics-datasource-uid": {"grafanacloud-prom"},
+				"grafana.instance":                               {"default"},
+			},
+		}),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "42", state.CheckId)
+	assert.Equal(t, "shop-frontend", state.Job)
+	assert.Equal(t, "https://shop.example.com", state.Target)
+	assert.Equal(t, "grafanacloud-prom", state.MetricsDatasourceUid)
+	assert.Equal(t, time.Minute, state.Frequency)
+	assert.Equal(t, 99.0, state.MinSuccessRatio)
+	assert.Equal(t, 500*time.Millisecond, state.MaxLatency)
+	assert.Equal(t, time.Minute, state.End.Sub(state.Start))
+}
+
+// probeClient responds with the given success ratio and latency in seconds, or no data if nil.
+func probeClient(t *testing.T, successRatio *float64, latency *float64, exprs *[]string) RoundTripperFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		require.Equal(t, "/api/ds/query", req.URL.Path)
+		var body struct {
+			Queries []struct {
+				Expr string `json:"expr"`
+			} `json:"queries"`
+		}
+		raw, _ := io.ReadAll(req.Body)
+		require.NoError(t, json.Unmarshal(raw, &body))
+		*exprs = append(*exprs, body.Queries[0].Expr)
+		value := latency
+		if strings.Contains(body.Queries[0].Expr, "probe_all_success_sum") {
+			value = successRatio
+		}
+		if value == nil {
+			return response(200, `{"results":{"A":{"frames":[]}}}`), nil
+		}
+		return response(200, fmt.Sprintf(`{"results":{"A":{"frames":[{"schema":{"fields":[{"name":"Time","type":"time"},{"name":"Value","type":"number"}]},"data":{"values":[[1700000000000],[%g]]}}]}}}`, *value)), nil
+	}
+}
+
+func newState(end time.Time) *SyntheticCheckState {
+	return &SyntheticCheckState{
+		CheckId:              "42",
+		Job:                  "shop-frontend",
+		Target:               "https://shop.example.com",
+		MetricsDatasourceUid: "grafanacloud-prom",
+		Frequency:            time.Minute,
+		Start:                end.Add(-5 * time.Minute),
+		End:                  end,
+		MinSuccessRatio:      99,
+		MaxLatency:           500 * time.Millisecond,
+	}
+}
+
+func TestSyntheticCheckStatus_EvaluatedAtEnd(t *testing.T) {
+	var exprs []string
+	client := newTestClient(probeClient(t, new(90.0), new(0.8), &exprs))
+
+	result, err := SyntheticCheckStatus(context.Background(), newState(time.Now().Add(time.Minute)), client)
+	require.NoError(t, err)
+	assert.Nil(t, result.Error, "the thresholds are evaluated at the end of the step")
+	assert.Equal(t, "danger", (*result.Metrics)[0].Metric["state"])
+	assert.Equal(t, "Success ratio 90.0%\nAverage latency 800ms", (*result.Metrics)[0].Metric["tooltip"])
+	assert.Contains(t, exprs[0], `{job="shop-frontend",instance="https://shop.example.com"}[240s]`, "the window covers the step so far")
+
+	result, err = SyntheticCheckStatus(context.Background(), newState(time.Now().Add(-time.Second)), client)
+	require.NoError(t, err)
+	assert.True(t, result.Completed)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Synthetic check 'shop-frontend' succeeded 90.0% of the time, less than the required 99% and took 800ms on average, longer than the tolerated 500ms.", result.Error.Title)
+	assert.Equal(t, action_kit_api.Failed, *result.Error.Status)
+	assert.Contains(t, exprs[2], "[300s]", "the window covers exactly the step")
+	assert.Equal(t, "42", (*result.Metrics)[0].Metric["grafana.synthetic-check.id"])
+}
+
+func TestSyntheticCheckStatus_WithinThresholds(t *testing.T) {
+	var exprs []string
+	client := newTestClient(probeClient(t, new(100.0), new(0.2), &exprs))
+
+	result, err := SyntheticCheckStatus(context.Background(), newState(time.Now().Add(-time.Second)), client)
+	require.NoError(t, err)
+	assert.True(t, result.Completed)
+	assert.Nil(t, result.Error)
+	assert.Equal(t, "success", (*result.Metrics)[0].Metric["state"])
+}
+
+func TestSyntheticCheckStatus_NoResults(t *testing.T) {
+	var exprs []string
+	client := newTestClient(probeClient(t, nil, nil, &exprs))
+
+	result, err := SyntheticCheckStatus(context.Background(), newState(time.Now().Add(-time.Second)), client)
+	require.NoError(t, err)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Synthetic check 'shop-frontend' has no probe results within the step.", result.Error.Title)
+	assert.Equal(t, "info", (*result.Metrics)[0].Metric["state"])
+}
+
+func TestWindow(t *testing.T) {
+	now := time.Now()
+	state := &SyntheticCheckState{Start: now.Add(-30 * time.Second), End: now.Add(time.Minute), Frequency: 5 * time.Minute}
+	span, at := window(state, now)
+	assert.Equal(t, 10*time.Minute, span, "at least two runs of the check")
+	assert.Equal(t, now, at)
+
+	state.Frequency = 10 * time.Second
+	span, _ = window(state, now)
+	assert.Equal(t, 30*time.Second, span)
+
+	state.Frequency = 0
+	span, _ = window(state, now)
+	assert.Equal(t, unknownFrequencyWindow, span)
+
+	// once the step ended, exactly the step is evaluated
+	state.Frequency = 10 * time.Second
+	state.Start = now.Add(-5 * time.Minute)
+	state.End = now.Add(-2 * time.Minute)
+	span, at = window(state, now)
+	assert.Equal(t, 3*time.Minute, span)
+	assert.Equal(t, state.End, at)
+}
+
+func TestSyntheticCheckStatus_ToleratesTransientApiErrors(t *testing.T) {
+	state := newState(time.Now().Add(-time.Second))
+	state.ApiErrors = extgrafana.ApiErrorTolerance{MaxConsecutive: 1}
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		return response(504, `gateway timeout`), nil
+	})
+
+	result, err := SyntheticCheckStatus(context.Background(), state, client)
+	require.NoError(t, err)
+	assert.False(t, result.Completed, "the outcome can't be evaluated without the probe results")
+	assert.Equal(t, "info", (*result.Metrics)[0].Metric["state"])
+	assert.Contains(t, (*result.Metrics)[0].Metric["tooltip"], "1 of 1 polls failed")
+
+	_, err = SyntheticCheckStatus(context.Background(), state, client)
+	require.Error(t, err, "the second failure in a row exceeds the tolerance")
+}
@@ -0,0 +1,21 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extsynthetics
+
+import "github.com/steadybit/extension-grafana/extgrafana"
+
+// Instances are the Grafana instances Synthetic Monitoring checks are discovered from and evaluated against.
+var Instances []extgrafana.Instance
+
+const (
+	TargetType = "com.steadybit.extension_grafana.synthetic-check"
+	targetIcon = "data:image/svg+xml,%3Csvg%20width%3D%2224%22%20height%3D%2224%22%20viewBox%3D%220%200%2024%2024%22%20fill%3D%22none%22%20xmlns%3D%22http%3A%2F%2Fwww.w3.org%2F2000%2Fsvg%22%3E%0A%3Cpath%20fill-rule%3D%22evenodd%22%20clip-rule%3D%22evenodd%22%20d%3D%22M12%204C7.58172%204%204%207.58172%204%2012C4%2016.4183%207.58172%2020%2012%2020C16.4183%2020%2020%2016.4183%2020%2012C20%207.58172%2016.4183%204%2012%204ZM2%2012C2%206.47715%206.47715%202%2012%202C17.5228%202%2022%206.47715%2022%2012C22%2017.5228%2017.5228%2022%2012%2022C6.47715%2022%202%2017.5228%202%2012ZM16.7071%209.70711L11%2015.4142L7.29289%2011.7071L8.70711%2010.2929L11%2012.5858L15.2929%208.29289L16.7071%209.70711Z%22%20fill%3D%22%231D2632%22%2F%3E%0A%3C%2Fsvg%3E%0A"
+
+	// datasourceType is the type of the datasource the Synthetic Monitoring app provisions, proxying its API.
+	datasourceType = "synthetic-monitoring-datasource"
+)
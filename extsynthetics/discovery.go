@@ -0,0 +1,231 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extsynthetics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_api"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_commons"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_sdk"
+	"github.com/steadybit/extension-grafana/config"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	"github.com/steadybit/extension-kit/extbuild"
+)
+
+type syntheticCheckDiscovery struct {
+	lastTargets *extgrafana.LastTargetsByInstance
+}
+
+var (
+	_ discovery_kit_sdk.TargetDescriber    = (*syntheticCheckDiscovery)(nil)
+	_ discovery_kit_sdk.AttributeDescriber = (*syntheticCheckDiscovery)(nil)
+)
+
+func NewSyntheticCheckDiscovery() discovery_kit_sdk.TargetDiscovery {
+	discovery := &syntheticCheckDiscovery{lastTargets: extgrafana.NewLastTargetsByInstance()}
+	return discovery_kit_sdk.NewCachedTargetDiscovery(discovery,
+		discovery_kit_sdk.WithRefreshTargetsNow(),
+		discovery_kit_sdk.WithRefreshTargetsInterval(context.Background(), 1*time.Minute),
+	)
+}
+
+func (d *syntheticCheckDiscovery) Describe() discovery_kit_api.DiscoveryDescription {
+	return discovery_kit_api.DiscoveryDescription{
+		Id: TargetType,
+		Discover: discovery_kit_api.DescribingEndpointReferenceWithCallInterval{
+			CallInterval: new("1m"),
+		},
+	}
+}
+
+func (d *syntheticCheckDiscovery) DescribeTarget() discovery_kit_api.TargetDescription {
+	return discovery_kit_api.TargetDescription{
+		Id:       TargetType,
+		Label:    discovery_kit_api.PluralLabel{One: "Grafana Synthetic Check", Other: "Grafana Synthetic Checks"},
+		Category: new("monitoring"),
+		Version:  extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:     new(targetIcon),
+		Table: discovery_kit_api.Table{
+			Columns: []discovery_kit_api.Column{
+				{Attribute: "grafana.synthetic-check.job"},
+				{Attribute: "grafana.synthetic-check.target"},
+				{Attribute: "grafana.synthetic-check.type"},
+				{Attribute: "grafana.instance"},
+			},
+			OrderBy: []discovery_kit_api.OrderBy{
+				{
+					Attribute: "grafana.synthetic-check.job",
+					Direction: "ASC",
+				},
+			},
+		},
+	}
+}
+
+func (d *syntheticCheckDiscovery) DescribeAttributes() []discovery_kit_api.AttributeDescription {
+	return []discovery_kit_api.AttributeDescription{
+		{
+			Attribute: "grafana.synthetic-check.id",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Synthetic check ID",
+				Other: "Synthetic check IDs",
+			},
+		}, {
+			Attribute: "grafana.synthetic-check.job",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Synthetic check",
+				Other: "Synthetic checks",
+			},
+		}, {
+			Attribute: "grafana.synthetic-check.target",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Checked target",
+				Other: "Checked targets",
+			},
+		}, {
+			Attribute: "grafana.synthetic-check.type",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Check type",
+				Other: "Check types",
+			},
+		}, {
+			Attribute: "grafana.synthetic-check.probe",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "Probe",
+				Other: "Probes",
+			},
+		},
+	}
+}
+
+func (d *syntheticCheckDiscovery) DiscoverTargets(ctx context.Context) ([]discovery_kit_api.Target, error) {
+	return d.lastTargets.Discover(ctx, Instances, "synthetic checks", getAllSyntheticChecks)
+}
+
+// getAllSyntheticChecks lists the checks of the Synthetic Monitoring datasources of all organizations of
+// the instance. Organizations without the Synthetic Monitoring app have no such datasource.
+func getAllSyntheticChecks(ctx context.Context, instance extgrafana.Instance) ([]discovery_kit_api.Target, error) {
+	result := make([]discovery_kit_api.Target, 0, 100)
+	for _, org := range extgrafana.GetOrganizations(ctx, instance.Client) {
+		datasources, err := extgrafana.GetDataSources(ctx, instance.Client, org.ID)
+		if err != nil {
+			return nil, fmt.Errorf("organization %d: %w", org.ID, err)
+		}
+		for _, ds := range datasources {
+			if ds.Type != datasourceType {
+				continue
+			}
+			targets, err := getChecksOfDatasource(ctx, instance, org, ds)
+			if err != nil {
+				return nil, fmt.Errorf("organization %d, datasource %s: %w", org.ID, ds.Name, err)
+			}
+			result = append(result, targets...)
+		}
+	}
+	return discovery_kit_commons.ApplyAttributeExcludes(result, config.Config.DiscoveryAttributesExcludesSyntheticCheck), nil
+}
+
+func getChecksOfDatasource(ctx context.Context, instance extgrafana.Instance, org extgrafana.Organization, ds extgrafana.DataSource) ([]discovery_kit_api.Target, error) {
+	metricsUid, err := metricsDatasourceUid(ds)
+	if err != nil {
+		return nil, err
+	}
+	var checks []Check
+	if err := getFromApi(ctx, instance.Client, org.ID, ds.UID, "check/list", &checks); err != nil {
+		return nil, err
+	}
+	var probes []Probe
+	if err := getFromApi(ctx, instance.Client, org.ID, ds.UID, "probe/list", &probes); err != nil {
+		return nil, err
+	}
+	probeNames := make(map[int64]string, len(probes))
+	for _, probe := range probes {
+		probeNames[probe.ID] = probe.Name
+	}
+
+	idPrefix := extgrafana.TargetIdPrefix(instance, org)
+	targets := make([]discovery_kit_api.Target, 0, len(checks))
+	for _, check := range checks {
+		attributes := map[string][]string{
+			"grafana.synthetic-check.id":                     {strconv.FormatInt(check.ID, 10)},
+			"grafana.synthetic-check.job":                    {check.Job},
+			"grafana.synthetic-check.target":                 {check.Target},
+			"grafana.synthetic-check.enabled":                {strconv.FormatBool(check.Enabled)},
+			"grafana.synthetic-check.frequency":              {(time.Duration(check.Frequency) * time.Millisecond).String()},
+			"grafana.synthetic-check.metrics-datasource-uid": {metricsUid},
+			"grafana.host":                                   {instance.Host()},
+			"grafana.instance":                               {instance.Name},
+		}
+		if checkType := checkType(check); checkType != "" {
+			attributes["grafana.synthetic-check.type"] = []string{checkType}
+		}
+		for _, id := range check.Probes {
+			if name, ok := probeNames[id]; ok {
+				attributes["grafana.synthetic-check.probe"] = append(attributes["grafana.synthetic-check.probe"], name)
+			}
+		}
+		for _, label := range check.Labels {
+			attributes["grafana.synthetic-check.label."+label.Name] = append(attributes["grafana.synthetic-check.label."+label.Name], label.Value)
+		}
+		extgrafana.AddOrganizationAttributes(attributes, org)
+		targets = append(targets, discovery_kit_api.Target{
+			Id:         fmt.Sprintf("%s-%s-%d", idPrefix, ds.UID, check.ID),
+			TargetType: TargetType,
+			Label:      check.Job,
+			Attributes: attributes,
+		})
+	}
+	return targets, nil
+}
+
+// getFromApi requests the Synthetic Monitoring API through the proxy of its datasource, which adds the
+// access token of the app.
+func getFromApi(ctx context.Context, client *resty.Client, orgId int, datasourceUid string, path string, result any) error {
+	res, err := extgrafana.SetOrganization(client.R(), orgId).
+		SetContext(ctx).
+		SetResult(result).
+		Get(fmt.Sprintf("/api/datasources/proxy/uid/%s/sm/%s", datasourceUid, path))
+	if err != nil {
+		return fmt.Errorf("failed to request %s: %w", path, err)
+	}
+	if !res.IsSuccess() {
+		return fmt.Errorf("failed to request %s, status code %d: %s", path, res.StatusCode(), res.String())
+	}
+	return nil
+}
+
+func metricsDatasourceUid(ds extgrafana.DataSource) (string, error) {
+	raw, err := json.Marshal(ds.JsonData)
+	if err != nil {
+		return "", err
+	}
+	var jsonData datasourceJsonData
+	if err := json.Unmarshal(raw, &jsonData); err != nil || jsonData.Metrics.UID == "" {
+		return "", fmt.Errorf("the datasource does not name the datasource of the probe results")
+	}
+	return jsonData.Metrics.UID, nil
+}
+
+func checkType(check Check) string {
+	types := make([]string, 0, len(check.Settings))
+	for key := range check.Settings {
+		types = append(types, key)
+	}
+	slices.Sort(types)
+	if len(types) == 0 {
+		return ""
+	}
+	return types[0]
+}
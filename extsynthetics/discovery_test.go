@@ -0,0 +1,71 @@
+package extsynthetics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RoundTripperFunc lets us stub HTTP responses.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newTestClient(fn RoundTripperFunc) *resty.Client {
+	return resty.NewWithClient(&http.Client{Transport: fn})
+}
+
+func response(statusCode int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+	}
+}
+
+func TestGetAllSyntheticChecks(t *testing.T) {
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/api/org":
+			return response(200, `{"id":1,"name":"Main Org."}`), nil
+		case "/api/user/orgs":
+			return response(200, `[{"orgId":1,"name":"Main Org."}]`), nil
+		case "/api/datasources":
+			return response(200, `[
+				{"uid":"prom","name":"Prometheus","type":"prometheus"},
+				{"uid":"sm","name":"Synthetic Monitoring","type":"synthetic-monitoring-datasource","jsonData":{"apiHost":"https://synthetic-monitoring-api.grafana.net","metrics":{"uid":"grafanacloud-prom"}}}
+			]`), nil
+		case "/api/datasources/proxy/uid/sm/sm/check/list":
+			return response(200, `[{
+				"id":42,"job":"shop-frontend","target":"https://shop.example.com","frequency":60000,"timeout":3000,"enabled":true,
+				"probes":[1,2,3],"labels":[{"name":"team","value":"shop"}],"settings":{"http":{"method":"GET"}}
+			}]`), nil
+		case "/api/datasources/proxy/uid/sm/sm/probe/list":
+			return response(200, `[{"id":1,"name":"Frankfurt","region":"EMEA"},{"id":2,"name":"Oregon","region":"AMER"}]`), nil
+		}
+		return response(404, "not found"), nil
+	})
+
+	targets, err := getAllSyntheticChecks(context.Background(), extgrafana.Instance{Name: "default", BaseUrl: "http://grafana.local", Client: client})
+	require.NoError(t, err)
+	require.Len(t, targets, 1)
+
+	check := targets[0]
+	assert.Equal(t, "default-sm-42", check.Id)
+	assert.Equal(t, "shop-frontend", check.Label)
+	assert.Equal(t, []string{"https://shop.example.com"}, check.Attributes["grafana.synthetic-check.target"])
+	assert.Equal(t, []string{"http"}, check.Attributes["grafana.synthetic-check.type"])
+	assert.Equal(t, []string{"Frankfurt", "Oregon"}, check.Attributes["grafana.synthetic-check.probe"], "unknown probes are left out")
+	assert.Equal(t, []string{"1m0s"}, check.Attributes["grafana.synthetic-check.frequency"])
+	assert.Equal(t, []string{"grafanacloud-prom"}, check.Attributes["grafana.synthetic-check.metrics-datasource-uid"])
+	assert.Equal(t, []string{"shop"}, check.Attributes["grafana.synthetic-check.label.team"])
+}
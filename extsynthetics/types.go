@@ -0,0 +1,41 @@
+/*
+ * Copyright 2024 steadybit GmbH. All rights reserved.
+ */
+
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extsynthetics
+
+// Check is a check as listed by the Synthetic Monitoring API. Its settings hold a single entry keyed by
+// the check type, e.g. http or ping.
+type Check struct {
+	ID        int64          `json:"id"`
+	Job       string         `json:"job"`
+	Target    string         `json:"target"`
+	Frequency int64          `json:"frequency"`
+	Timeout   int64          `json:"timeout"`
+	Enabled   bool           `json:"enabled"`
+	Probes    []int64        `json:"probes"`
+	Labels    []CheckLabel   `json:"labels"`
+	Settings  map[string]any `json:"settings"`
+}
+
+type CheckLabel struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type Probe struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Region string `json:"region"`
+}
+
+// datasourceJsonData is the part of the settings of the Synthetic Monitoring datasource naming the
+// datasource the probe results are written to.
+type datasourceJsonData struct {
+	Metrics struct {
+		UID string `json:"uid"`
+	} `json:"metrics"`
+}
@@ -10,6 +10,7 @@ import (
 	_ "github.com/KimMachineGun/automemlimit" // By default, it sets `GOMEMLIMIT` to 90% of cgroup's memory limit.
 	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	"github.com/steadybit/action-kit/go/action_kit_api/v2"
 	"github.com/steadybit/action-kit/go/action_kit_sdk"
 	"github.com/steadybit/discovery-kit/go/discovery_kit_api"
@@ -18,6 +19,12 @@ import (
 	"github.com/steadybit/extension-grafana/config"
 	"github.com/steadybit/extension-grafana/extalertrules"
 	"github.com/steadybit/extension-grafana/extannotations"
+	"github.com/steadybit/extension-grafana/extcontactpoints"
+	"github.com/steadybit/extension-grafana/extdashboards"
+	"github.com/steadybit/extension-grafana/extdatasources"
+	"github.com/steadybit/extension-grafana/extgrafana"
+	"github.com/steadybit/extension-grafana/extslos"
+	"github.com/steadybit/extension-grafana/extsynthetics"
 	"github.com/steadybit/extension-kit/extbuild"
 	"github.com/steadybit/extension-kit/exthealth"
 	"github.com/steadybit/extension-kit/exthttp"
@@ -38,9 +45,20 @@ func main() {
 	config.ParseConfiguration()
 	config.ValidateConfiguration()
 	initRestyClient()
+	initDiscoveryIncludes()
 
 	discovery_kit_sdk.Register(extalertrules.NewAlertDiscovery())
+	discovery_kit_sdk.Register(extalertrules.NewAlertInstanceDiscovery())
+	discovery_kit_sdk.Register(extdashboards.NewDashboardDiscovery())
+	discovery_kit_sdk.Register(extdatasources.NewDatasourceDiscovery())
+	discovery_kit_sdk.Register(extcontactpoints.NewContactPointDiscovery())
+	discovery_kit_sdk.Register(extslos.NewSloDiscovery())
+	discovery_kit_sdk.Register(extsynthetics.NewSyntheticCheckDiscovery())
 	action_kit_sdk.RegisterAction(extalertrules.NewAlertRuleStateCheckAction())
+	action_kit_sdk.RegisterAction(extdatasources.NewDatasourceHealthCheckAction())
+	action_kit_sdk.RegisterAction(extcontactpoints.NewContactPointReachabilityCheckAction())
+	action_kit_sdk.RegisterAction(extslos.NewSloCheckAction())
+	action_kit_sdk.RegisterAction(extsynthetics.NewSyntheticCheckAction())
 	extannotations.RegisterEventListenerHandlers()
 
 	exthttp.RegisterRevisionedHandler("/", getExtensionList)
@@ -57,19 +75,29 @@ func main() {
 }
 
 func initRestyClient() {
-	extalertrules.RestyClient = resty.New()
-	extalertrules.RestyClient.SetTimeout(config.Config.GetApiTimeout())
-	extalertrules.RestyClient.SetBaseURL(config.Config.ApiBaseUrl)
-	extalertrules.RestyClient.SetHeader("Authorization", "Bearer "+config.Config.ServiceToken)
-	extalertrules.RestyClient.SetHeader("Content-Type", "application/json")
-
-	extannotations.RestyClient = resty.New()
-	extannotations.RestyClient.SetTimeout(config.Config.GetApiTimeout())
-	extannotations.RestyClient.SetRetryCount(2)
-	extannotations.RestyClient.SetRetryWaitTime(500 * time.Millisecond)
-	extannotations.RestyClient.SetBaseURL(config.Config.ApiBaseUrl)
-	extannotations.RestyClient.SetHeader("Authorization", "Bearer "+config.Config.ServiceToken)
-	extannotations.RestyClient.SetHeader("Content-Type", "application/json")
+	extalertrules.Instances = extgrafana.NewInstances(config.Config.Instances, func(client *resty.Client) {
+		client.SetRetryCount(2)
+		client.SetRetryWaitTime(200 * time.Millisecond)
+		client.AddRetryCondition(extalertrules.IsRetryable)
+	})
+	extdashboards.Instances = extalertrules.Instances
+	extdatasources.Instances = extalertrules.Instances
+	extcontactpoints.Instances = extalertrules.Instances
+	extslos.Instances = extalertrules.Instances
+	extsynthetics.Instances = extalertrules.Instances
+
+	extannotations.Instances = extgrafana.NewInstances(config.Config.GetAnnotationInstances(), func(client *resty.Client) {
+		client.SetRetryCount(2)
+		client.SetRetryWaitTime(500 * time.Millisecond)
+	})
+}
+
+func initDiscoveryIncludes() {
+	includes, err := extalertrules.ParseDiscoveryIncludes(config.Config.DiscoveryIncludesAlertRule)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to parse STEADYBIT_EXTENSION_DISCOVERY_INCLUDES_ALERT_RULE.")
+	}
+	extalertrules.DiscoveryIncludes = includes
 }
 
 type ExtensionListResponse struct {